@@ -1,18 +1,50 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
+// hqBinary is the hq binary built for the tests by TestMain
+var hqBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "hq-cli-test")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating temp dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	hqBinary = filepath.Join(dir, "hq")
+	build := exec.Command("go", "build", "-o", hqBinary, "./hq")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "building hq: %v\n", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 // CLIScenario represents an end-to-end CLI test case
 type CLIScenario struct {
 	Name          string
 	Args          []string
 	Stdin         string
-	InputFile     string // Contents to write to temp file
-	InputFileName string // Name of temp file (default: input.huml)
+	InputFile     string            // Contents to write to temp file
+	InputFileName string            // Name of temp file (default: input.huml)
+	Files         map[string]string // More temp files by name; args naming one get its path
 	Expected      string
 	ExpectedError string
+	ExpectedFiles map[string]string // Contents of files by name after the run
 	ExitCode      int
 }
 
@@ -20,11 +52,77 @@ type CLIScenario struct {
 func testCLIScenario(t *testing.T, s *CLIScenario) {
 	t.Helper()
 	t.Run(s.Name, func(t *testing.T) {
-		// Skip until CLI is implemented
-		t.Skip("TODO: implement CLI")
+		// Write input files; INPUT and file names in args become their paths
+		dir := t.TempDir()
+		paths := make(map[string]string)
+		if s.InputFile != "" {
+			name := s.InputFileName
+			if name == "" {
+				name = "input.huml"
+			}
+			paths["INPUT"] = writeTestFile(t, dir, name, s.InputFile)
+		}
+		for name, content := range s.Files {
+			paths[name] = writeTestFile(t, dir, name, content)
+		}
+
+		args := make([]string, len(s.Args))
+		for i, arg := range s.Args {
+			args[i] = arg
+			if path, ok := paths[arg]; ok {
+				args[i] = path
+			}
+		}
+
+		cmd := exec.Command(hqBinary, args...)
+		cmd.Stdin = strings.NewReader(s.Stdin)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		exitCode := 0
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("running hq: %v", err)
+			}
+			exitCode = exitErr.ExitCode()
+		}
+
+		if exitCode != s.ExitCode {
+			t.Errorf("exit code: expected %d, got %d (stderr: %s)", s.ExitCode, exitCode, stderr.String())
+		}
+		if s.ExpectedError != "" && !strings.Contains(stderr.String(), s.ExpectedError) {
+			t.Errorf("expected error containing %q, got %q", s.ExpectedError, stderr.String())
+		}
+		if s.Expected != "" {
+			got := strings.TrimSpace(stdout.String())
+			if got != strings.TrimSpace(s.Expected) {
+				t.Errorf("output mismatch\nargs: %v\nexpected:\n%s\ngot:\n%s", s.Args, s.Expected, got)
+			}
+		}
+		for name, want := range s.ExpectedFiles {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Errorf("reading %s: %v", name, err)
+				continue
+			}
+			if got := strings.TrimSpace(string(data)); got != strings.TrimSpace(want) {
+				t.Errorf("%s mismatch\nexpected:\n%s\ngot:\n%s", name, want, got)
+			}
+		}
 	})
 }
 
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	return path
+}
+
 // Basic CLI scenarios
 var basicCLIScenarios = []CLIScenario{
 	{
@@ -50,6 +148,12 @@ var basicCLIScenarios = []CLIScenario{
 		Args:     []string{"-n", "1 + 2"},
 		Expected: `3`,
 	},
+	{
+		Name:          "error with an object value",
+		Args:          []string{"-n", `error({code: 3, msg: "bad port"})`},
+		ExpectedError: `error (not a string): {"code":3,"msg":"bad port"}`,
+		ExitCode:      5,
+	},
 }
 
 // Output format scenarios
@@ -68,6 +172,16 @@ var outputFormatScenarios = []CLIScenario{
 		Stdin:    `name: "Alice"`,
 		Expected: `{"name":"Alice"}`,
 	},
+	{
+		Name:     "nan and infinite as JSON",
+		Args:     []string{"-n", "-o", "json", "-c", "[nan, infinite]"},
+		Expected: `[null,1.7976931348623157e+308]`,
+	},
+	{
+		Name:     "nan and infinite as HUML",
+		Args:     []string{"-n", "[nan, -infinite]"},
+		Expected: "- nan\n- -inf",
+	},
 	{
 		Name:     "raw string output",
 		Args:     []string{"-r", ".name"},
@@ -75,15 +189,78 @@ var outputFormatScenarios = []CLIScenario{
 		Expected: `Alice`,
 	},
 	{
-		Name:  "raw output multiple values",
-		Args:  []string{"-r", ".[]"},
-		Stdin: `- "a"\n- "b"\n- "c"`,
+		Name: "raw output multiple values",
+		Args: []string{"-r", ".[]"},
+		Stdin: `- "a"
+- "b"
+- "c"`,
 		Expected: `a
 b
 c`,
 	},
 }
 
+// Input format scenarios
+var inputFormatScenarios = []CLIScenario{
+	{
+		Name:     "YAML that is also HUML",
+		Args:     []string{"-p", "yaml", "-o", "json", "-c", "."},
+		Stdin:    "a: 1\n---\nb: 2\n",
+		Expected: "{\"a\":1}\n{\"b\":2}",
+	},
+	{
+		Name:     "JSON stream with --input-format",
+		Args:     []string{"--input-format", "json", ".id"},
+		Stdin:    "{\"id\": 1}\n{\"id\": 2}\n",
+		Expected: "1\n2",
+	},
+	{
+		Name:     "format from the file extension",
+		Args:     []string{"-o", "json", "-c", ".", "app.yml"},
+		Files:    map[string]string{"app.yml": "ports: [80, 443]\n"},
+		Expected: `{"ports":[80,443]}`,
+	},
+	{
+		Name:     "-p overrides the file extension",
+		Args:     []string{"-p", "json", ".a", "data.huml"},
+		Files:    map[string]string{"data.huml": `{"a": 1}`},
+		Expected: `1`,
+	},
+	{
+		Name:     "YAML dates are read as strings, as fromyaml reads them",
+		Args:     []string{"-c", "-o", "json", "[.day, (.day | type), .at]", "app.yaml"},
+		Files:    map[string]string{"app.yaml": "day: 2024-01-15\nat: 2024-01-15T10:00:00Z\n"},
+		Expected: `["2024-01-15","string","2024-01-15T10:00:00Z"]`,
+	},
+	{
+		Name:          "JSON error with line and column",
+		Args:          []string{".", "bad.json"},
+		Files:         map[string]string{"bad.json": "{\"a\": 1,\n \"b\": }"},
+		ExpectedError: "bad.json: parse error: line 2, column 7: invalid character '}'",
+		ExitCode:      3,
+	},
+	{
+		Name:          "HUML error for a .huml file",
+		Args:          []string{".", "bad.huml"},
+		Files:         map[string]string{"bad.huml": "a: 1\nb: [\n"},
+		ExpectedError: "bad.huml: parse error: line 2: unexpected character '['",
+		ExitCode:      3,
+	},
+	{
+		Name:          "auto-detection reports every parser",
+		Args:          []string{"."},
+		Stdin:         "a: 1\nb: [\n",
+		ExpectedError: "could not detect the input format (choose one with -p):\n  as HUML: line 2: unexpected character '['\n  as JSON: line 1, column 1: invalid character 'a'",
+		ExitCode:      3,
+	},
+	{
+		Name:          "unknown input format",
+		Args:          []string{"-p", "toml", "."},
+		ExpectedError: `unknown input format "toml"`,
+		ExitCode:      2,
+	},
+}
+
 // Error scenarios
 var errorCLIScenarios = []CLIScenario{
 	{
@@ -97,7 +274,15 @@ var errorCLIScenarios = []CLIScenario{
 		Name:          "file not found",
 		Args:          []string{".", "nonexistent.huml"},
 		ExpectedError: "no such file",
-		ExitCode:      1,
+		ExitCode:      2,
+	},
+	{
+		Name:          "file not found among readable files",
+		Args:          []string{"-c", "-o", "json", ".n", "a.json", "nonexistent.huml"},
+		Files:         map[string]string{"a.json": `{"n": 1}`},
+		Expected:      `1`,
+		ExpectedError: "reading nonexistent.huml",
+		ExitCode:      2,
 	},
 	{
 		Name:          "invalid HUML",
@@ -106,6 +291,19 @@ var errorCLIScenarios = []CLIScenario{
 		ExpectedError: "parse error",
 		ExitCode:      3,
 	},
+	{
+		Name:          "unknown flag",
+		Args:          []string{"--colour", "."},
+		ExpectedError: "unknown flag: --colour",
+		ExitCode:      2,
+	},
+	{
+		Name:          "evaluation error",
+		Args:          []string{".a + 1"},
+		Stdin:         `{"a": "x"}`,
+		ExpectedError: "evaluation error",
+		ExitCode:      5,
+	},
 }
 
 // Exit status scenarios
@@ -132,8 +330,46 @@ var exitStatusScenarios = []CLIScenario{
 		Name:     "exit status no results",
 		Args:     []string{"-e", "empty"},
 		Stdin:    `null`,
+		ExitCode: 4,
+	},
+	{
+		Name:     "exit status follows the last output",
+		Args:     []string{"--exit-status", ".[]"},
+		Stdin:    `[false, 1]`,
+		Expected: "false\n1",
+		ExitCode: 0,
+	},
+	{
+		Name:     "exit status for a missing key",
+		Args:     []string{"-e", ".enabled"},
+		Stdin:    `{"name": "web"}`,
+		Expected: "null",
 		ExitCode: 1,
 	},
+	{
+		Name:     "halt stops without an error",
+		Args:     []string{"-n", "1, halt, 2"},
+		Expected: "1",
+		ExitCode: 0,
+	},
+	{
+		Name:          "halt_error prints a string as it is",
+		Args:          []string{"-n", `"not ready\n" | halt_error`},
+		ExpectedError: "not ready\n",
+		ExitCode:      5,
+	},
+	{
+		Name:          "halt_error with an exit status",
+		Args:          []string{`if .replicas > 0 then . else {error: "no replicas"} | halt_error(3) end`},
+		Stdin:         `{"replicas": 0}`,
+		ExpectedError: `{"error":"no replicas"}`,
+		ExitCode:      3,
+	},
+	{
+		Name:     "halt_error with status 0",
+		Args:     []string{"-n", `"" | halt_error(0)`},
+		ExitCode: 0,
+	},
 }
 
 // Slurp mode scenarios
@@ -158,6 +394,131 @@ var slurpScenarios = []CLIScenario{
 3`,
 		Expected: `6`,
 	},
+	{
+		Name:     "slurp several files",
+		Args:     []string{"-s", "-c", "-o", "json", "map(.n)", "a.json", "b.yaml"},
+		Files:    map[string]string{"a.json": `{"n": 1}`, "b.yaml": "n: 2\n---\nn: 3\n"},
+		Expected: `[1,2,3]`,
+	},
+	{
+		Name:     "slurp with null input",
+		Args:     []string{"-n", "-s", "input | length"},
+		Stdin:    "1\n---\n2\n",
+		Expected: `2`,
+	},
+	{
+		Name:     "slurp empty input",
+		Args:     []string{"-s", "-c", "-o", "json", "."},
+		Expected: `[]`,
+	},
+	{
+		Name:     "merge files",
+		Args:     []string{"--merge", "-c", "-o", "json", ".", "base.json", "prod.yaml"},
+		Files:    map[string]string{"base.json": `{"db": {"host": "localhost", "port": 5432}, "debug": true}`, "prod.yaml": "db:\n  host: db.prod\ndebug: false\n"},
+		Expected: `{"db":{"host":"db.prod","port":5432},"debug":false}`,
+	},
+	{
+		Name:     "eval-all merges",
+		Args:     []string{"eval-all", ".a + .b"},
+		Stdin:    "a: 1\n---\nb: 2\n",
+		Expected: `3`,
+	},
+	{
+		Name:          "merge a non-object",
+		Args:          []string{"--merge", "."},
+		Stdin:         "a: 1\n---\n[1, 2]\n",
+		ExpectedError: "cannot merge document 2: array is not an object",
+		ExitCode:      5,
+	},
+	{
+		Name:          "slurp and merge together",
+		Args:          []string{"-s", "--merge", "."},
+		ExpectedError: "--slurp cannot be combined with --merge",
+		ExitCode:      2,
+	},
+	{
+		Name:          "a bad file does not stop the others",
+		Args:          []string{".n", "a.json", "bad.json", "c.json"},
+		Files:         map[string]string{"a.json": `{"n": 1}`, "bad.json": `{"n": `, "c.json": `{"n": 3}`},
+		Expected:      "1\n3",
+		ExpectedError: "bad.json: parse error",
+		ExitCode:      3,
+	},
+	{
+		Name:          "slurp skips a bad file",
+		Args:          []string{"-s", "-c", "-o", "json", "map(.n)", "a.json", "bad.json"},
+		Files:         map[string]string{"a.json": `{"n": 1}`, "bad.json": `{"n": `},
+		Expected:      `[1]`,
+		ExpectedError: "1 of the inputs could not be read",
+		ExitCode:      3,
+	},
+}
+
+// Multi-document input scenarios
+var multiDocumentScenarios = []CLIScenario{
+	{
+		Name: "YAML stream",
+		Args: []string{".a"},
+		Stdin: `a: 1
+---
+a: 2`,
+		Expected: "1\n2",
+	},
+	{
+		Name:     "NDJSON",
+		Args:     []string{"-c", "-o", "json", ".id"},
+		Stdin:    "{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3}\n",
+		Expected: "1\n2\n3",
+	},
+	{
+		Name:     "concatenated JSON values",
+		Args:     []string{"-c", "-o", "json", "."},
+		Stdin:    `{"a":1}{"a":2}[3]`,
+		Expected: "{\"a\":1}\n{\"a\":2}\n[3]",
+	},
+	{
+		Name:     "one document per file",
+		Args:     []string{".name", "a.huml", "b.json"},
+		Files:    map[string]string{"a.huml": `name: "a"`, "b.json": `{"name": "b"}`},
+		Expected: "\"a\"\n\"b\"",
+	},
+	{
+		Name:     "empty input produces no results",
+		Args:     []string{"."},
+		Stdin:    "",
+		Expected: "",
+	},
+	{
+		Name:     "inputs with null input",
+		Args:     []string{"-n", "-c", "-o", "json", "[inputs]"},
+		Stdin:    "1 2 3",
+		Expected: "[1,2,3]",
+	},
+	{
+		Name:     "input reads the next document",
+		Args:     []string{"-c", "-o", "json", "[., input]"},
+		Stdin:    "1 2 3 4",
+		Expected: "[1,2]\n[3,4]",
+	},
+	{
+		Name:     "first(inputs) reads only one document",
+		Args:     []string{"-n", "first(inputs), input"},
+		Stdin:    "1 2 3",
+		Expected: "1\n2",
+	},
+	{
+		Name:     "document index",
+		Args:     []string{"-c", "-o", "json", "[$__doc, document_index]"},
+		Stdin:    "a: 1\n---\na: 2",
+		Expected: "[0,0]\n[1,1]",
+	},
+	{
+		Name:          "input past the end",
+		Args:          []string{"-n", "input"},
+		Stdin:         "",
+		ExpectedError: "no more inputs",
+		ExitCode:      5,
+	},
 }
 
 // Variable scenarios
@@ -178,7 +539,143 @@ var variableCLIScenarios = []CLIScenario{
 		Name:     "multiple arguments",
 		Args:     []string{"--arg", "a", "1", "--arg", "b", "2", `{a: $a, b: $b}`},
 		Stdin:    `null`,
-		Expected: `a: "1"\nb: "2"`,
+		Expected: "a: \"1\"\nb: \"2\"",
+	},
+	{
+		Name:     "string argument with quotes",
+		Args:     []string{"-n", "--arg", "q", `say "hi"`, "$q"},
+		Expected: `"say \"hi\""`,
+	},
+	{
+		Name:          "invalid JSON argument",
+		Args:          []string{"-n", "--argjson", "x", "{bad", "$x"},
+		ExpectedError: "--argjson: invalid JSON text",
+		ExitCode:      2,
+	},
+	{
+		Name:     "named arguments in $ARGS and $__named",
+		Args:     []string{"-n", "-c", "-o", "json", "--arg", "a", "1", "--argjson", "b", "[2]", "$ARGS.named, $__named.b"},
+		Expected: "{\"a\":\"1\",\"b\":[2]}\n[2]",
+	},
+	{
+		Name:     "positional string arguments",
+		Args:     []string{"-n", "-c", "-o", "json", "$ARGS", "--args", "x", "y"},
+		Expected: `{"named":{},"positional":["x","y"]}`,
+	},
+	{
+		Name:     "positional JSON arguments",
+		Args:     []string{"-n", "-c", "-o", "json", "--jsonargs", "$ARGS.positional | add", "1", "2", "3"},
+		Expected: `6`,
+	},
+	{
+		Name:     "slurp a HUML file",
+		Args:     []string{"--slurpfile", "ports", "ports.huml", ".port = $ports[0].http"},
+		Stdin:    `{}`,
+		Files:    map[string]string{"ports.huml": "http: 8080\n"},
+		Expected: `port: 8080`,
+	},
+	{
+		Name:     "slurp a YAML stream",
+		Args:     []string{"-n", "-c", "-o", "json", "--slurpfile", "docs", "docs.yaml", "$docs | map(.id)"},
+		Files:    map[string]string{"docs.yaml": "id: a\n---\nid: b\n"},
+		Expected: `["a","b"]`,
+	},
+	{
+		Name:     "slurped YAML dates are strings",
+		Args:     []string{"-n", "-c", "-o", "json", "--slurpfile", "docs", "docs.yaml", "$docs | map(.day | type)"},
+		Files:    map[string]string{"docs.yaml": "day: 2024-01-15\n"},
+		Expected: `["string"]`,
+	},
+	{
+		Name:     "raw file",
+		Args:     []string{"-n", "--rawfile", "tpl", "banner.txt", "$tpl | length"},
+		Files:    map[string]string{"banner.txt": "héllo\n"},
+		Expected: `6`,
+	},
+	{
+		Name:          "missing value",
+		Args:          []string{"-n", "$x", "--arg", "x"},
+		ExpectedError: "--arg requires a name and a value",
+		ExitCode:      2,
+	},
+}
+
+// In-place editing scenarios
+var inPlaceScenarios = []CLIScenario{
+	{
+		Name:          "edit a HUML file",
+		Args:          []string{"-i", ".server.port = 8080", "config.huml"},
+		Files:         map[string]string{"config.huml": "server::\n  port: 80\n"},
+		ExpectedFiles: map[string]string{"config.huml": "server::\n  port: 8080"},
+	},
+	{
+		Name:  "edit a JSON file",
+		Args:  []string{"--in-place", ".debug = false", "app.json"},
+		Files: map[string]string{"app.json": `{"debug": true}`},
+		ExpectedFiles: map[string]string{"app.json": `{
+  "debug": false
+}`},
+	},
+	{
+		Name:          "edit a YAML file",
+		Args:          []string{"-i", ".name |= ascii_upcase", "app.yaml"},
+		Files:         map[string]string{"app.yaml": "name: web app\n"},
+		ExpectedFiles: map[string]string{"app.yaml": "name: WEB APP"},
+	},
+	{
+		Name:  "editing a YAML file leaves its timestamps as written",
+		Args:  []string{"-i", `.name = "db"`, "app.yaml"},
+		Files: map[string]string{"app.yaml": "at: 2024-01-15T00:00:00Z\nday: 2024-01-15\nname: web\nsince: 2024-01-15 10:00:00\n"},
+		ExpectedFiles: map[string]string{
+			"app.yaml": "at: 2024-01-15T00:00:00Z\nday: 2024-01-15\nname: db\nsince: 2024-01-15 10:00:00",
+		},
+	},
+	{
+		Name:  "edit several files with a backup",
+		Args:  []string{"-i", "--backup", ".orig", ".n += 1", "a.json", "b.json"},
+		Files: map[string]string{"a.json": `{"n": 1}`, "b.json": `{"n": 2}`},
+		ExpectedFiles: map[string]string{
+			"a.json":      "{\n  \"n\": 2\n}",
+			"b.json":      "{\n  \"n\": 3\n}",
+			"a.json.orig": `{"n": 1}`,
+			"b.json.orig": `{"n": 2}`,
+		},
+	},
+	{
+		Name:          "more than one result leaves files untouched",
+		Args:          []string{"-i", ".[]", "a.json", "b.json"},
+		Files:         map[string]string{"a.json": `{"n": 1}`, "b.json": `{"n": 2, "m": 3}`},
+		ExpectedError: "b.json: in-place editing needs exactly one result per file, got 2",
+		ExpectedFiles: map[string]string{"a.json": `{"n": 1}`, "b.json": `{"n": 2, "m": 3}`},
+		ExitCode:      5,
+	},
+	{
+		Name:          "a multi-document file is left untouched",
+		Args:          []string{"-i", ".n = 0", "a.yaml"},
+		Files:         map[string]string{"a.yaml": "n: 1\n---\nn: 2\n"},
+		ExpectedError: "a.yaml: in-place editing needs a file with one document, found 2",
+		ExpectedFiles: map[string]string{"a.yaml": "n: 1\n---\nn: 2\n"},
+		ExitCode:      2,
+	},
+	{
+		Name:          "a missing file",
+		Args:          []string{"-i", ".n = 0", "missing.json"},
+		ExpectedError: "reading missing.json",
+		ExitCode:      2,
+	},
+	{
+		Name:          "no input files",
+		Args:          []string{"-i", "."},
+		Stdin:         `{}`,
+		ExpectedError: "--in-place requires at least one input file",
+		ExitCode:      2,
+	},
+	{
+		Name:          "backup without in-place",
+		Args:          []string{"--backup", ".bak", ".", "a.json"},
+		Files:         map[string]string{"a.json": `{}`},
+		ExpectedError: "--backup requires --in-place",
+		ExitCode:      2,
 	},
 }
 
@@ -194,6 +691,18 @@ func TestOutputFormats(t *testing.T) {
 	}
 }
 
+func TestInputFormats(t *testing.T) {
+	for _, s := range inputFormatScenarios {
+		testCLIScenario(t, &s)
+	}
+}
+
+func TestMultiDocumentInput(t *testing.T) {
+	for _, s := range multiDocumentScenarios {
+		testCLIScenario(t, &s)
+	}
+}
+
 func TestCLIErrors(t *testing.T) {
 	for _, s := range errorCLIScenarios {
 		testCLIScenario(t, &s)
@@ -217,3 +726,27 @@ func TestCLIVariables(t *testing.T) {
 		testCLIScenario(t, &s)
 	}
 }
+
+func TestInPlace(t *testing.T) {
+	for _, s := range inPlaceScenarios {
+		testCLIScenario(t, &s)
+	}
+}
+
+func TestInPlaceKeepsPermissions(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "secret.json", `{"token": "a"}`)
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(hqBinary, "-i", `.token = "b"`, path).CombinedOutput(); err != nil {
+		t.Fatalf("running hq: %v\n%s", err, out)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("expected mode 0600, got %o", mode)
+	}
+}
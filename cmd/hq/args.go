@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// argValue returns the value a variable-injection flag binds for text:
+// the text itself for --arg and --args, its JSON value for --argjson and
+// --jsonargs, the contents of the file it names for --rawfile, and an
+// array of the documents of that file for --slurpfile.
+func argValue(flag, text string) (any, error) {
+	switch flag {
+	case "--argjson", "--jsonargs":
+		var v any
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			return nil, fmt.Errorf("%s: invalid JSON text %q: %w", flag, text, err)
+		}
+		return v, nil
+	case "--rawfile":
+		data, err := os.ReadFile(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flag, err)
+		}
+		return string(data), nil
+	case "--slurpfile":
+		data, err := os.ReadFile(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flag, err)
+		}
+		docs, _, err := parseDocuments(data, formatFor(text, formatAuto))
+		if err != nil {
+			return nil, fmt.Errorf("%s: parsing %s: %w", flag, text, err)
+		}
+		if docs == nil {
+			docs = []any{}
+		}
+		return docs, nil
+	}
+	return text, nil
+}
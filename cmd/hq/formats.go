@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	huml "github.com/huml-lang/go-huml"
+	"github.com/rhnvrm/hq/pkg/eval"
+	"gopkg.in/yaml.v3"
+)
+
+// Input formats, as chosen with -p and reported by parseDocuments.
+const (
+	formatAuto = "auto"
+	formatHUML = "huml"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// formatParsers parse all the documents of an input in one format.
+var formatParsers = map[string]func([]byte) ([]any, error){
+	formatHUML: parseHUML,
+	formatJSON: parseJSON,
+	formatYAML: parseYAML,
+}
+
+// formatFor returns the format to read the named file in: format itself
+// unless it is auto, otherwise the one its extension names, if any.
+func formatFor(name, format string) string {
+	if format != formatAuto {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".huml":
+		return formatHUML
+	case ".json", ".jsonl", ".ndjson":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	}
+	return formatAuto
+}
+
+// parseDocuments splits input into documents and reports the format they
+// were read in. In auto format HUML, JSON and YAML are tried in turn, and if
+// none of them can read the input the error of each is reported.
+func parseDocuments(data []byte, format string) ([]any, string, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		if format == formatAuto {
+			format = formatHUML
+		}
+		return nil, format, nil
+	}
+	if format != formatAuto {
+		docs, err := formatParsers[format](data)
+		return docs, format, err
+	}
+
+	docs, humlErr := parseHUML(data)
+	if humlErr == nil {
+		return docs, formatHUML, nil
+	}
+	docs, jsonErr := parseJSON(data)
+	if jsonErr == nil {
+		return docs, formatJSON, nil
+	}
+	// Documents between --- lines are each detected on their own, so a
+	// stream of HUML documents is not taken for YAML
+	if docs, ok := detectEach(data); ok {
+		return docs, formatYAML, nil
+	}
+	docs, yamlErr := parseYAML(data)
+	if yamlErr == nil {
+		return docs, formatYAML, nil
+	}
+	return nil, "", fmt.Errorf("could not detect the input format (choose one with -p):\n  as HUML: %v\n  as JSON: %v\n  as YAML: %v", humlErr, jsonErr, yamlErr)
+}
+
+// detectEach parses each document of a --- stream in the format detected
+// for it. It reports false if the input is not a stream or any document
+// cannot be parsed.
+func detectEach(data []byte) ([]any, bool) {
+	parts := splitDocuments(string(data))
+	if len(parts) < 2 {
+		return nil, false
+	}
+	var docs []any
+	for _, part := range parts {
+		partDocs, _, err := parseDocuments([]byte(part), formatAuto)
+		if err != nil {
+			return nil, false
+		}
+		docs = append(docs, partDocs...)
+	}
+	return docs, true
+}
+
+// parseHUML parses a single HUML document.
+func parseHUML(data []byte) ([]any, error) {
+	var v any
+	if err := huml.Unmarshal(bytes.TrimRight(data, " \t\r\n"), &v); err != nil {
+		return nil, err
+	}
+	return []any{eval.NormalizeDecoded(v)}, nil
+}
+
+// parseJSON parses one or more JSON values separated by whitespace, as in
+// NDJSON. Errors give the line and column of the offending character.
+func parseJSON(data []byte) ([]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var docs []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			// The offset is the number of bytes read when the error was found
+			offset := len(bytes.TrimRight(data, " \t\r\n"))
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				offset = int(syntaxErr.Offset)
+			}
+			line, column := position(data, offset)
+			return nil, fmt.Errorf("line %d, column %d: %w", line, column, err)
+		}
+		docs = append(docs, v)
+	}
+}
+
+// position returns the 1-based line and column of the byte that ends the
+// first offset bytes of data.
+func position(data []byte, offset int) (line, column int) {
+	i := min(max(offset-1, 0), len(data))
+	before := data[:i]
+	return bytes.Count(before, []byte("\n")) + 1, i - bytes.LastIndexByte(before, '\n')
+}
+
+// parseYAML parses a stream of YAML documents separated by --- lines,
+// skipping empty ones.
+func parseYAML(data []byte) ([]any, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs []any
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err == nil && len(node.Content) > 0 {
+			var v any
+			if v, err = eval.DecodeYAMLNode(&node); err == nil {
+				docs = append(docs, v)
+			}
+		}
+		if err != nil {
+			return nil, errors.New(strings.TrimPrefix(err.Error(), "yaml: "))
+		}
+	}
+}
+
+// splitDocuments splits text at --- separator lines, dropping empty documents.
+func splitDocuments(text string) []string {
+	var parts []string
+	var current []string
+	flush := func() {
+		part := strings.TrimSpace(strings.Join(current, "\n"))
+		if part != "" {
+			parts = append(parts, part)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimRight(line, " \t\r") == "---" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return parts
+}
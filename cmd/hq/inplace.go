@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rhnvrm/hq/pkg/eval"
+	"gopkg.in/yaml.v3"
+)
+
+// fileEdit is the new content of a file edited in place.
+type fileEdit struct {
+	path     string
+	original []byte
+	data     []byte
+	mode     os.FileMode
+}
+
+// editInPlace evaluates expr on each file and writes the result back to the
+// file in the format it was read in, which inputFormat chooses as for
+// other input. Every file is evaluated before any is
+// written, and each must hold one document and produce exactly one result,
+// so a failing expression leaves all of them untouched.
+func editInPlace(expr string, files []string, inputFormat string, opts eval.Options, backupSuffix string) error {
+	edits := make([]fileEdit, 0, len(files))
+	for _, name := range files {
+		// Edit the target of a symlink rather than replacing the link
+		path, err := filepath.EvalSymlinks(name)
+		if err != nil {
+			return &exitError{code: exitInput, err: fmt.Errorf("reading %s: %w", name, err)}
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return &exitError{code: exitInput, err: fmt.Errorf("reading %s: %w", name, err)}
+		}
+		original, err := os.ReadFile(path)
+		if err != nil {
+			return &exitError{code: exitInput, err: fmt.Errorf("reading %s: %w", name, err)}
+		}
+
+		docs, format, err := parseDocuments(original, formatFor(name, inputFormat))
+		if err != nil {
+			return &exitError{code: exitParse, err: fmt.Errorf("%s: parse error: %w", name, err)}
+		}
+		// A stream cannot be written back as it was read, so only single
+		// documents are edited
+		if len(docs) > 1 {
+			return &exitError{code: exitInput, err: fmt.Errorf("%s: in-place editing needs a file with one document, found %d", name, len(docs))}
+		}
+		results, err := eval.EvaluateDocuments(expr, docs, opts)
+		var parseErr *eval.ParseError
+		if errors.As(err, &parseErr) {
+			return err
+		}
+		if err != nil {
+			return &exitError{code: exitEval, err: fmt.Errorf("evaluation error: %s: %w", name, err)}
+		}
+		if len(results) != 1 {
+			return &exitError{code: exitEval, err: fmt.Errorf("%s: in-place editing needs exactly one result per file, got %d", name, len(results))}
+		}
+
+		var buf bytes.Buffer
+		encode := outputValue
+		if format == formatYAML {
+			encode = keepPlainTimestamps(original)
+		}
+		if err := encode(&buf, results[0], format, false, false); err != nil {
+			return &exitError{code: exitEval, err: fmt.Errorf("encoding %s: %w", name, err)}
+		}
+		edits = append(edits, fileEdit{path: path, original: original, data: buf.Bytes(), mode: info.Mode().Perm()})
+	}
+
+	for _, e := range edits {
+		if err := replaceFile(e, backupSuffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepPlainTimestamps returns an encoder for YAML that writes the strings
+// read from unquoted timestamps in original unquoted again, so editing a
+// file does not turn at: 2024-01-15 into at: "2024-01-15".
+func keepPlainTimestamps(original []byte) func(io.Writer, any, string, bool, bool) error {
+	texts := map[string]bool{}
+	var doc yaml.Node
+	if yaml.Unmarshal(original, &doc) == nil {
+		walkYAML(&doc, func(n *yaml.Node) {
+			if n.Style == 0 && n.ShortTag() == "!!timestamp" {
+				texts[n.Value] = true
+			}
+		})
+	}
+
+	return func(w io.Writer, v any, _ string, _, _ bool) error {
+		var out yaml.Node
+		if err := out.Encode(v); err != nil {
+			return err
+		}
+		walkYAML(&out, func(n *yaml.Node) {
+			if n.Tag == "!!str" && texts[n.Value] {
+				n.Tag, n.Style = "!!timestamp", 0
+			}
+		})
+		data, err := yaml.Marshal(&out)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
+
+// walkYAML calls f for every scalar under n.
+func walkYAML(n *yaml.Node, f func(*yaml.Node)) {
+	if n.Kind == yaml.ScalarNode {
+		f(n)
+	}
+	for _, child := range n.Content {
+		walkYAML(child, f)
+	}
+}
+
+// replaceFile writes the new content of a file to a temporary file in the
+// same directory and renames it over the original, so the file is never
+// seen half written. The file keeps its permissions. With a backup suffix
+// the original content is first saved next to it.
+func replaceFile(e fileEdit, backupSuffix string) error {
+	if backupSuffix != "" {
+		if err := os.WriteFile(e.path+backupSuffix, e.original, e.mode); err != nil {
+			return fmt.Errorf("writing backup of %s: %w", e.path, err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), "."+filepath.Base(e.path)+".*")
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", e.path, err)
+	}
+	_, err = tmp.Write(e.data)
+	if err == nil {
+		err = tmp.Chmod(e.mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), e.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing %s: %w", e.path, err)
+	}
+	return nil
+}
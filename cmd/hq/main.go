@@ -2,7 +2,9 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -20,11 +22,76 @@ var (
 	date    = "unknown"
 )
 
+// Exit statuses, as in jq.
+const (
+	exitFailure  = 1 // any other error, or -e and the last output was false or null
+	exitUsage    = 2 // bad flags or arguments
+	exitInput    = 2 // an input file could not be read
+	exitParse    = 3 // the expression or an input could not be parsed
+	exitNoOutput = 4 // -e and there was no output
+	exitEval     = 5 // the expression raised an error
+)
+
 func main() {
-	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
-		fmt.Fprintf(os.Stderr, "hq: %v\n", err)
-		os.Exit(1)
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	os.Exit(exitStatus(err, os.Stderr))
+}
+
+// exitError ends hq with a particular exit status. With a nil err, as for
+// -e, nothing is reported.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// usageErrorf returns an error that ends hq with the usage exit status.
+func usageErrorf(format string, args ...any) error {
+	return &exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// exitStatus reports err on stderr and returns the status hq exits with.
+// halt and halt_error choose their own status; halt_error's message is
+// written as it is if it is a string and as JSON otherwise.
+func exitStatus(err error, stderr io.Writer) int {
+	if err == nil {
+		return 0
+	}
+
+	var halt *eval.HaltError
+	if errors.As(err, &halt) {
+		if halt.HasMessage {
+			if s, ok := halt.Message.(string); ok {
+				fmt.Fprint(stderr, s)
+			} else if data, err := json.Marshal(eval.JSONCompatible(halt.Message)); err == nil {
+				fmt.Fprintln(stderr, string(data))
+			}
+		}
+		return halt.Code
 	}
+
+	code := exitFailure
+	var parseErr *eval.ParseError
+	var exitErr *exitError
+	switch {
+	case errors.As(err, &parseErr):
+		code = exitParse
+	case errors.As(err, &exitErr):
+		code = exitErr.code
+		if exitErr.err == nil {
+			return code
+		}
+	}
+	fmt.Fprintf(stderr, "hq: %v\n", err)
+	return code
 }
 
 func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
@@ -33,26 +100,79 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		rawOutput    bool
 		nullInput    bool
 		compactJSON  bool
-		outputFormat = "huml" // huml, json, yaml
+		inputFormat  = formatAuto // auto, huml, json, yaml
+		outputFormat = "huml"     // huml, json, yaml
+		exitOnResult bool
+		slurp        bool
+		merge        bool
+		inPlace      bool
+		backupSuffix string
 		expression   string
 		inputFiles   []string
+
+		// Variables from --arg and friends, and positional arguments
+		// after --args or --jsonargs (positionalFlag names which)
+		namedArgs      = make(map[string]any)
+		positionalArgs []any
+		positionalFlag string
 	)
 
+	// eval-all, as in yq, is --merge
+	if len(args) > 0 && args[0] == "eval-all" {
+		merge = true
+		args = args[1:]
+	}
+
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
 		switch arg {
+		case "-e", "--exit-status":
+			exitOnResult = true
+		case "-s", "--slurp":
+			slurp = true
+		case "--merge":
+			merge = true
 		case "-r", "--raw-output":
 			rawOutput = true
 		case "-n", "--null-input":
 			nullInput = true
 		case "-c", "--compact-output":
 			compactJSON = true
+		case "-p", "--input-format":
+			if i+1 >= len(args) {
+				return usageErrorf("missing argument for %s", arg)
+			}
+			i++
+			inputFormat = args[i]
+			if _, ok := formatParsers[inputFormat]; !ok && inputFormat != formatAuto {
+				return usageErrorf("unknown input format %q (expected huml, json, yaml or auto)", inputFormat)
+			}
 		case "-o", "--output":
 			if i+1 >= len(args) {
-				return fmt.Errorf("missing argument for %s", arg)
+				return usageErrorf("missing argument for %s", arg)
 			}
 			i++
 			outputFormat = args[i]
+		case "-i", "--in-place":
+			inPlace = true
+		case "--backup":
+			if i+1 >= len(args) {
+				return usageErrorf("missing argument for %s", arg)
+			}
+			i++
+			backupSuffix = args[i]
+		case "--arg", "--argjson", "--slurpfile", "--rawfile":
+			if i+2 >= len(args) {
+				return usageErrorf("%s requires a name and a value", arg)
+			}
+			v, err := argValue(arg, args[i+2])
+			if err != nil {
+				return &exitError{code: exitUsage, err: err}
+			}
+			namedArgs[args[i+1]] = v
+			i += 2
+		case "--args", "--jsonargs":
+			positionalFlag = arg
 		case "-h", "--help":
 			printHelp(stdout)
 			return nil
@@ -61,89 +181,199 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 			return nil
 		default:
 			if strings.HasPrefix(arg, "-") {
-				return fmt.Errorf("unknown flag: %s", arg)
+				return usageErrorf("unknown flag: %s", arg)
 			}
-			if expression == "" {
+			switch {
+			case expression == "":
 				expression = arg
-			} else {
+			case positionalFlag != "":
+				v, err := argValue(positionalFlag, arg)
+				if err != nil {
+					return &exitError{code: exitUsage, err: err}
+				}
+				positionalArgs = append(positionalArgs, v)
+			default:
 				inputFiles = append(inputFiles, arg)
 			}
 		}
 	}
 
 	if expression == "" {
-		return fmt.Errorf("no expression provided\nUsage: hq [flags] EXPRESSION [FILE...]")
+		return usageErrorf("no expression provided\nUsage: hq [flags] EXPRESSION [FILE...]")
 	}
 
-	// Get input
-	var input any
-	if nullInput {
-		input = nil
-	} else if len(inputFiles) > 0 {
-		// Read from file(s)
-		for _, file := range inputFiles {
-			data, err := os.ReadFile(file)
-			if err != nil {
-				return fmt.Errorf("reading %s: %w", file, err)
-			}
-			var v any
-			if err := parseInput(data, &v); err != nil {
-				return fmt.Errorf("parsing %s: %w", file, err)
-			}
-			input = v // For now, just use the last file
-		}
-	} else {
-		// Read from stdin
-		data, err := io.ReadAll(stdin)
-		if err != nil {
-			return fmt.Errorf("reading stdin: %w", err)
-		}
-		if len(data) > 0 {
-			if err := parseInput(data, &input); err != nil {
-				return fmt.Errorf("parsing stdin: %w", err)
-			}
+	opts := eval.Options{
+		NullInput:      nullInput,
+		NamedArgs:      namedArgs,
+		PositionalArgs: positionalArgs,
+	}
+	if backupSuffix != "" && !inPlace {
+		return usageErrorf("--backup requires --in-place")
+	}
+	if slurp && merge {
+		return usageErrorf("--slurp cannot be combined with --merge")
+	}
+	if inPlace {
+		switch {
+		case len(inputFiles) == 0:
+			return usageErrorf("--in-place requires at least one input file")
+		case nullInput:
+			return usageErrorf("--in-place cannot be combined with --null-input")
+		case slurp || merge:
+			return usageErrorf("--in-place cannot be combined with --slurp or --merge")
 		}
+		return editInPlace(expression, inputFiles, inputFormat, opts, backupSuffix)
 	}
 
-	// Evaluate expression
-	results, err := eval.Evaluate(expression, input)
-	if err != nil {
-		return fmt.Errorf("evaluation error: %w", err)
+	// A source that cannot be read is reported and skipped, so the other
+	// files still produce their results
+	failed, inputStatus := 0, exitFailure
+	next := documentStream(inputFiles, stdin, inputFormat, func(err error) {
+		fmt.Fprintf(stderr, "hq: %v\n", err)
+		failed++
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			inputStatus = max(inputStatus, exitErr.code)
+		}
+	})
+	switch {
+	case slurp:
+		next = combineDocuments(next, func(docs []any) (any, error) {
+			return docs, nil
+		})
+	case merge:
+		next = combineDocuments(next, func(docs []any) (any, error) {
+			return eval.MergeDocuments(docs)
+		})
 	}
 
-	// Output results
-	for i, result := range results {
-		if i > 0 {
+	// Evaluate the expression once per input document, printing results as
+	// they are produced
+	first, prevMultiline := true, false
+	var last any
+	err := eval.EvaluateStream(expression, next, opts, func(result any) error {
+		last = result
+		var buf bytes.Buffer
+		if err := outputValue(&buf, result, outputFormat, rawOutput, compactJSON); err != nil {
+			return err
+		}
+
+		// Multi-line values are set apart by a blank line
+		out := buf.String()
+		multiline := strings.Contains(strings.TrimSuffix(out, "\n"), "\n")
+		if !first && (multiline || prevMultiline) {
 			fmt.Fprintln(stdout)
 		}
-		if err := outputValue(stdout, result, outputFormat, rawOutput, compactJSON); err != nil {
+		first, prevMultiline = false, multiline
+		_, err := io.WriteString(stdout, out)
+		return err
+	})
+	if err != nil {
+		var inErr *inputError
+		var parseErr *eval.ParseError
+		switch {
+		case errors.As(err, &inErr):
+			return inErr.err
+		case errors.As(err, &parseErr):
 			return err
 		}
+		return &exitError{code: exitEval, err: fmt.Errorf("evaluation error: %w", err)}
+	}
+	if failed > 0 {
+		return &exitError{code: inputStatus, err: fmt.Errorf("%d of the inputs could not be read", failed)}
 	}
 
+	// With -e the last output decides the exit status
+	if exitOnResult {
+		switch {
+		case first:
+			return &exitError{code: exitNoOutput}
+		case last == nil || last == false:
+			return &exitError{code: exitFailure}
+		}
+	}
 	return nil
 }
 
-// parseInput tries to parse input as HUML, JSON, or YAML
-func parseInput(data []byte, v *any) error {
-	text := strings.TrimSpace(string(data))
+// inputError is a failure to read or parse an input source, as opposed to
+// an error raised by the expression.
+type inputError struct {
+	err error
+}
 
-	// Try HUML first (native format for hq)
-	if err := huml.Unmarshal([]byte(text), v); err == nil {
-		return nil
-	}
+func (e *inputError) Error() string { return e.err.Error() }
 
-	// Try JSON (common for piping)
-	if err := json.Unmarshal([]byte(text), v); err == nil {
-		return nil
-	}
+// documentStream returns a function that yields the documents of each input
+// file in turn, or of stdin if there are no files. A source is only read
+// once its first document is needed, so hq -n does not wait on stdin unless
+// the expression calls input or inputs. A source that cannot be read or
+// parsed is passed to report, naming it, and the stream moves on. Each
+// source is read in format, or as its extension says if format is auto.
+func documentStream(files []string, stdin io.Reader, format string, report func(error)) func() (any, bool, error) {
+	var pending []any
+	readStdin := len(files) == 0
+
+	return func() (any, bool, error) {
+		for len(pending) == 0 {
+			var data []byte
+			var name string
+			var err error
+			switch {
+			case readStdin:
+				readStdin = false
+				name = "stdin"
+				data, err = io.ReadAll(stdin)
+			case len(files) > 0:
+				name = files[0]
+				files = files[1:]
+				data, err = os.ReadFile(name)
+			default:
+				return nil, false, nil
+			}
+			if err != nil {
+				report(&exitError{code: exitInput, err: fmt.Errorf("reading %s: %w", name, err)})
+				continue
+			}
 
-	// Try YAML as fallback
-	if err := yaml.Unmarshal([]byte(text), v); err == nil {
-		return nil
+			pending, _, err = parseDocuments(data, formatFor(name, format))
+			if err != nil {
+				report(&exitError{code: exitParse, err: fmt.Errorf("%s: parse error: %w", name, err)})
+			}
+		}
+
+		doc := pending[0]
+		pending = pending[1:]
+		return doc, true, nil
 	}
+}
+
+// combineDocuments returns a stream with a single document: combine applied
+// to every document of next, as for --slurp and --merge.
+func combineDocuments(next func() (any, bool, error), combine func([]any) (any, error)) func() (any, bool, error) {
+	done := false
+	return func() (any, bool, error) {
+		if done {
+			return nil, false, nil
+		}
+		done = true
 
-	return fmt.Errorf("could not parse as HUML, JSON, or YAML")
+		docs := []any{}
+		for {
+			doc, ok, err := next()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				break
+			}
+			docs = append(docs, doc)
+		}
+		combined, err := combine(docs)
+		if err != nil {
+			return nil, false, &inputError{&exitError{code: exitEval, err: err}}
+		}
+		return combined, true, nil
+	}
 }
 
 // outputValue formats and writes a single result
@@ -158,6 +388,8 @@ func outputValue(w io.Writer, v any, format string, raw, compact bool) error {
 
 	switch format {
 	case "json":
+		// NaN and infinities have no JSON form; print them as jq does
+		v = eval.JSONCompatible(v)
 		var data []byte
 		var err error
 		if compact {
@@ -178,13 +410,14 @@ func outputValue(w io.Writer, v any, format string, raw, compact bool) error {
 		fmt.Fprint(w, string(data))
 
 	default: // huml or default
-		// Use go-huml for proper HUML output
-		data, err := huml.Marshal(v)
-		if err != nil {
+		// Use go-huml for proper HUML output, without the version
+		// directive so that each result prints as a bare value
+		var buf bytes.Buffer
+		if err := huml.NewEncoder(&buf).Encode(v); err != nil {
 			// Fallback to simple output for types huml can't handle
 			return outputSimple(w, v)
 		}
-		fmt.Fprint(w, string(data))
+		fmt.Fprint(w, buf.String())
 	}
 
 	return nil
@@ -218,12 +451,30 @@ Usage:
   hq [flags] EXPRESSION [FILE...]
 
 Flags:
-  -r, --raw-output     Output raw strings without quotes
-  -n, --null-input     Use null as input (don't read stdin)
-  -c, --compact-output Compact JSON output (no pretty-printing)
-  -o, --output FORMAT  Output format: huml (default), json, yaml
-  -h, --help           Show this help message
-  -V, --version        Show version
+  -r, --raw-output            Output raw strings without quotes
+  -n, --null-input            Use null as input (read documents with input/inputs)
+  -c, --compact-output        Compact JSON output (no pretty-printing)
+  -p, --input-format FORMAT   Input format: auto (default, from the file extension
+                              or by trying each), huml, json, yaml
+  -e, --exit-status           Exit 1 if the last output is false or null, 4 if there is none
+  -o, --output FORMAT         Output format: huml (default), json, yaml
+  -s, --slurp                 Read all documents into one array and run once on it
+      --merge                 Deep-merge all documents into one object (also: hq eval-all)
+  -i, --in-place              Write each result back to its file, in the file's format
+      --backup SUFFIX         With -i, keep the original of each file as FILE+SUFFIX
+      --arg NAME VALUE        Bind $NAME to the string VALUE
+      --argjson NAME JSON     Bind $NAME to the JSON value JSON
+      --slurpfile NAME FILE   Bind $NAME to an array of the documents in FILE
+      --rawfile NAME FILE     Bind $NAME to the contents of FILE as a string
+      --args                  Take the remaining arguments as strings in $ARGS.positional
+      --jsonargs              Take the remaining arguments as JSON in $ARGS.positional
+  -h, --help                  Show this help message
+  -V, --version               Show version
+
+Exit status:
+  0 success, 1 error (or -e and the last output is false or null), 2 usage error
+  or unreadable input file, 3 expression or input parse error, 4 no output with
+  -e, 5 evaluation error; halt_error(CODE) exits with CODE
 
 Examples:
   # Get a field from JSON/YAML
@@ -240,6 +491,18 @@ Examples:
 
   # Output as JSON
   echo 'name: Alice' | hq -o json '.'
+
+  # Read YAML that would otherwise be taken for HUML
+  kubectl get pod web -o yaml | hq -p yaml '.status.phase'
+
+  # Change a value in a config file, keeping a backup
+  hq -i --backup .bak '.server.port = 8080' config.json
+
+  # Pass values from the shell; $ARGS.named holds them all
+  hq --arg env prod --argjson replicas 3 '.env = $env | .replicas = $replicas' app.huml
+
+  # Collect every document of a stream
+  printf '{"id": 1}\n{"id": 2}\n' | hq -n '[inputs | .id]'
 `
 	fmt.Fprint(w, help)
 }
@@ -0,0 +1,153 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gohuml "github.com/huml-lang/go-huml"
+	"github.com/rhnvrm/hq/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// codec encodes values to and decodes values from one text format.
+type codec struct {
+	name   string
+	encode func(v any) (string, error)
+	decode func(s string) (any, error)
+}
+
+var (
+	jsonCodec = codec{name: "JSON", encode: toJSONText, decode: decodeJSON}
+	humlCodec = codec{name: "HUML", encode: encodeHUML, decode: decodeHUML}
+	yamlCodec = codec{name: "YAML", encode: encodeYAML, decode: decodeYAML}
+)
+
+// evalEncode serializes each input with c, as in tojson, tohuml and toyaml.
+func evalEncode(c codec, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		s, err := c.encode(node.Value)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode %s as %s: %w", typeName(node.Value), c.name, err)
+		}
+		results = append(results, types.NewCandidateNode(s))
+	}
+	return results, nil
+}
+
+// evalDecode parses each input string with c, as in fromjson, fromhuml and fromyaml.
+func evalDecode(c codec, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		s, ok := node.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s cannot be parsed as %s, only a string can be", describeValue(node.Value), c.name)
+		}
+		v, err := c.decode(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as %s: %w", s, c.name, err)
+		}
+		results = append(results, types.NewCandidateNode(v))
+	}
+	return results, nil
+}
+
+func decodeJSON(s string) (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// encodeHUML renders v as a HUML document without the version header.
+func encodeHUML(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := gohuml.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func decodeHUML(s string) (any, error) {
+	var v any
+	if err := gohuml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return NormalizeDecoded(v), nil
+}
+
+func encodeYAML(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// decodeYAML parses the first document of s.
+func decodeYAML(s string) (any, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+		return nil, err
+	}
+	return DecodeYAMLNode(&node)
+}
+
+// DecodeYAMLNode converts a parsed YAML document into the values the
+// evaluator works with. Timestamps become strings holding the text they
+// were written with, so 2024-01-15T00:00:00Z is not shortened and
+// 2024-01-15 10:00:00 keeps its space.
+func DecodeYAMLNode(node *yaml.Node) (any, error) {
+	keepTimestampText(node)
+	var v any
+	if err := node.Decode(&v); err != nil {
+		return nil, err
+	}
+	return NormalizeDecoded(v), nil
+}
+
+// keepTimestampText retags every timestamp scalar under node as a string.
+func keepTimestampText(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!timestamp" {
+		node.Tag = "!!str"
+	}
+	for _, child := range node.Content {
+		keepTimestampText(child)
+	}
+}
+
+// NormalizeDecoded converts what the HUML and YAML decoders produce into the
+// values the evaluator works with: integers become float64 and maps with
+// non-string keys get string keys. YAML timestamps are already strings when
+// decoded with DecodeYAMLNode. Documents decoded outside the evaluator, such as hq's inputs, go through
+// it too, so they match what fromhuml and fromyaml return.
+func NormalizeDecoded(v any) any {
+	switch val := v.(type) {
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case []any:
+		for i, elem := range val {
+			val[i] = NormalizeDecoded(elem)
+		}
+		return val
+	case map[string]any:
+		for k, elem := range val {
+			val[k] = NormalizeDecoded(elem)
+		}
+		return val
+	case map[any]any:
+		m := make(map[string]any, len(val))
+		for k, elem := range val {
+			m[fmt.Sprint(k)] = NormalizeDecoded(elem)
+		}
+		return m
+	}
+	return v
+}
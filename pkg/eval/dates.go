@@ -0,0 +1,636 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// Dates are numbers of seconds since the Unix epoch, as in jq. A broken down
+// time is an array [year, month (0-11), day of month, hours, minutes,
+// seconds, day of week (0-6, Sunday first), day of year (0-365)].
+
+// nowEnvVar overrides the time reported by now, as an ISO 8601 date or a
+// number of seconds since the epoch.
+const nowEnvVar = "HQ_NOW"
+
+// iso8601Layout is the format of todate and the default of strftime.
+const iso8601Layout = "%Y-%m-%dT%H:%M:%SZ"
+
+// evalNow evaluates now: the context's time if one is set, then HQ_NOW,
+// then the current time.
+func evalNow(ctx *types.Context) ([]*types.CandidateNode, error) {
+	t := ctx.Now
+	if t.IsZero() {
+		if s := os.Getenv(nowEnvVar); s != "" {
+			secs, err := parseNow(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q: %w", nowEnvVar, s, err)
+			}
+			return nodesFor(ctx, secs), nil
+		}
+		t = time.Now()
+	}
+	return nodesFor(ctx, timeToSeconds(t)), nil
+}
+
+func parseNow(s string) (float64, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return secs, nil
+	}
+	t, _, err := parseISO8601(s)
+	if err != nil {
+		return 0, err
+	}
+	return timeToSeconds(t), nil
+}
+
+// nodesFor returns v once for each input.
+func nodesFor(ctx *types.Context, v any) []*types.CandidateNode {
+	results := make([]*types.CandidateNode, len(ctx.MatchingNodes))
+	for i := range ctx.MatchingNodes {
+		results[i] = types.NewCandidateNode(v)
+	}
+	return results
+}
+
+// evalToDate evaluates todate: seconds since the epoch as an ISO 8601 string.
+func evalToDate(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapDates(ctx, func(v any) (any, error) {
+		t, err := dateValueToTime(v, "todate")
+		if err != nil {
+			return nil, err
+		}
+		return strftime(t.UTC(), iso8601Layout)
+	})
+}
+
+// evalFromDate evaluates fromdate: an ISO 8601 string as seconds since the
+// epoch. Offsets such as +02:00 are honoured and a missing zone means UTC.
+func evalFromDate(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapDates(ctx, func(v any) (any, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("fromdate: input must be a string, got %s", typeName(v))
+		}
+		t, _, err := parseISO8601(s)
+		if err != nil {
+			return nil, err
+		}
+		return timeToSeconds(t), nil
+	})
+}
+
+// evalStrftime evaluates strftime(FMT) and strflocaltime(FMT) for a number
+// or broken down time.
+func evalStrftime(name string, fmtExpr parser.ExpressionNode, loc *time.Location, ctx *types.Context) ([]*types.CandidateNode, error) {
+	format, err := stringArg(name, "format", fmtExpr, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mapDates(ctx, func(v any) (any, error) {
+		t, err := dateValueToTime(v, name)
+		if err != nil {
+			return nil, err
+		}
+		return strftime(t.In(loc), format)
+	})
+}
+
+// evalStrptime evaluates strptime(FMT): a string parsed with FMT as a
+// broken down time in UTC.
+func evalStrptime(fmtExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	format, err := stringArg("strptime", "format", fmtExpr, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mapDates(ctx, func(v any) (any, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("strptime: input must be a string, got %s", typeName(v))
+		}
+		t, err := strptime(s, format)
+		if err != nil {
+			return nil, err
+		}
+		return brokenDownTime(t.UTC()), nil
+	})
+}
+
+// evalMktime evaluates mktime: a broken down time in UTC as seconds since the epoch.
+func evalMktime(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapDates(ctx, func(v any) (any, error) {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("mktime requires a broken down time, got %s", typeName(v))
+		}
+		t, err := brokenDownToTime(arr)
+		if err != nil {
+			return nil, fmt.Errorf("mktime: %w", err)
+		}
+		return math.Floor(timeToSeconds(t)), nil
+	})
+}
+
+// evalGmtime evaluates gmtime and localtime: seconds since the epoch as a
+// broken down time in UTC or the local time zone.
+func evalGmtime(name string, loc *time.Location, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapDates(ctx, func(v any) (any, error) {
+		secs, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("%s requires a number, got %s", name, typeName(v))
+		}
+		return brokenDownTime(secondsToTime(secs).In(loc)), nil
+	})
+}
+
+// evalDateAdd evaluates dateadd(UNIT; N) and datesub(UNIT; N) on a number
+// of seconds or an ISO 8601 string. A string result keeps the layout and
+// offset of the input. Months and years follow the calendar.
+func evalDateAdd(name string, unitExpr, nExpr parser.ExpressionNode, sign float64, ctx *types.Context) ([]*types.CandidateNode, error) {
+	unit, err := stringArg(name, "unit", unitExpr, ctx)
+	if err != nil {
+		return nil, err
+	}
+	nResults, err := evaluate(nExpr, ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(nResults) == 0 {
+		return nil, fmt.Errorf("%s: amount produced no value", name)
+	}
+	n, ok := toNumber(nResults[0].Value)
+	if !ok {
+		return nil, fmt.Errorf("%s: amount must be a number, got %s", name, typeName(nResults[0].Value))
+	}
+	n *= sign
+
+	return mapDates(ctx, func(v any) (any, error) {
+		if s, ok := v.(string); ok {
+			t, layout, err := parseISO8601(s)
+			if err != nil {
+				return nil, err
+			}
+			t, err = addDuration(t, unit, n)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return t.Format(layout), nil
+		}
+		secs, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("%s requires a number or a date string, got %s", name, typeName(v))
+		}
+		t, err := addDuration(secondsToTime(secs), unit, n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return timeToSeconds(t), nil
+	})
+}
+
+// addDuration adds n units to t. Days, weeks, months and years are calendar
+// units and must be whole numbers. Adding months or years to a day that the
+// target month does not have gives the last day of that month, so
+// 2024-01-31 plus one month is 2024-02-29.
+func addDuration(t time.Time, unit string, n float64) (time.Time, error) {
+	base := strings.TrimSuffix(unit, "s")
+	switch base {
+	case "second":
+		return t.Add(time.Duration(n * float64(time.Second))), nil
+	case "minute":
+		return t.Add(time.Duration(n * float64(time.Minute))), nil
+	case "hour":
+		return t.Add(time.Duration(n * float64(time.Hour))), nil
+	case "day", "week", "month", "year":
+		if n != math.Trunc(n) {
+			return t, fmt.Errorf("%ss must be a whole number, got %s", base, interpolateToString(n))
+		}
+	default:
+		return t, fmt.Errorf("unknown unit %q, expected seconds, minutes, hours, days, weeks, months or years", unit)
+	}
+
+	switch base {
+	case "day":
+		return t.AddDate(0, 0, int(n)), nil
+	case "week":
+		return t.AddDate(0, 0, 7*int(n)), nil
+	case "month":
+		return addMonths(t, int(n)), nil
+	}
+	return addMonths(t, 12*int(n)), nil
+}
+
+// addMonths adds months to t, clamping the day to the end of the month.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, lastDay)-1)
+}
+
+// mapDates applies f to each input.
+func mapDates(ctx *types.Context, f func(v any) (any, error)) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		v, err := f(node.Value)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(v))
+	}
+	return results, nil
+}
+
+// stringArg evaluates a function argument that must be a string.
+func stringArg(name, what string, expr parser.ExpressionNode, ctx *types.Context) (string, error) {
+	results, err := evaluate(expr, ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("%s: %s produced no value", name, what)
+	}
+	s, ok := results[0].Value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s must be a string, got %s", name, what, typeName(results[0].Value))
+	}
+	return s, nil
+}
+
+// dateValueToTime converts seconds since the epoch or a broken down time.
+func dateValueToTime(v any, name string) (time.Time, error) {
+	if arr, ok := v.([]any); ok {
+		t, err := brokenDownToTime(arr)
+		if err != nil {
+			return t, fmt.Errorf("%s: %w", name, err)
+		}
+		return t, nil
+	}
+	secs, ok := toNumber(v)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s requires a number or a broken down time, got %s", name, typeName(v))
+	}
+	return secondsToTime(secs), nil
+}
+
+func secondsToTime(secs float64) time.Time {
+	whole, frac := math.Modf(secs)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC()
+}
+
+func timeToSeconds(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+}
+
+// brokenDownTime returns t as [year, month, day, hours, minutes, seconds,
+// weekday, yearday], with fractional seconds.
+func brokenDownTime(t time.Time) []any {
+	return []any{
+		float64(t.Year()),
+		float64(t.Month() - 1),
+		float64(t.Day()),
+		float64(t.Hour()),
+		float64(t.Minute()),
+		float64(t.Second()) + float64(t.Nanosecond())/1e9,
+		float64(t.Weekday()),
+		float64(t.YearDay() - 1),
+	}
+}
+
+// brokenDownToTime converts a broken down time in UTC. The weekday and
+// yearday are ignored, as in C's timegm.
+func brokenDownToTime(arr []any) (time.Time, error) {
+	if len(arr) < 6 {
+		return time.Time{}, fmt.Errorf("broken down time requires at least 6 numbers, got %d", len(arr))
+	}
+	var fields [6]float64
+	for i := range fields {
+		num, ok := toNumber(arr[i])
+		if !ok {
+			return time.Time{}, fmt.Errorf("broken down time must contain numbers, got %s", typeName(arr[i]))
+		}
+		fields[i] = num
+	}
+	secs, frac := math.Modf(fields[5])
+	return time.Date(int(fields[0]), time.Month(fields[1]+1), int(fields[2]),
+		int(fields[3]), int(fields[4]), int(secs), int(frac*1e9), time.UTC), nil
+}
+
+// iso8601Layouts are the forms accepted by fromdate, most specific first.
+// Fractional seconds are accepted after the seconds of any of them.
+var iso8601Layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// parseISO8601 parses an ISO 8601 date or date-time and returns the layout
+// it matched. Without a zone the time is taken to be UTC.
+func parseISO8601(s string) (time.Time, string, error) {
+	for _, layout := range iso8601Layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, layout, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("date %q is not an ISO 8601 date", s)
+}
+
+// strftime formats t with C strftime directives.
+func strftime(t time.Time, format string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("strftime: format ends with %%")
+		}
+		switch d := format[i]; d {
+		case 'Y':
+			fmt.Fprintf(&sb, "%04d", t.Year())
+		case 'C':
+			fmt.Fprintf(&sb, "%02d", t.Year()/100)
+		case 'y':
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&sb, "%2d", t.Day())
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&sb, "%02d", (t.Hour()+11)%12+1)
+		case 'M':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'a':
+			sb.WriteString(t.Format("Mon"))
+		case 'A':
+			sb.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			sb.WriteString(t.Format("Jan"))
+		case 'B':
+			sb.WriteString(t.Format("January"))
+		case 'u':
+			fmt.Fprintf(&sb, "%d", (int(t.Weekday())+6)%7+1)
+		case 'w':
+			fmt.Fprintf(&sb, "%d", int(t.Weekday()))
+		case 'Z':
+			sb.WriteString(t.Format("MST"))
+		case 'z':
+			sb.WriteString(t.Format("-0700"))
+		case 's':
+			fmt.Fprintf(&sb, "%d", t.Unix())
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'R':
+			sb.WriteString(t.Format("15:04"))
+		case 'D':
+			sb.WriteString(t.Format("01/02/06"))
+		case 'F':
+			sb.WriteString(t.Format(time.DateOnly))
+		case 'c':
+			sb.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case '%':
+			sb.WriteByte('%')
+		default:
+			return "", fmt.Errorf("strftime: unsupported directive %%%c", d)
+		}
+	}
+	return sb.String(), nil
+}
+
+// strptime parses s with C strptime directives. %z accepts Z, +hh, +hhmm
+// and +hh:mm, and the result is in that offset (UTC without one).
+func strptime(s, format string) (time.Time, error) {
+	mismatch := fmt.Errorf("date %q does not match format %q", s, format)
+
+	year, month, day, yday := 1900, 1, 1, 0
+	hour, minute, sec, offset := 0, 0, 0, 0
+	pm, twelveHour := false, false
+	var epoch *int64
+
+	pos := 0
+	// number reads up to width digits, with an optional sign when signed is set
+	number := func(width int, signed bool) (int, bool) {
+		start := pos
+		if signed && pos < len(s) && (s[pos] == '-' || s[pos] == '+') {
+			pos++
+		}
+		digits := pos
+		for pos < len(s) && pos-digits < width && s[pos] >= '0' && s[pos] <= '9' {
+			pos++
+		}
+		if pos == digits {
+			pos = start
+			return 0, false
+		}
+		n, err := strconv.Atoi(s[start:pos])
+		return n, err == nil
+	}
+	// name matches one of names, ignoring case, by full or abbreviated form
+	name := func(names []string) (int, bool) {
+		for i, n := range names {
+			for _, form := range []string{n, n[:3]} {
+				if len(s)-pos >= len(form) && strings.EqualFold(s[pos:pos+len(form)], form) {
+					pos += len(form)
+					return i, true
+				}
+			}
+		}
+		return 0, false
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == ' ' || c == '\t' || c == '\n' {
+			for pos < len(s) && (s[pos] == ' ' || s[pos] == '\t' || s[pos] == '\n') {
+				pos++
+			}
+			continue
+		}
+		if c != '%' {
+			if pos >= len(s) || s[pos] != c {
+				return time.Time{}, mismatch
+			}
+			pos++
+			continue
+		}
+		i++
+		if i == len(format) {
+			return time.Time{}, fmt.Errorf("strptime: format ends with %%")
+		}
+
+		ok := true
+		switch d := format[i]; d {
+		case 'Y':
+			year, ok = number(4, true)
+		case 'y':
+			var y int
+			if y, ok = number(2, false); ok {
+				// As in POSIX: 69-99 are 1969-1999, 00-68 are 2000-2068
+				year = 1900 + y
+				if y < 69 {
+					year = 2000 + y
+				}
+			}
+		case 'm':
+			month, ok = number(2, false)
+		case 'd', 'e':
+			for pos < len(s) && s[pos] == ' ' {
+				pos++
+			}
+			day, ok = number(2, false)
+		case 'j':
+			yday, ok = number(3, false)
+		case 'H':
+			hour, ok = number(2, false)
+		case 'I':
+			hour, ok = number(2, false)
+			twelveHour = true
+		case 'M':
+			minute, ok = number(2, false)
+		case 'S':
+			sec, ok = number(2, false)
+		case 'p':
+			var idx int
+			if idx, ok = name([]string{"AM", "PM"}); ok {
+				pm = idx == 1
+			}
+		case 'a', 'A':
+			_, ok = name(weekdayNames)
+		case 'b', 'B', 'h':
+			var m int
+			if m, ok = name(monthNames); ok {
+				month = m + 1
+			}
+		case 'z':
+			offset, ok = parseOffset(s, &pos)
+		case 'Z':
+			start := pos
+			for pos < len(s) && (s[pos] >= 'A' && s[pos] <= 'Z' || s[pos] >= 'a' && s[pos] <= 'z') {
+				pos++
+			}
+			ok = pos > start
+		case 's':
+			var n int
+			if n, ok = number(20, true); ok {
+				e := int64(n)
+				epoch = &e
+			}
+		case 'T', 'R', 'D', 'F':
+			// Composite directives are replaced by what they stand for
+			format = format[:i-1] + strptimeComposites[d] + format[i+1:]
+			i -= 2
+			continue
+		case '%':
+			ok = pos < len(s) && s[pos] == '%'
+			pos++
+		default:
+			return time.Time{}, fmt.Errorf("strptime: unsupported directive %%%c", d)
+		}
+		if !ok {
+			return time.Time{}, mismatch
+		}
+	}
+	if pos != len(s) {
+		return time.Time{}, mismatch
+	}
+
+	if epoch != nil {
+		return time.Unix(*epoch, 0).UTC(), nil
+	}
+	if twelveHour {
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	loc := time.UTC
+	if offset != 0 {
+		loc = time.FixedZone("", offset)
+	}
+	if yday > 0 && month == 1 && day == 1 {
+		return time.Date(year, 1, yday, hour, minute, sec, 0, loc), nil
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, sec, 0, loc), nil
+}
+
+// parseOffset reads a zone offset (Z, +hh, +hhmm or +hh:mm) at *pos and
+// returns it in seconds east of UTC.
+func parseOffset(s string, pos *int) (int, bool) {
+	rest := s[*pos:]
+	if strings.HasPrefix(rest, "Z") {
+		*pos++
+		return 0, true
+	}
+	if len(rest) < 3 || (rest[0] != '+' && rest[0] != '-') {
+		return 0, false
+	}
+	hours, err := strconv.Atoi(rest[1:3])
+	if err != nil {
+		return 0, false
+	}
+	n := 3
+	minutes := 0
+	digits := rest[3:]
+	if strings.HasPrefix(digits, ":") {
+		digits = digits[1:]
+		n++
+	}
+	if len(digits) >= 2 {
+		if m, err := strconv.Atoi(digits[:2]); err == nil {
+			minutes = m
+			n += 2
+		} else if n == 4 {
+			return 0, false
+		}
+	} else if n == 4 {
+		return 0, false
+	}
+	*pos += n
+
+	offset := hours*3600 + minutes*60
+	if rest[0] == '-' {
+		offset = -offset
+	}
+	return offset, true
+}
+
+var strptimeComposites = map[byte]string{
+	'T': "%H:%M:%S",
+	'R': "%H:%M",
+	'D': "%m/%d/%y",
+	'F': "%Y-%m-%d",
+}
+
+var weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+var monthNames = []string{"January", "February", "March", "April", "May", "June", "July",
+	"August", "September", "October", "November", "December"}
@@ -0,0 +1,155 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// evalDestructureBind evaluates destructuring variable binding
+// (expr as {x: $x, y: $y} | body), including ?// alternatives.
+func evalDestructureBind(n *parser.DestructureBindNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		exprCtx := ctx.Clone()
+		exprCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		err := evaluateEach(n.Expr, exprCtx, func(exprResult *types.CandidateNode) error {
+			return bindPatterns(n.Patterns, exprResult.Value, exprCtx, func(bodyCtx *types.Context) error {
+				return evaluateEach(n.Body, bodyCtx, emit)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindPatterns destructures value and calls body with the variables bound.
+// With ?// alternatives, every variable of every pattern is bound (to null if
+// its pattern is not the one used), and a pattern is abandoned for the next
+// one if destructuring or body fails. The last pattern's error is returned.
+func bindPatterns(patterns []*parser.Pattern, value any, ctx *types.Context, body func(*types.Context) error) error {
+	if len(patterns) == 1 {
+		return bindPattern(patterns[0], value, ctx, body)
+	}
+
+	base := ctx.Clone()
+	for _, pattern := range patterns {
+		for _, name := range patternVars(pattern) {
+			base.Variables[name] = nil
+		}
+	}
+
+	var err error
+	for _, pattern := range patterns {
+		err = bindPattern(pattern, value, base, body)
+		if err == nil || isBreak(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// bindPattern destructures value with pattern and calls body once for each
+// way it matches. That is once unless an object key produces several outputs.
+func bindPattern(pattern *parser.Pattern, value any, ctx *types.Context, body func(*types.Context) error) error {
+	switch {
+	case pattern.Var != "":
+		bound := ctx.Clone()
+		bound.Variables[pattern.Var] = value
+		return body(bound)
+	case pattern.Elements != nil:
+		if _, ok := value.([]any); !ok && value != nil {
+			return fmt.Errorf("cannot index %T with number", value)
+		}
+		return bindElements(pattern.Elements, 0, value, ctx, body)
+	default:
+		return bindFields(pattern.Fields, value, ctx, body)
+	}
+}
+
+// bindElements binds elements[i:] to value[i:].
+func bindElements(elements []*parser.Pattern, i int, value any, ctx *types.Context, body func(*types.Context) error) error {
+	if i == len(elements) {
+		return body(ctx)
+	}
+	return bindPattern(elements[i], accessIndex(value, i), ctx, func(bound *types.Context) error {
+		return bindElements(elements, i+1, value, bound, body)
+	})
+}
+
+// bindFields binds the object pattern fields to value's fields. Computed keys
+// are evaluated against value and can use variables bound by earlier fields.
+func bindFields(fields []parser.PatternField, value any, ctx *types.Context, body func(*types.Context) error) error {
+	if len(fields) == 0 {
+		return body(ctx)
+	}
+	field := fields[0]
+
+	var keys []any
+	if field.Key == nil {
+		keys = []any{field.KeyVar}
+	} else {
+		keyResults, err := applyTo(field.Key, types.NewCandidateNode(value), ctx)
+		if err != nil {
+			return err
+		}
+		for _, k := range keyResults {
+			keys = append(keys, k.Value)
+		}
+	}
+
+	for _, k := range keys {
+		key, ok := k.(string)
+		if !ok {
+			return fmt.Errorf("cannot index %T with %T", value, k)
+		}
+		fieldValue, err := accessField(value, key)
+		if err != nil {
+			return err
+		}
+
+		bound := ctx
+		if field.KeyVar != "" {
+			bound = ctx.Clone()
+			bound.Variables[field.KeyVar] = fieldValue
+		}
+
+		next := func(c *types.Context) error {
+			return bindFields(fields[1:], value, c, body)
+		}
+		if field.Value == nil {
+			err = next(bound)
+		} else {
+			err = bindPattern(field.Value, fieldValue, bound, next)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patternVars lists the variables a pattern binds.
+func patternVars(pattern *parser.Pattern) []string {
+	if pattern.Var != "" {
+		return []string{pattern.Var}
+	}
+
+	var names []string
+	for _, elem := range pattern.Elements {
+		names = append(names, patternVars(elem)...)
+	}
+	for _, field := range pattern.Fields {
+		if field.KeyVar != "" {
+			names = append(names, field.KeyVar)
+		}
+		if field.Value != nil {
+			names = append(names, patternVars(field.Value)...)
+		}
+	}
+	return names
+}
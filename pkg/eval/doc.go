@@ -28,18 +28,28 @@
 //   - tier1_select_test.go: select, comparison operators, boolean operators
 //   - tier1_arithmetic_test.go: Arithmetic (+, -, *, /, %), add function
 //   - tier1_construction_test.go: Object and array construction
-//   - tier1_assignment_test.go: Assignment (=, |=, +=), delete
+//   - tier1_assignment_test.go: Assignment (=, |=), arithmetic updates (+=, -=, *=, /=, %=, //=), delete
 //   - tier1_functions_test.go: length, keys, has, type, default (//), empty
 //   - tier1_array_test.go: map, sort, unique, group_by, reverse, flatten, first/last, min/max
-//   - tier1_string_test.go: Case conversion, trimming, split/join, contains/startswith/endswith, interpolation
+//   - tier1_string_test.go: Case conversion, trimming, split/join, contains/startswith/endswith, interpolation, code points (explode/implode)
 //
 // ## Tier 2 - Important (next 8% of use cases)
 //
-//   - tier2_regex_test.go: test, match, capture, sub, gsub
+//   - tier2_regex_test.go: test, match, capture, sub, gsub, scan, split/2, splits, regex flags
 //   - tier2_object_test.go: to_entries, from_entries, with_entries, map_values
-//   - tier2_conditionals_test.go: if-then-else, variables, recursive descent, reduce
+//   - tier2_conditionals_test.go: if-then-else, variables, destructuring, recursive descent, .. |= f, walk, reduce, foreach
+//   - tier2_label_test.go: label/break early exit
+//   - tier2_generators_test.go: range, limit, first(f), repeat, while, until, recurse
 //   - tier2_path_test.go: path, getpath, setpath, delpaths, contains/inside
-//   - tier2_error_test.go: try-catch, optional access (?), error function
+//   - tier2_error_test.go: try-catch, optional access (?), error function, error values, $__loc__, halt and halt_error
+//   - tier2_def_test.go: User-defined functions (def), filter and value parameters
+//   - tier2_env_test.go: $ENV, env, strenv, envsubst
+//   - tier2_input_test.go: input, inputs, multiple documents, $__doc, document_index, $ARGS and named arguments, merging documents
+//   - tier2_format_test.go: @text, @json, @html, @uri, @csv, @tsv, @sh, @base64, @base64d, @base32, @base32d, @huml
+//   - tier2_codec_test.go: tojson/fromjson, tohuml/fromhuml, toyaml/fromyaml
+//   - tier2_date_test.go: now, todate/fromdate, strftime/strptime, mktime/gmtime, dateadd/datesub
+//   - tier2_math_test.go: Math builtins, nan/infinite, string division and modulo
+//   - tier2_search_test.go: any/all, isvalid, indices/index/rindex, IN, INDEX, JOIN
 //
 // ## CLI Tests (cmd package)
 //
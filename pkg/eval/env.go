@@ -0,0 +1,225 @@
+package eval
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// envObject returns the process environment as an object, for $ENV and env.
+func envObject() map[string]any {
+	env := make(map[string]any)
+	for _, kv := range os.Environ() {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// evalEnv evaluates env: the environment object, once per input.
+func evalEnv(ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for range ctx.MatchingNodes {
+		results = append(results, types.NewCandidateNode(envObject()))
+	}
+	return results, nil
+}
+
+// evalStrenv evaluates strenv(NAME), the value of an environment variable
+// as a string (empty if unset). NAME may be a bare name, as in yq, or an
+// expression producing the name.
+func evalStrenv(arg parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	if call, ok := arg.(*parser.FunctionCallNode); ok && len(call.Args) == 0 {
+		if _, defined := ctx.GetFunction(call.Name, 0); !defined {
+			return []*types.CandidateNode{types.NewCandidateNode(os.Getenv(call.Name))}, nil
+		}
+	}
+
+	names, err := evaluate(arg, ctx)
+	if err != nil {
+		return nil, err
+	}
+	var results []*types.CandidateNode
+	for _, name := range names {
+		s, ok := name.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("strenv requires a variable name, got %T", name.Value)
+		}
+		results = append(results, types.NewCandidateNode(os.Getenv(s)))
+	}
+	return results, nil
+}
+
+// envsubstOptions controls how envsubst treats missing values.
+type envsubstOptions struct {
+	noUnset bool // nu: fail on unset variables without a default
+	noEmpty bool // ne: fail on empty variables without a default
+	keep    bool // keep: leave references to unset variables as written
+}
+
+// evalEnvsubst evaluates envsubst and envsubst(OPTIONS), expanding ${VAR},
+// ${VAR:-default} and ${VAR-default} in the input's string values.
+// OPTIONS are bare names separated by commas: nu, ne and keep.
+func evalEnvsubst(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var opts envsubstOptions
+	for _, arg := range args {
+		if err := parseEnvsubstOptions(arg, &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		value, err := envsubstValue(node.Value, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(value))
+	}
+	return results, nil
+}
+
+func parseEnvsubstOptions(arg parser.ExpressionNode, opts *envsubstOptions) error {
+	var name string
+	switch n := arg.(type) {
+	case *parser.CommaNode:
+		for _, expr := range n.Expressions {
+			if err := parseEnvsubstOptions(expr, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parser.FunctionCallNode:
+		if len(n.Args) == 0 {
+			name = n.Name
+		}
+	case *parser.LiteralNode:
+		name, _ = n.Value.(string)
+	}
+
+	switch name {
+	case "nu":
+		opts.noUnset = true
+	case "ne":
+		opts.noEmpty = true
+	case "keep":
+		opts.keep = true
+	default:
+		return fmt.Errorf("envsubst options must be nu, ne or keep")
+	}
+	return nil
+}
+
+// envsubstValue expands strings, and the strings inside arrays and objects.
+func envsubstValue(value any, opts envsubstOptions) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return expandEnv(v, opts)
+	case []any:
+		result := make([]any, len(v))
+		for i, elem := range v {
+			expanded, err := envsubstValue(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = expanded
+		}
+		return result, nil
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, elem := range v {
+			expanded, err := envsubstValue(elem, opts)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = expanded
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// expandEnv replaces ${...} references in s. $${ is an escaped ${.
+func expandEnv(s string, opts envsubstOptions) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			sb.WriteString("${")
+			i += 3
+			continue
+		case !strings.HasPrefix(s[i:], "${"):
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			// Unterminated reference: keep the rest as it is
+			sb.WriteString(s[i:])
+			break
+		}
+		ref := s[i : i+end+1]
+
+		value, ok, err := lookupEnvRef(ref[2:len(ref)-1], opts)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			sb.WriteString(value)
+		} else {
+			sb.WriteString(ref)
+		}
+		i += end + 1
+	}
+	return sb.String(), nil
+}
+
+// lookupEnvRef resolves the inside of a ${...} reference. It returns
+// ok=false if the reference should be left as written.
+func lookupEnvRef(ref string, opts envsubstOptions) (string, bool, error) {
+	nameEnd := 0
+	for nameEnd < len(ref) && isEnvNameChar(ref[nameEnd]) {
+		nameEnd++
+	}
+	name, rest := ref[:nameEnd], ref[nameEnd:]
+	if name == "" {
+		return "", false, fmt.Errorf("invalid variable reference ${%s}", ref)
+	}
+
+	var def string
+	var hasDefault, defaultIfEmpty bool
+	switch {
+	case rest == "":
+	case strings.HasPrefix(rest, ":-"):
+		def, hasDefault, defaultIfEmpty = rest[2:], true, true
+	case strings.HasPrefix(rest, "-"):
+		def, hasDefault = rest[1:], true
+	default:
+		return "", false, fmt.Errorf("invalid variable reference ${%s}", ref)
+	}
+
+	value, set := os.LookupEnv(name)
+	switch {
+	case set && value != "":
+		return value, true, nil
+	case hasDefault && (!set || defaultIfEmpty):
+		return def, true, nil
+	case !set && opts.noUnset:
+		return "", false, fmt.Errorf("variable %s not set", name)
+	case !set && opts.keep:
+		return "", false, nil
+	case set && opts.noEmpty:
+		return "", false, fmt.Errorf("variable %s set but empty", name)
+	}
+	return value, true, nil
+}
+
+func isEnvNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
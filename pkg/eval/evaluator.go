@@ -1,11 +1,14 @@
 package eval
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/rhnvrm/hq/pkg/parser"
 	"github.com/rhnvrm/hq/pkg/types"
@@ -25,31 +28,11 @@ func sortedKeys(m map[string]any) []string {
 // Evaluate evaluates an hq expression against input data.
 // Returns a slice of results (multiple outputs for iterators/commas).
 func Evaluate(expr string, input any) ([]any, error) {
-	// Parse the expression
-	ast, err := parser.Parse(expr)
-	if err != nil {
-		return nil, fmt.Errorf("parse error: %w", err)
-	}
-
-	// Create evaluation context
-	ctx := types.NewContext(input)
-
-	// Evaluate the AST
-	results, err := evaluate(ast, ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	// Extract values from CandidateNodes
-	values := make([]any, len(results))
-	for i, node := range results {
-		values[i] = node.Value
-	}
-
-	return values, nil
+	return EvaluateDocuments(expr, []any{input}, Options{})
 }
 
 // evaluate recursively evaluates an AST node.
+// Generator nodes are streamed through evaluateEach and collected.
 func evaluate(node parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	switch n := node.(type) {
 	case *parser.IdentityNode:
@@ -71,10 +54,10 @@ func evaluate(node parser.ExpressionNode, ctx *types.Context) ([]*types.Candidat
 		return evalIterator(n, ctx)
 
 	case *parser.PipeNode:
-		return evalPipe(n, ctx)
+		return collect(n, ctx)
 
 	case *parser.CommaNode:
-		return evalComma(n, ctx)
+		return collect(n, ctx)
 
 	case *parser.BinaryOpNode:
 		return evalBinaryOp(n, ctx)
@@ -98,10 +81,10 @@ func evaluate(node parser.ExpressionNode, ctx *types.Context) ([]*types.Candidat
 		return evalAlternative(n, ctx)
 
 	case *parser.ConditionalNode:
-		return evalConditional(n, ctx)
+		return collect(n, ctx)
 
 	case *parser.VariableBindNode:
-		return evalVariableBind(n, ctx)
+		return collect(n, ctx)
 
 	case *parser.RecursiveDescentNode:
 		return evalRecursiveDescent(n, ctx)
@@ -115,23 +98,95 @@ func evaluate(node parser.ExpressionNode, ctx *types.Context) ([]*types.Candidat
 	case *parser.StringInterpolationNode:
 		return evalStringInterpolation(n, ctx)
 
+	case *parser.FormatNode:
+		return evalFormat(n, ctx)
+
 	case *parser.AssignNode:
 		return evalAssign(n, ctx)
 
 	case *parser.ReduceNode:
 		return evalReduce(n, ctx)
 
+	case *parser.ForeachNode:
+		return collect(n, ctx)
+
 	case *parser.DynamicIndexNode:
 		return evalDynamicIndex(n, ctx)
 
 	case *parser.DestructureBindNode:
-		return evalDestructureBind(n, ctx)
+		return collect(n, ctx)
+
+	case *parser.FunctionDefNode:
+		return collect(n, ctx)
+
+	case *parser.LabelNode:
+		return collect(n, ctx)
+
+	case *parser.BreakNode:
+		return evalBreak(n, ctx)
 
 	default:
 		return nil, fmt.Errorf("unimplemented expression type: %T", node)
 	}
 }
 
+// evaluateEach evaluates an AST node and passes each output to emit as soon
+// as it is produced. Pipes, commas, bindings, conditionals, labels, foreach,
+// user functions and generator builtins are evaluated lazily, so a consumer
+// that has seen enough outputs can stop the producer by returning a break
+// signal from emit. Other nodes are evaluated eagerly and their outputs
+// emitted in order; on a break, the outputs produced before it are emitted
+// before the signal is passed on.
+func evaluateEach(node parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	switch n := node.(type) {
+	case *parser.PipeNode:
+		return evalPipe(n, ctx, emit)
+	case *parser.CommaNode:
+		return evalComma(n, ctx, emit)
+	case *parser.VariableBindNode:
+		return evalVariableBind(n, ctx, emit)
+	case *parser.DestructureBindNode:
+		return evalDestructureBind(n, ctx, emit)
+	case *parser.ConditionalNode:
+		return evalConditional(n, ctx, emit)
+	case *parser.LabelNode:
+		return evalLabel(n, ctx, emit)
+	case *parser.ForeachNode:
+		return evalForeach(n, ctx, emit)
+	case *parser.FunctionDefNode:
+		return evalFunctionDef(n, ctx, emit)
+	case *parser.FunctionCallNode:
+		if fn, ok := ctx.GetFunction(n.Name, len(n.Args)); ok {
+			return callUserFunction(fn, n.Args, ctx, emit)
+		}
+		if isGeneratorCall(n) {
+			return evalGeneratorCall(n, ctx, emit)
+		}
+	}
+
+	results, err := evaluate(node, ctx)
+	for _, result := range results {
+		if emitErr := emit(result); emitErr != nil {
+			return emitErr
+		}
+	}
+	return err
+}
+
+// collect evaluates a node with evaluateEach and gathers its outputs.
+// On a break, the outputs produced before it are returned alongside it.
+func collect(node parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	err := evaluateEach(node, ctx, func(result *types.CandidateNode) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil && !isBreak(err) {
+		return nil, err
+	}
+	return results, err
+}
+
 // evalIdentity returns the current matching nodes unchanged.
 func evalIdentity(ctx *types.Context) ([]*types.CandidateNode, error) {
 	return ctx.MatchingNodes, nil
@@ -342,7 +397,7 @@ func sliceValue(value any, start, end *int) any {
 		return v[s:e]
 
 	case string:
-		length := len(v)
+		length := utf8.RuneCountInString(v)
 		s, e := resolveSliceBounds(start, end, length)
 		if s >= e || s >= length || e < 0 {
 			return ""
@@ -353,7 +408,7 @@ func sliceValue(value any, start, end *int) any {
 		if e > length {
 			e = length
 		}
-		return v[s:e]
+		return sliceString(v, s, e)
 
 	default:
 		return nil
@@ -441,45 +496,24 @@ func iterateValue(node *types.CandidateNode) ([]*types.CandidateNode, error) {
 }
 
 // evalPipe evaluates the pipe operator (left | right).
-func evalPipe(n *parser.PipeNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate left side
-	leftResults, err := evaluate(n.Left, ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	// For each left result, evaluate right side and collect
-	var results []*types.CandidateNode
-	for _, leftNode := range leftResults {
+// Each left output flows through the right side as soon as it is produced.
+func evalPipe(n *parser.PipeNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	return evaluateEach(n.Left, ctx, func(leftNode *types.CandidateNode) error {
 		// Create new context with this single node
 		newCtx := ctx.Clone()
 		newCtx.SetMatchingNodes([]*types.CandidateNode{leftNode})
-
-		// Evaluate right side
-		rightResults, err := evaluate(n.Right, newCtx)
-		if err != nil {
-			return nil, err
-		}
-
-		results = append(results, rightResults...)
-	}
-
-	return results, nil
+		return evaluateEach(n.Right, newCtx, emit)
+	})
 }
 
 // evalComma evaluates the comma operator (a, b).
-func evalComma(n *parser.CommaNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	var results []*types.CandidateNode
-
+func evalComma(n *parser.CommaNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
 	for _, expr := range n.Expressions {
-		exprResults, err := evaluate(expr, ctx)
-		if err != nil {
-			return nil, err
+		if err := evaluateEach(expr, ctx, emit); err != nil {
+			return err
 		}
-		results = append(results, exprResults...)
 	}
-
-	return results, nil
+	return nil
 }
 
 // evalBinaryOp evaluates binary operators (+, -, *, /, ==, etc.).
@@ -693,6 +727,7 @@ func deepMerge(base, overlay map[string]any) map[string]any {
 	return result
 }
 
+// divide divides numbers and, as in jq, splits a string by another string.
 func divide(left, right any) (any, error) {
 	ln, lok := toNumber(left)
 	rn, rok := toNumber(right)
@@ -702,26 +737,65 @@ func divide(left, right any) (any, error) {
 		}
 		return ln / rn, nil
 	}
+	if ls, ok := left.(string); ok {
+		if rs, ok := right.(string); ok {
+			return splitString(ls, rs), nil
+		}
+	}
 	return nil, fmt.Errorf("cannot divide %T by %T", left, right)
 }
 
+// splitString splits s by sep; an empty string has no parts.
+func splitString(s, sep string) []any {
+	if s == "" {
+		return []any{}
+	}
+	parts := strings.Split(s, sep)
+	result := make([]any, len(parts))
+	for i, p := range parts {
+		result[i] = p
+	}
+	return result
+}
+
+// modulo truncates both operands to integers, as jq does. The result has
+// the sign of the dividend, and NaN operands give NaN.
 func modulo(left, right any) (any, error) {
 	ln, lok := toNumber(left)
 	rn, rok := toNumber(right)
 	if lok && rok {
-		if rn == 0 {
+		if math.IsNaN(ln) || math.IsNaN(rn) {
+			return math.NaN(), nil
+		}
+		d := truncateToInt(rn)
+		if d == 0 {
 			return nil, fmt.Errorf("modulo by zero")
 		}
-		return float64(int64(ln) % int64(rn)), nil
+		// Avoid overflow of MinInt64 % -1
+		if d == -1 {
+			return 0.0, nil
+		}
+		return float64(truncateToInt(ln) % d), nil
 	}
 	return nil, fmt.Errorf("cannot modulo %T by %T", left, right)
 }
 
+// truncateToInt truncates x toward zero, clamping it to the int64 range.
+func truncateToInt(x float64) int64 {
+	switch {
+	case x >= math.MaxInt64:
+		return math.MaxInt64
+	case x <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(x)
+}
+
 func lessThan(left, right any) (bool, error) {
 	ln, lok := toNumber(left)
 	rn, rok := toNumber(right)
 	if lok && rok {
-		return ln < rn, nil
+		return compareNumbers(ln, rn) < 0, nil
 	}
 	if ls, ok := left.(string); ok {
 		if rs, ok := right.(string); ok {
@@ -735,7 +809,7 @@ func greaterThan(left, right any) (bool, error) {
 	ln, lok := toNumber(left)
 	rn, rok := toNumber(right)
 	if lok && rok {
-		return ln > rn, nil
+		return compareNumbers(ln, rn) > 0, nil
 	}
 	if ls, ok := left.(string); ok {
 		if rs, ok := right.(string); ok {
@@ -791,6 +865,29 @@ func equals(left, right any) bool {
 		if r, ok := right.(bool); ok {
 			return l == r
 		}
+	case []any:
+		r, ok := right.([]any)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !equals(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		r, ok := right.(map[string]any)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for k, lv := range l {
+			rv, ok := r[k]
+			if !ok || !equals(lv, rv) {
+				return false
+			}
+		}
+		return true
 	}
 
 	return false
@@ -811,7 +908,7 @@ func isTruthy(v any) bool {
 // It suppresses errors and returns empty instead of errors/null.
 func evalOptional(n *parser.OptionalNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	results, err := evaluate(n.Expr, ctx)
-	if err != nil {
+	if err != nil && !isBreak(err) {
 		// Suppress errors - return empty
 		return []*types.CandidateNode{}, nil
 	}
@@ -824,25 +921,40 @@ func evalOptional(n *parser.OptionalNode, ctx *types.Context) ([]*types.Candidat
 		}
 	}
 
-	return filtered, nil
+	return filtered, err
 }
 
-// evalTryCatch evaluates try-catch for error handling.
+// evalTryCatch evaluates try BODY catch HANDLER for each input. Outputs of
+// BODY produced before an error are kept, and HANDLER receives the error's
+// value: what was given to error, or the message of any other error.
 func evalTryCatch(n *parser.TryCatchNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Try to evaluate the try expression
-	results, err := evaluate(n.Try, ctx)
-	if err == nil {
-		// Success - return results
-		return results, nil
-	}
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+		err := evaluateEach(n.Try, nodeCtx, func(result *types.CandidateNode) error {
+			results = append(results, result)
+			return nil
+		})
+		if err == nil {
+			continue
+		}
 
-	// Error occurred - evaluate catch if present
-	if n.Catch != nil {
-		return evaluate(n.Catch, ctx)
-	}
+		// break is control flow, not an error - it passes through try
+		if isBreak(err) {
+			return results, err
+		}
 
-	// No catch - return empty
-	return []*types.CandidateNode{}, nil
+		// Without a handler the error is dropped
+		if n.Catch != nil {
+			caught, err := applyTo(n.Catch, types.NewCandidateNode(errorValue(err)), ctx)
+			results = append(results, caught...)
+			if err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, nil
 }
 
 // evalReduce evaluates reduce EXPR as $VAR (INIT; UPDATE)
@@ -864,82 +976,152 @@ func evalReduce(n *parser.ReduceNode, ctx *types.Context) ([]*types.CandidateNod
 		// Start with initial accumulator value
 		accumulator := initResults[0].Value
 
-		// Evaluate the iterator expression to get all values
-		iterResults, err := evaluate(n.Expr, nodeCtx)
+		// Fold each value from the iterator into the accumulator as it is produced
+		// A break unwinds the whole reduce: only already finished results survive
+		err = evaluateEach(n.Expr, nodeCtx, func(iterVal *types.CandidateNode) error {
+			// Evaluate the update with:
+			// - current input is the accumulator
+			// - the pattern's variables bound from the current element
+			return bindPatterns(n.Patterns, iterVal.Value, ctx, func(bound *types.Context) error {
+				updateCtx := bound.Clone()
+				updateCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(accumulator)}
+				updateResults, err := evaluate(n.Update, updateCtx)
+				if err != nil {
+					return err
+				}
+				if len(updateResults) > 0 {
+					accumulator = updateResults[0].Value
+				}
+				return nil
+			})
+		})
 		if err != nil {
+			if isBreak(err) {
+				return results, err
+			}
 			return nil, err
 		}
 
-		// For each value from the iterator, update the accumulator
-		for _, iterVal := range iterResults {
-			// Create context with:
-			// - current input is the accumulator
-			// - variable $VAR is set to current element
-			updateCtx := ctx.Clone()
-			updateCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(accumulator)}
-			updateCtx.Variables[n.VarName] = iterVal.Value
+		results = append(results, types.NewCandidateNode(accumulator))
+	}
+
+	return results, nil
+}
+
+// evalForeach evaluates foreach EXPR as $VAR (INIT; UPDATE; EXTRACT).
+// The state is threaded like reduce, but every intermediate state is emitted,
+// passed through EXTRACT (with $VAR still bound) when one is given.
+func evalForeach(n *parser.ForeachNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.MatchingNodes = []*types.CandidateNode{node}
+
+		// Evaluate init expression; each init value starts a separate run
+		initResults, err := evaluate(n.Init, nodeCtx)
+		if err != nil {
+			return err
+		}
+
+		for _, initResult := range initResults {
+			state := initResult.Value
+
+			err := evaluateEach(n.Expr, nodeCtx, func(iterVal *types.CandidateNode) error {
+				return bindPatterns(n.Patterns, iterVal.Value, ctx, func(bound *types.Context) error {
+					updateCtx := bound.Clone()
+					updateCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(state)}
+
+					// Every update output is emitted; the last one becomes the new state
+					return evaluateEach(n.Update, updateCtx, func(updated *types.CandidateNode) error {
+						state = updated.Value
 
-			// Evaluate update expression
-			updateResults, err := evaluate(n.Update, updateCtx)
+						if n.Extract == nil {
+							return emit(types.NewCandidateNode(state))
+						}
+
+						extractCtx := bound.Clone()
+						extractCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(state)}
+						return evaluateEach(n.Extract, extractCtx, emit)
+					})
+				})
+			})
 			if err != nil {
-				return nil, err
-			}
-			if len(updateResults) > 0 {
-				accumulator = updateResults[0].Value
+				return err
 			}
 		}
-
-		results = append(results, types.NewCandidateNode(accumulator))
 	}
 
-	return results, nil
+	return nil
 }
 
-// evalStringInterpolation evaluates a string with embedded expressions.
-// e.g., "Hello, \(.name)!" evaluates .name and inserts the result into the string.
+// evalStringInterpolation evaluates a string with \(...) parts. As in jq, each
+// combination of the parts' outputs produces its own string, the first part
+// varying fastest, and a part with no outputs produces no string.
 func evalStringInterpolation(n *parser.StringInterpolationNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// For each input, build the interpolated string
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		var sb strings.Builder
 		nodeCtx := ctx.Clone()
 		nodeCtx.MatchingNodes = []*types.CandidateNode{node}
 
+		strs := []string{""}
 		for _, part := range n.Parts {
 			if part.Expr == nil {
-				// Literal part
-				sb.WriteString(part.Literal)
-			} else {
-				// Expression part - evaluate and convert to string
-				exprResults, err := evaluate(part.Expr, nodeCtx)
-				if err != nil {
-					return nil, err
+				for i := range strs {
+					strs[i] += part.Literal
+				}
+				continue
+			}
+
+			exprResults, err := evaluate(part.Expr, nodeCtx)
+			if err != nil {
+				return nil, err
+			}
+			next := make([]string, 0, len(strs)*len(exprResults))
+			for _, r := range exprResults {
+				s := interpolateToString(r.Value)
+				if n.Format != "" {
+					s, err = applyFormat(n.Format, r.Value)
+					if err != nil {
+						return nil, err
+					}
 				}
-				// Use first result (jq behavior)
-				if len(exprResults) > 0 {
-					sb.WriteString(interpolateToString(exprResults[0].Value))
+				for _, prefix := range strs {
+					next = append(next, prefix+s)
 				}
 			}
+			strs = next
+		}
+
+		for _, s := range strs {
+			results = append(results, types.NewCandidateNode(s))
 		}
-		results = append(results, types.NewCandidateNode(sb.String()))
 	}
 
 	return results, nil
 }
 
 // evalAssign evaluates assignment expressions (.foo = value, .foo |= expr, etc.)
+// The left side is evaluated in path mode against the input, and each location
+// it refers to is updated in turn.
 func evalAssign(n *parser.AssignNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		// Deep copy the input value to avoid modifying the original
-		modified := deepCopy(node.Value)
+		paths, err := pathsOf(n.Path, node, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("invalid assignment path: %w", err)
+		}
 
-		// Check for iterator path (e.g., .[] |= expr)
-		if isIteratorPath(n.Path) {
-			var err error
-			modified, err = evalIteratorAssign(n, modified, ctx)
+		if n.Op == "|=" {
+			// Update: the first output of the value with the current path value as
+			// input replaces it; a path for which the value is empty is deleted
+			modified, err := updatePaths(node.Value, paths, func(current any) (any, bool, error) {
+				valueResults, err := applyTo(n.Value, types.NewCandidateNode(current), ctx)
+				if err != nil || len(valueResults) == 0 {
+					return nil, false, err
+				}
+				return valueResults[0].Value, true, nil
+			})
 			if err != nil {
 				return nil, err
 			}
@@ -947,420 +1129,123 @@ func evalAssign(n *parser.AssignNode, ctx *types.Context) ([]*types.CandidateNod
 			continue
 		}
 
-		// Extract path from the left side (with context for dynamic indices)
-		pathCtx := ctx.Clone()
-		pathCtx.SetMatchingNodes([]*types.CandidateNode{node})
-		path, err := extractPathWithContext(n.Path, pathCtx)
-		if err != nil {
-			return nil, fmt.Errorf("invalid assignment path: %w", err)
+		combine, ok := assignOperators[n.Op]
+		if !ok {
+			return nil, fmt.Errorf("unsupported assignment operator: %s", n.Op)
 		}
 
-		// Evaluate the right side value
+		// The right side is evaluated against the input, and each of its
+		// outputs produces a separate result
 		nodeCtx := ctx.Clone()
-
-		switch n.Op {
-		case "=":
-			// Simple assignment: evaluate value in original context
-			nodeCtx.MatchingNodes = []*types.CandidateNode{node}
-			valueResults, err := evaluate(n.Value, nodeCtx)
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+		err = evaluateEach(n.Value, nodeCtx, func(rhs *types.CandidateNode) error {
+			modified, err := updatePaths(node.Value, paths, func(current any) (any, bool, error) {
+				newValue, err := combine(current, rhs.Value)
+				return newValue, true, err
+			})
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if len(valueResults) == 0 {
-				continue
+			results = append(results, types.NewCandidateNode(modified))
+			return nil
+		})
+		if err != nil {
+			if isBreak(err) {
+				return results, err
 			}
-			newValue := valueResults[0].Value
+			return nil, err
+		}
+	}
 
-			// Set the value at path
-			modified, err = setPath(modified, path, newValue)
-			if err != nil {
-				return nil, err
-			}
+	return results, nil
+}
 
-		case "|=":
-			// Update: evaluate value with current path value as input
-			currentValue, err := getPath(modified, path)
-			if err != nil {
-				// Path doesn't exist - use null
-				currentValue = nil
-			}
-			nodeCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(currentValue)}
-			valueResults, err := evaluate(n.Value, nodeCtx)
-			if err != nil {
-				return nil, err
-			}
-			if len(valueResults) == 0 {
-				continue
-			}
-			newValue := valueResults[0].Value
+// assignOperators maps each assignment operator other than |= to how it
+// combines the current value at a path with a value of the right side.
+var assignOperators = map[string]func(current, rhs any) (any, error){
+	"=":  func(_, rhs any) (any, error) { return rhs, nil },
+	"+=": addValues,
+	"-=": subtractValues,
+	"*=": multiplyValues,
+	"/=": divide,
+	"%=": modulo,
+	"//=": func(current, rhs any) (any, error) {
+		if isTruthy(current) {
+			return current, nil
+		}
+		return rhs, nil
+	},
+}
 
-			modified, err = setPath(modified, path, newValue)
-			if err != nil {
-				return nil, err
+// getPath gets a value at a path.
+// Missing keys, out-of-range indices and null containers yield null; indexing
+// any other scalar is an error.
+func getPath(value any, path []any) (any, error) {
+	current := value
+	for _, p := range path {
+		if current == nil {
+			return nil, nil
+		}
+		switch key := normalizePathElement(p).(type) {
+		case string:
+			m, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot index %T with string", current)
 			}
-
-		case "+=":
-			// Add-assign: get current, add value, set result
-			currentValue, err := getPath(modified, path)
-			if err != nil {
-				currentValue = nil
+			current = m[key]
+		case int:
+			arr, ok := current.([]any)
+			if !ok {
+				return nil, fmt.Errorf("cannot index %T with int", current)
 			}
-			nodeCtx.MatchingNodes = []*types.CandidateNode{node}
-			valueResults, err := evaluate(n.Value, nodeCtx)
-			if err != nil {
-				return nil, err
+			if key < 0 {
+				key = len(arr) + key
 			}
-			if len(valueResults) == 0 {
-				continue
+			if key < 0 || key >= len(arr) {
+				return nil, nil
 			}
-			addValue := valueResults[0].Value
-
-			// Perform addition
-			newValue, err := addValues(currentValue, addValue)
+			current = arr[key]
+		case map[string]any:
+			var err error
+			current, err = getSlicePath(current, key)
 			if err != nil {
 				return nil, err
 			}
+		default:
+			return nil, fmt.Errorf("invalid path element type: %T", p)
+		}
+	}
+	return current, nil
+}
 
-			modified, err = setPath(modified, path, newValue)
-			if err != nil {
-				return nil, err
-			}
+// setPath sets a value at a path, creating intermediate objects/arrays as needed
+func setPath(value any, path []any, newValue any) (any, error) {
+	if len(path) == 0 {
+		return newValue, nil
+	}
 
-		case "-=":
-			// Subtract-assign: get current, subtract value, set result
-			currentValue, err := getPath(modified, path)
-			if err != nil {
-				currentValue = nil
-			}
-			nodeCtx.MatchingNodes = []*types.CandidateNode{node}
-			valueResults, err := evaluate(n.Value, nodeCtx)
-			if err != nil {
-				return nil, err
-			}
-			if len(valueResults) == 0 {
-				continue
-			}
-			subValue := valueResults[0].Value
+	// Ensure we have a container at the root
+	if value == nil {
+		// Create appropriate container based on first path element
+		switch normalizePathElement(path[0]).(type) {
+		case string:
+			value = make(map[string]any)
+		case int, map[string]any:
+			value = make([]any, 0)
+		}
+	}
 
-			// Perform subtraction
-			newValue, err := subtractValues(currentValue, subValue)
-			if err != nil {
-				return nil, err
-			}
+	// Set recursively
+	return setPathRecursive(value, path, newValue)
+}
 
-			modified, err = setPath(modified, path, newValue)
-			if err != nil {
-				return nil, err
-			}
+func setPathRecursive(value any, path []any, newValue any) (any, error) {
+	if len(path) == 0 {
+		return newValue, nil
+	}
 
-		case "*=":
-			// Multiply-assign: get current, multiply by value, set result
-			currentValue, err := getPath(modified, path)
-			if err != nil {
-				currentValue = nil
-			}
-			nodeCtx.MatchingNodes = []*types.CandidateNode{node}
-			valueResults, err := evaluate(n.Value, nodeCtx)
-			if err != nil {
-				return nil, err
-			}
-			if len(valueResults) == 0 {
-				continue
-			}
-			mulValue := valueResults[0].Value
-
-			// Perform multiplication
-			newValue, err := multiplyValues(currentValue, mulValue)
-			if err != nil {
-				return nil, err
-			}
-
-			modified, err = setPath(modified, path, newValue)
-			if err != nil {
-				return nil, err
-			}
-
-		default:
-			return nil, fmt.Errorf("unsupported assignment operator: %s", n.Op)
-		}
-
-		results = append(results, types.NewCandidateNode(modified))
-	}
-
-	return results, nil
-}
-
-// isIteratorPath checks if the path expression contains an iterator (.[] or .foo[])
-func isIteratorPath(expr parser.ExpressionNode) bool {
-	switch n := expr.(type) {
-	case *parser.IteratorNode:
-		return true
-	case *parser.FieldAccessNode:
-		if n.From != nil {
-			return isIteratorPath(n.From)
-		}
-		return false
-	case *parser.IndexAccessNode:
-		if n.From != nil {
-			return isIteratorPath(n.From)
-		}
-		return false
-	default:
-		return false
-	}
-}
-
-// evalIteratorAssign handles assignment with iterator paths like .[] |= expr
-func evalIteratorAssign(n *parser.AssignNode, value any, ctx *types.Context) (any, error) {
-	// Get the path prefix (before the iterator) and the iterator expression
-	prefix, iterExpr := splitIteratorPath(n.Path)
-
-	// Navigate to the array/object at the prefix path
-	var container any
-	var err error
-	if len(prefix) > 0 {
-		container, err = getPath(value, prefix)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		container = value
-	}
-
-	// Apply the update to each element
-	switch c := container.(type) {
-	case []any:
-		newArr := make([]any, len(c))
-		for i, elem := range c {
-			newElem, err := applyIteratorUpdate(n, elem, iterExpr, ctx)
-			if err != nil {
-				return nil, err
-			}
-			newArr[i] = newElem
-		}
-		if len(prefix) > 0 {
-			return setPath(value, prefix, newArr)
-		}
-		return newArr, nil
-
-	case map[string]any:
-		newMap := make(map[string]any, len(c))
-		for k, elem := range c {
-			newElem, err := applyIteratorUpdate(n, elem, iterExpr, ctx)
-			if err != nil {
-				return nil, err
-			}
-			newMap[k] = newElem
-		}
-		if len(prefix) > 0 {
-			return setPath(value, prefix, newMap)
-		}
-		return newMap, nil
-
-	default:
-		return nil, fmt.Errorf("cannot iterate over %T", container)
-	}
-}
-
-// splitIteratorPath splits an iterator path into prefix and the iterator itself
-func splitIteratorPath(expr parser.ExpressionNode) ([]any, parser.ExpressionNode) {
-	switch n := expr.(type) {
-	case *parser.IteratorNode:
-		if n.From == nil || isIdentity(n.From) {
-			return nil, n
-		}
-		// Get the path before the iterator
-		path, _ := extractPath(n.From)
-		return path, n
-	case *parser.FieldAccessNode:
-		if isIteratorPath(n.From) {
-			prefix, iter := splitIteratorPath(n.From)
-			return prefix, iter
-		}
-		return nil, expr
-	case *parser.IndexAccessNode:
-		if isIteratorPath(n.From) {
-			prefix, iter := splitIteratorPath(n.From)
-			return prefix, iter
-		}
-		return nil, expr
-	default:
-		return nil, expr
-	}
-}
-
-// isIdentity checks if an expression is the identity node
-func isIdentity(expr parser.ExpressionNode) bool {
-	_, ok := expr.(*parser.IdentityNode)
-	return ok
-}
-
-// applyIteratorUpdate applies an update to a single element during iterator assignment
-func applyIteratorUpdate(n *parser.AssignNode, elem any, iterExpr parser.ExpressionNode, ctx *types.Context) (any, error) {
-	elemCtx := ctx.Clone()
-	elemCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(elem)}
-
-	switch n.Op {
-	case "=":
-		valueResults, err := evaluate(n.Value, elemCtx)
-		if err != nil {
-			return nil, err
-		}
-		if len(valueResults) == 0 {
-			return elem, nil
-		}
-		return valueResults[0].Value, nil
-
-	case "|=":
-		valueResults, err := evaluate(n.Value, elemCtx)
-		if err != nil {
-			return nil, err
-		}
-		if len(valueResults) == 0 {
-			return elem, nil
-		}
-		return valueResults[0].Value, nil
-
-	case "+=":
-		valueResults, err := evaluate(n.Value, elemCtx)
-		if err != nil {
-			return nil, err
-		}
-		if len(valueResults) == 0 {
-			return elem, nil
-		}
-		return addValues(elem, valueResults[0].Value)
-
-	case "-=":
-		valueResults, err := evaluate(n.Value, elemCtx)
-		if err != nil {
-			return nil, err
-		}
-		if len(valueResults) == 0 {
-			return elem, nil
-		}
-		return subtractValues(elem, valueResults[0].Value)
-
-	default:
-		return nil, fmt.Errorf("unsupported iterator assignment operator: %s", n.Op)
-	}
-}
-
-// extractPath extracts a path (sequence of keys/indices) from an expression
-func extractPath(expr parser.ExpressionNode) ([]any, error) {
-	return extractPathWithContext(expr, nil)
-}
-
-// extractPathWithContext extracts a path, evaluating dynamic indices if context is provided
-func extractPathWithContext(expr parser.ExpressionNode, ctx *types.Context) ([]any, error) {
-	var path []any
-
-	current := expr
-	for current != nil {
-		switch n := current.(type) {
-		case *parser.IdentityNode:
-			// Root - stop
-			current = nil
-		case *parser.FieldAccessNode:
-			// Prepend field name to path
-			path = append([]any{n.Field}, path...)
-			current = n.From
-		case *parser.IndexAccessNode:
-			// Prepend index to path
-			path = append([]any{n.Index}, path...)
-			current = n.From
-		case *parser.DynamicIndexNode:
-			// Need context to evaluate the index expression
-			if ctx == nil {
-				return nil, fmt.Errorf("cannot extract path from %T without context", expr)
-			}
-			// Evaluate the index expression
-			indexResults, err := evaluate(n.Index, ctx)
-			if err != nil {
-				return nil, fmt.Errorf("evaluating dynamic index: %w", err)
-			}
-			if len(indexResults) == 0 {
-				return nil, fmt.Errorf("dynamic index expression produced no results")
-			}
-			indexVal := indexResults[0].Value
-			// Convert to path element
-			switch idx := indexVal.(type) {
-			case string:
-				path = append([]any{idx}, path...)
-			case float64:
-				path = append([]any{int(idx)}, path...)
-			case int:
-				path = append([]any{idx}, path...)
-			default:
-				return nil, fmt.Errorf("dynamic index must be string or number, got %T", indexVal)
-			}
-			current = n.From
-		default:
-			return nil, fmt.Errorf("cannot extract path from %T", expr)
-		}
-	}
-
-	return path, nil
-}
-
-// getPath gets a value at a path
-func getPath(value any, path []any) (any, error) {
-	current := value
-	for _, p := range path {
-		switch key := normalizePathElement(p).(type) {
-		case string:
-			m, ok := current.(map[string]any)
-			if !ok {
-				return nil, fmt.Errorf("cannot index %T with string", current)
-			}
-			current = m[key]
-		case int:
-			arr, ok := current.([]any)
-			if !ok {
-				return nil, fmt.Errorf("cannot index %T with int", current)
-			}
-			if key < 0 {
-				key = len(arr) + key
-			}
-			if key < 0 || key >= len(arr) {
-				return nil, fmt.Errorf("index out of bounds")
-			}
-			current = arr[key]
-		default:
-			return nil, fmt.Errorf("invalid path element type: %T", p)
-		}
-	}
-	return current, nil
-}
-
-// setPath sets a value at a path, creating intermediate objects/arrays as needed
-func setPath(value any, path []any, newValue any) (any, error) {
-	if len(path) == 0 {
-		return newValue, nil
-	}
-
-	// Ensure we have a container at the root
-	if value == nil {
-		// Create appropriate container based on first path element
-		switch path[0].(type) {
-		case string:
-			value = make(map[string]any)
-		case int:
-			value = make([]any, 0)
-		}
-	}
-
-	// Set recursively
-	return setPathRecursive(value, path, newValue)
-}
-
-func setPathRecursive(value any, path []any, newValue any) (any, error) {
-	if len(path) == 0 {
-		return newValue, nil
-	}
-
-	key := normalizePathElement(path[0])
-	remainingPath := path[1:]
+	key := normalizePathElement(path[0])
+	remainingPath := path[1:]
 
 	switch k := key.(type) {
 	case string:
@@ -1418,6 +1303,21 @@ func setPathRecursive(value any, path []any, newValue any) (any, error) {
 		}
 		return arr, nil
 
+	case map[string]any:
+		// A slice is replaced as a whole, after updating it for any
+		// remaining path: .[1:3][0] = x changes the first element of the slice
+		if len(remainingPath) > 0 {
+			existing, err := getSlicePath(value, k)
+			if err != nil && value != nil {
+				return nil, err
+			}
+			newValue, err = setPathRecursive(existing, remainingPath, newValue)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return setSlicePath(value, k, newValue)
+
 	default:
 		return nil, fmt.Errorf("invalid path element type: %T", key)
 	}
@@ -1521,158 +1421,51 @@ func normalizePathElement(p any) any {
 	}
 }
 
-// evalDel evaluates del(path) to delete fields/elements
+// evalDel evaluates del(path) to delete fields/elements.
+// The argument is evaluated in path mode and every location it refers to is removed.
 func evalDel(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		modified := deepCopy(node.Value)
-
-		// Delete each specified path
+		var paths [][]any
 		for _, arg := range args {
-			// Flatten comma expressions into individual paths
-			paths := flattenDelPaths(arg)
-
-			for _, pathExpr := range paths {
-				// Check for pipe expression (e.g., del(.[] | select(...)))
-				if pipe, ok := pathExpr.(*parser.PipeNode); ok {
-					var err error
-					modified, err = evalDelPipe(pipe, modified, ctx)
-					if err != nil {
-						// Ignore errors (jq behavior)
-						continue
-					}
-					continue
-				}
-
-				// Check for iterator path (e.g., del(.[]))
-				if isIteratorPath(pathExpr) {
-					var err error
-					modified, err = evalDelIterator(pathExpr, modified, ctx)
-					if err != nil {
-						return nil, err
-					}
-					continue
-				}
-
-				// Regular path deletion
-				path, err := extractPath(pathExpr)
-				if err != nil {
-					return nil, fmt.Errorf("del: invalid path: %w", err)
-				}
-
-				modified, err = deletePath(modified, path)
-				if err != nil {
-					// Ignore errors for non-existent paths (jq behavior)
-					continue
-				}
+			argPaths, err := pathsOf(arg, node, ctx)
+			if err != nil {
+				return nil, fmt.Errorf("del: %w", err)
+			}
+			for _, p := range argPaths {
+				paths = append(paths, p.Path)
 			}
 		}
 
+		modified, err := deletePaths(node.Value, paths)
+		if err != nil {
+			return nil, err
+		}
 		results = append(results, types.NewCandidateNode(modified))
 	}
 
 	return results, nil
 }
 
-// flattenDelPaths flattens comma expressions into individual path expressions
-func flattenDelPaths(expr parser.ExpressionNode) []parser.ExpressionNode {
-	if comma, ok := expr.(*parser.CommaNode); ok {
-		var result []parser.ExpressionNode
-		for _, e := range comma.Expressions {
-			result = append(result, flattenDelPaths(e)...)
-		}
-		return result
-	}
-	return []parser.ExpressionNode{expr}
-}
-
-// evalDelPipe handles del(.[] | select(...)) type expressions
-func evalDelPipe(pipe *parser.PipeNode, value any, ctx *types.Context) (any, error) {
-	// Evaluate the pipe to find which elements match
-	// Then delete them
-	nodeCtx := ctx.Clone()
-	nodeCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(value)}
-
-	// Get the left side (usually .[] or similar)
-	// For simplicity, handle .[] | select(...) pattern
-	if iter, ok := pipe.Left.(*parser.IteratorNode); ok {
-		if iter.From == nil || isIdentity(iter.From) {
-			// Iterate over elements and filter
-			switch v := value.(type) {
-			case []any:
-				var result []any
-				for _, elem := range v {
-					elemCtx := ctx.Clone()
-					elemCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(elem)}
-					// Evaluate the right side (select filter)
-					selected, err := evaluate(pipe.Right, elemCtx)
-					if err != nil {
-						// If error, keep the element
-						result = append(result, elem)
-						continue
-					}
-					// If select returned nothing, element should be deleted
-					// If select returned the element, keep it
-					if len(selected) == 0 {
-						result = append(result, elem)
-					}
-				}
-				return result, nil
-			case map[string]any:
-				result := make(map[string]any)
-				for k, elem := range v {
-					elemCtx := ctx.Clone()
-					elemCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(elem)}
-					selected, err := evaluate(pipe.Right, elemCtx)
-					if err != nil {
-						result[k] = elem
-						continue
-					}
-					if len(selected) == 0 {
-						result[k] = elem
-					}
-				}
-				return result, nil
-			}
-		}
-	}
-
-	return value, nil
-}
+// evalPathExpr evaluates path(expr) to return the path to each value expr matches
+func evalPathExpr(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
 
-// evalDelIterator handles del(.[] | select(...)) type expressions
-func evalDelIterator(expr parser.ExpressionNode, value any, ctx *types.Context) (any, error) {
-	// For simple .[], delete all elements
-	if iter, ok := expr.(*parser.IteratorNode); ok {
-		if iter.From == nil || isIdentity(iter.From) {
-			switch value.(type) {
-			case []any:
-				return []any{}, nil
-			case map[string]any:
-				return map[string]any{}, nil
-			default:
-				return value, nil
+	for _, node := range ctx.MatchingNodes {
+		paths, err := pathsOf(expr, node, ctx)
+		for _, p := range paths {
+			results = append(results, types.NewCandidateNode(pathToArray(p.Path)))
+		}
+		if err != nil {
+			if isBreak(err) {
+				return results, err
 			}
+			return nil, fmt.Errorf("path: %w", err)
 		}
 	}
-	// For more complex iterator expressions, evaluate and filter
-	return value, nil
-}
 
-// evalPathExpr evaluates path(expr) to return the path to matched values
-func evalPathExpr(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Extract the path from the expression
-	path, err := extractPath(expr)
-	if err != nil {
-		return nil, fmt.Errorf("path: %w", err)
-	}
-
-	// Convert path to array format
-	pathArr := make([]any, len(path))
-	copy(pathArr, path)
-
-	return []*types.CandidateNode{types.NewCandidateNode(pathArr)}, nil
+	return results, nil
 }
 
 // evalPaths evaluates paths or paths(filter) to return all paths in the value
@@ -1680,50 +1473,29 @@ func evalPaths(filter parser.ExpressionNode, ctx *types.Context) ([]*types.Candi
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		paths := collectPaths(node.Value, []any{})
+		paths, err := pathsOf(&parser.RecursiveDescentNode{}, node, ctx)
+		if err != nil {
+			return nil, err
+		}
 		for _, p := range paths {
+			// The root itself is not one of the paths
+			if len(p.Path) == 0 {
+				continue
+			}
 			if filter != nil {
-				// Get value at path and check if it passes filter
-				val, _ := getPath(node.Value, p)
-				filterCtx := ctx.Clone()
-				filterCtx.MatchingNodes = []*types.CandidateNode{types.NewCandidateNode(val)}
-				filterResult, err := evaluate(filter, filterCtx)
-				if err != nil || len(filterResult) == 0 || !isTruthy(filterResult[0].Value) {
+				// Check if the value at the path passes the filter
+				ok, err := holdsFor(filter, p, ctx)
+				if err != nil || !ok {
 					continue
 				}
 			}
-			results = append(results, types.NewCandidateNode(p))
+			results = append(results, types.NewCandidateNode(pathToArray(p.Path)))
 		}
 	}
 
 	return results, nil
 }
 
-// collectPaths collects all paths in a structure (including intermediate paths to arrays/objects)
-func collectPaths(value any, prefix []any) [][]any {
-	var paths [][]any
-
-	// Always add the current path if it's non-empty
-	if len(prefix) > 0 {
-		paths = append(paths, prefix)
-	}
-
-	switch v := value.(type) {
-	case map[string]any:
-		for _, k := range sortedKeys(v) {
-			newPrefix := append(append([]any{}, prefix...), k)
-			paths = append(paths, collectPaths(v[k], newPrefix)...)
-		}
-	case []any:
-		for i, val := range v {
-			newPrefix := append(append([]any{}, prefix...), i)
-			paths = append(paths, collectPaths(val, newPrefix)...)
-		}
-	}
-
-	return paths
-}
-
 // evalGetpath evaluates getpath(path) to get value at path
 func evalGetpath(pathExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
@@ -1822,15 +1594,18 @@ func evalDelpaths(pathsExpr parser.ExpressionNode, ctx *types.Context) ([]*types
 			return nil, fmt.Errorf("delpaths: paths must be an array of arrays")
 		}
 
-		modified := deepCopy(node.Value)
-
-		// Delete each path (in reverse order to handle array indices correctly)
-		for i := len(pathsArr) - 1; i >= 0; i-- {
-			pathArr, ok := pathsArr[i].([]any)
+		paths := make([][]any, 0, len(pathsArr))
+		for _, p := range pathsArr {
+			pathArr, ok := p.([]any)
 			if !ok {
-				continue
+				return nil, fmt.Errorf("delpaths: paths must be an array of arrays")
 			}
-			modified, _ = deletePath(modified, pathArr)
+			paths = append(paths, pathArr)
+		}
+
+		modified, err := deletePaths(node.Value, paths)
+		if err != nil {
+			return nil, err
 		}
 
 		results = append(results, types.NewCandidateNode(modified))
@@ -1874,6 +1649,12 @@ func deletePath(value any, path []any) (any, error) {
 			result = append(result, arr[idx+1:]...)
 			return result, nil
 
+		case map[string]any:
+			if _, ok := value.([]any); !ok {
+				return value, nil // Not an array, nothing to delete
+			}
+			return setSlicePath(value, key, []any{})
+
 		default:
 			return nil, fmt.Errorf("invalid path element type: %T", path[0])
 		}
@@ -1919,6 +1700,20 @@ func deletePath(value any, path []any) (any, error) {
 		result[idx] = updated
 		return result, nil
 
+	case map[string]any:
+		if _, ok := value.([]any); !ok {
+			return value, nil
+		}
+		slice, err := getSlicePath(value, k)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := deletePath(slice, remainingPath)
+		if err != nil {
+			return nil, err
+		}
+		return setSlicePath(value, k, updated)
+
 	default:
 		return nil, fmt.Errorf("invalid path element type: %T", key)
 	}
@@ -2025,6 +1820,11 @@ func interpolateToString(v any) string {
 	case string:
 		return val
 	case float64:
+		// NaN and infinities print as they do in JSON
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			s, _ := toJSONText(val)
+			return s
+		}
 		// Format without trailing zeros
 		if val == float64(int64(val)) {
 			return fmt.Sprintf("%d", int64(val))
@@ -2039,13 +1839,14 @@ func interpolateToString(v any) string {
 		return "null"
 	default:
 		// For arrays/objects, return JSON representation
-		b, _ := json.Marshal(val)
-		return string(b)
+		s, _ := toJSONText(val)
+		return s
 	}
 }
 
 // evalRecursiveDescent evaluates the recursive descent operator (..).
 // It returns all values in the input, recursively descending into arrays and objects.
+// Each value keeps its path, so .. can be used on the left side of an update.
 func evalRecursiveDescent(n *parser.RecursiveDescentNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
@@ -2053,27 +1854,30 @@ func evalRecursiveDescent(n *parser.RecursiveDescentNode, ctx *types.Context) ([
 		// Add the current value
 		results = append(results, node)
 		// Recursively add all nested values
-		results = append(results, collectAllValues(node.Value)...)
+		results = append(results, collectAllValues(node)...)
 	}
 
 	return results, nil
 }
 
 // collectAllValues recursively collects all values from arrays and objects.
-func collectAllValues(v any) []*types.CandidateNode {
+func collectAllValues(node *types.CandidateNode) []*types.CandidateNode {
 	var results []*types.CandidateNode
 
-	switch val := v.(type) {
+	switch val := node.Value.(type) {
 	case []any:
-		for _, elem := range val {
-			results = append(results, types.NewCandidateNode(elem))
-			results = append(results, collectAllValues(elem)...)
+		for i, elem := range val {
+			child := node.WithPath(i)
+			child.Value = elem
+			results = append(results, child)
+			results = append(results, collectAllValues(child)...)
 		}
 	case map[string]any:
 		for _, k := range sortedKeys(val) {
-			elem := val[k]
-			results = append(results, types.NewCandidateNode(elem))
-			results = append(results, collectAllValues(elem)...)
+			child := node.WithPath(k)
+			child.Value = val[k]
+			results = append(results, child)
+			results = append(results, collectAllValues(child)...)
 		}
 	}
 
@@ -2081,89 +1885,31 @@ func collectAllValues(v any) []*types.CandidateNode {
 }
 
 // evalVariableBind evaluates variable binding (expr as $var | body).
-func evalVariableBind(n *parser.VariableBindNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	var results []*types.CandidateNode
-
+func evalVariableBind(n *parser.VariableBindNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
 	for _, node := range ctx.MatchingNodes {
 		// Evaluate the expression to bind
 		exprCtx := ctx.Clone()
 		exprCtx.SetMatchingNodes([]*types.CandidateNode{node})
 
-		exprResults, err := evaluate(n.Expr, exprCtx)
-		if err != nil {
-			return nil, err
-		}
-
 		// For each result from the expression, bind to variable and evaluate body
-		for _, exprResult := range exprResults {
+		err := evaluateEach(n.Expr, exprCtx, func(exprResult *types.CandidateNode) error {
 			// Create new context with variable bound
 			bodyCtx := ctx.Clone()
 			bodyCtx.SetMatchingNodes([]*types.CandidateNode{node})
 			bodyCtx.Variables[n.VarName] = exprResult.Value
 
-			bodyResults, err := evaluate(n.Body, bodyCtx)
-			if err != nil {
-				return nil, err
-			}
-
-			results = append(results, bodyResults...)
-		}
-	}
-
-	return results, nil
-}
-
-// evalDestructureBind evaluates destructuring variable binding (expr as {x: $x, y: $y} | body).
-func evalDestructureBind(n *parser.DestructureBindNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		// Evaluate the expression to destructure
-		exprCtx := ctx.Clone()
-		exprCtx.SetMatchingNodes([]*types.CandidateNode{node})
-
-		exprResults, err := evaluate(n.Expr, exprCtx)
+			return evaluateEach(n.Body, bodyCtx, emit)
+		})
 		if err != nil {
-			return nil, err
-		}
-
-		// For each result from the expression, extract fields and bind to variables
-		for _, exprResult := range exprResults {
-			// The result must be an object
-			obj, ok := exprResult.Value.(map[string]any)
-			if !ok {
-				return nil, fmt.Errorf("destructure requires object, got %T", exprResult.Value)
-			}
-
-			// Create new context with variables bound
-			bodyCtx := ctx.Clone()
-			bodyCtx.SetMatchingNodes([]*types.CandidateNode{node})
-
-			// Bind each field to its variable
-			for fieldName, varName := range n.Bindings {
-				value, exists := obj[fieldName]
-				if !exists {
-					value = nil // Field doesn't exist - bind to null
-				}
-				bodyCtx.Variables[varName] = value
-			}
-
-			bodyResults, err := evaluate(n.Body, bodyCtx)
-			if err != nil {
-				return nil, err
-			}
-
-			results = append(results, bodyResults...)
+			return err
 		}
 	}
 
-	return results, nil
+	return nil
 }
 
 // evalConditional evaluates if-then-else.
-func evalConditional(n *parser.ConditionalNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	var results []*types.CandidateNode
-
+func evalConditional(n *parser.ConditionalNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
 	for _, node := range ctx.MatchingNodes {
 		// Evaluate condition with this node as input
 		condCtx := ctx.Clone()
@@ -2171,7 +1917,7 @@ func evalConditional(n *parser.ConditionalNode, ctx *types.Context) ([]*types.Ca
 
 		condResults, err := evaluate(n.Condition, condCtx)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// Check if condition is truthy
@@ -2186,15 +1932,12 @@ func evalConditional(n *parser.ConditionalNode, ctx *types.Context) ([]*types.Ca
 		branchCtx := ctx.Clone()
 		branchCtx.SetMatchingNodes([]*types.CandidateNode{node})
 
-		branchResults, err := evaluate(branch, branchCtx)
-		if err != nil {
-			return nil, err
+		if err := evaluateEach(branch, branchCtx, emit); err != nil {
+			return err
 		}
-
-		results = append(results, branchResults...)
 	}
 
-	return results, nil
+	return nil
 }
 
 // evalUnaryOp evaluates unary operators (not, -).
@@ -2225,8 +1968,231 @@ func evalUnaryOp(n *parser.UnaryOpNode, ctx *types.Context) ([]*types.CandidateN
 	return outputs, nil
 }
 
+// labelVarPrefix prefixes the variable names under which label scopes are bound.
+// The "*" cannot appear in a $variable name, so labels never clash with variables.
+const labelVarPrefix = "*label*"
+
+// labelScope identifies one evaluation of a label expression.
+type labelScope struct {
+	name string
+}
+
+// breakError is the control-flow signal raised by break $NAME. It travels up
+// through the evaluator like an error until it reaches the label scope it
+// belongs to. Evaluators that collect outputs return the outputs produced
+// before the break alongside it, so the label can still emit them.
+type breakError struct {
+	scope *labelScope
+}
+
+func (e *breakError) Error() string {
+	return fmt.Sprintf("break $%s outside of its label", e.scope.name)
+}
+
+// ValueError is an error raised by error(v). It carries v, which may be any
+// value, so that catch receives it unchanged.
+type ValueError struct {
+	Value any
+}
+
+// Error returns the value itself for a string, and its JSON text otherwise.
+func (e *ValueError) Error() string {
+	if s, ok := e.Value.(string); ok {
+		return s
+	}
+	text, err := toJSONText(e.Value)
+	if err != nil {
+		text = fmt.Sprint(e.Value)
+	}
+	return "error (not a string): " + text
+}
+
+// errorValue returns the value catch receives for err: the value given to
+// error, or the message of any other error.
+func errorValue(err error) any {
+	var valErr *ValueError
+	if errors.As(err, &valErr) {
+		return valErr.Value
+	}
+	return err.Error()
+}
+
+// evalError evaluates error, which raises its input, and error(V), which
+// raises the first output of V. Any value can be raised, null included.
+func evalError(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	for _, node := range ctx.MatchingNodes {
+		if len(args) == 0 {
+			return nil, &ValueError{Value: node.Value}
+		}
+		values, err := applyTo(args[0], node, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 0 {
+			return nil, &ValueError{Value: values[0].Value}
+		}
+	}
+	return nil, nil
+}
+
+// HaltError stops the program, as halt and halt_error do. Like a break it
+// is not an error that try or ? can catch. Code is the exit status to end
+// with. Message is the input of halt_error, which the program writes to
+// stderr; it is unset for halt, which stops silently.
+type HaltError struct {
+	Code       int
+	Message    any
+	HasMessage bool
+}
+
+func (e *HaltError) Error() string {
+	return fmt.Sprintf("halted with exit status %d", e.Code)
+}
+
+// evalHalt evaluates halt, which stops the program with exit status 0.
+func evalHalt(ctx *types.Context) ([]*types.CandidateNode, error) {
+	if len(ctx.MatchingNodes) == 0 {
+		return nil, nil
+	}
+	return nil, &HaltError{}
+}
+
+// evalHaltError evaluates halt_error and halt_error(CODE), which stop the
+// program with exit status CODE (5 by default) and the input as message.
+func evalHaltError(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	for _, node := range ctx.MatchingNodes {
+		if len(args) == 0 {
+			return nil, &HaltError{Code: 5, Message: node.Value, HasMessage: true}
+		}
+		codes, err := applyTo(args[0], node, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range codes {
+			code, ok := c.Value.(float64)
+			if !ok || code != float64(int(code)) {
+				return nil, fmt.Errorf("halt_error requires an integer exit status, got %s", describeValue(c.Value))
+			}
+			return nil, &HaltError{Code: int(code), Message: node.Value, HasMessage: true}
+		}
+	}
+	return nil, nil
+}
+
+// isBreak reports whether err is a break signal, or a halt, rather than a
+// real error.
+func isBreak(err error) bool {
+	var brk *breakError
+	var halt *HaltError
+	return errors.As(err, &brk) || errors.As(err, &halt)
+}
+
+// isBreakFor reports whether err is the break signal for scope.
+func isBreakFor(err error, scope *labelScope) bool {
+	var brk *breakError
+	return errors.As(err, &brk) && brk.scope == scope
+}
+
+// evalLabel evaluates label $NAME | BODY.
+// A break $NAME inside BODY stops BODY; outputs produced before it are kept.
+func evalLabel(n *parser.LabelNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		scope := &labelScope{name: n.Name}
+		labelCtx := ctx.Clone()
+		labelCtx.SetMatchingNodes([]*types.CandidateNode{node})
+		labelCtx.Variables[labelVarPrefix+n.Name] = scope
+
+		if err := evaluateEach(n.Body, labelCtx, emit); err != nil && !isBreakFor(err, scope) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evalBreak evaluates break $NAME by raising the signal for the enclosing label.
+func evalBreak(n *parser.BreakNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	scope, ok := ctx.Variables[labelVarPrefix+n.Name].(*labelScope)
+	if !ok {
+		return nil, fmt.Errorf("$*label-%s is not defined", n.Name)
+	}
+	return nil, &breakError{scope: scope}
+}
+
+// evalFunctionDef evaluates def NAME(PARAMS): BODY; REST by evaluating REST
+// in a scope where the function is defined.
+func evalFunctionDef(n *parser.FunctionDefNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	scope := ctx.Clone()
+	// The function closes over its own scope so it can call itself recursively
+	scope.Functions[types.FunctionKey(n.Name, len(n.Params))] = &types.FunctionDef{
+		Params: n.Params,
+		Body:   n.Body,
+		Scope:  scope,
+	}
+	return evaluateEach(n.Rest, scope, emit)
+}
+
+// callUserFunction calls a user-defined function (or filter parameter).
+func callUserFunction(fn *types.FunctionDef, args []parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	return bindFunctionArgs(fn, args, ctx, func(callCtx *types.Context) error {
+		return evaluateEach(fn.Body, callCtx, emit)
+	})
+}
+
+// bindFunctionArgs prepares a call of fn for each input node and runs body in
+// the resulting scope. Filter arguments are passed as closures over the
+// caller's scope; value arguments ($x) are evaluated first and bound for each
+// of their outputs.
+func bindFunctionArgs(fn *types.FunctionDef, args []parser.ExpressionNode, ctx *types.Context, body func(*types.Context) error) error {
+	for _, node := range ctx.MatchingNodes {
+		callCtx := fn.Scope.Clone()
+		callCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		// Filter parameters see the caller's scope, not the function's
+		for i, param := range fn.Params {
+			callCtx.Functions[types.FunctionKey(strings.TrimPrefix(param, "$"), 0)] = &types.FunctionDef{
+				Body:  args[i],
+				Scope: ctx,
+			}
+		}
+
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+		if err := bindValueParams(fn, args, 0, nodeCtx, callCtx, body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bindValueParams binds value parameters from index i onwards and runs body.
+// Like "a as $a | b as $b | body", each output of a value argument produces
+// a separate run of the body.
+func bindValueParams(fn *types.FunctionDef, args []parser.ExpressionNode, i int, callerCtx, callCtx *types.Context, body func(*types.Context) error) error {
+	if i == len(fn.Params) {
+		return body(callCtx)
+	}
+
+	param := fn.Params[i]
+	if !strings.HasPrefix(param, "$") {
+		return bindValueParams(fn, args, i+1, callerCtx, callCtx, body)
+	}
+
+	return evaluateEach(args[i], callerCtx, func(arg *types.CandidateNode) error {
+		boundCtx := callCtx.Clone()
+		boundCtx.Variables[param[1:]] = arg.Value
+		return bindValueParams(fn, args, i+1, callerCtx, boundCtx, body)
+	})
+}
+
 // evalFunctionCall evaluates a function call.
+// User-defined functions take precedence over builtins of the same name and arity.
 func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	if _, ok := ctx.GetFunction(n.Name, len(n.Args)); ok || isGeneratorCall(n) {
+		return collect(n, ctx)
+	}
+
 	switch n.Name {
 	case "length":
 		return evalLength(ctx)
@@ -2260,9 +2226,6 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 	case "add":
 		return evalAdd(ctx)
 	case "first":
-		if len(n.Args) == 1 {
-			return evalFirstExpr(n.Args[0], ctx)
-		}
 		return evalFirst(ctx)
 	case "last":
 		if len(n.Args) == 1 {
@@ -2309,6 +2272,24 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 			return nil, fmt.Errorf("contains requires 1 argument")
 		}
 		return evalContains(n.Args[0], ctx)
+	case "any", "all":
+		return evalQuantifier(n.Name, n.Args, ctx)
+	case "isvalid":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("isvalid requires 1 argument")
+		}
+		return evalIsValid(n.Args[0], ctx)
+	case "indices", "index", "rindex":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("%s requires 1 argument", n.Name)
+		}
+		return evalIndices(n.Name, n.Args[0], ctx)
+	case "IN":
+		return evalIN(n.Args, ctx)
+	case "INDEX":
+		return evalINDEX(n.Args, ctx)
+	case "JOIN":
+		return evalJOIN(n.Args, ctx)
 	case "inside":
 		if len(n.Args) != 1 {
 			return nil, fmt.Errorf("inside requires 1 argument")
@@ -2330,48 +2311,39 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 		return evalScalarsFilter(ctx)
 	case "iterables":
 		return evalIterablesFilter(ctx)
-	case "test":
-		if len(n.Args) != 1 {
-			return nil, fmt.Errorf("test requires 1 argument")
-		}
-		return evalTest(n.Args[0], ctx)
-	case "match":
-		if len(n.Args) != 1 {
-			return nil, fmt.Errorf("match requires 1 argument")
-		}
-		return evalMatch(n.Args[0], ctx)
-	case "capture":
-		if len(n.Args) != 1 {
-			return nil, fmt.Errorf("capture requires 1 argument")
-		}
-		return evalCapture(n.Args[0], ctx)
-	case "sub":
-		if len(n.Args) != 2 {
-			return nil, fmt.Errorf("sub requires 2 arguments")
-		}
-		return evalSub(n.Args[0], n.Args[1], ctx)
-	case "gsub":
-		if len(n.Args) != 2 {
-			return nil, fmt.Errorf("gsub requires 2 arguments")
-		}
-		return evalGsub(n.Args[0], n.Args[1], ctx)
+	case "test", "match", "capture", "scan":
+		if len(n.Args) < 1 || len(n.Args) > 2 {
+			return nil, fmt.Errorf("%s requires 1 or 2 arguments", n.Name)
+		}
+		switch n.Name {
+		case "test":
+			return evalTest(n.Args, ctx)
+		case "match":
+			return evalMatch(n.Args, ctx)
+		case "capture":
+			return evalCapture(n.Args, ctx)
+		}
+		return evalScan(n.Args, ctx)
+	case "sub", "gsub":
+		if len(n.Args) < 2 || len(n.Args) > 3 {
+			return nil, fmt.Errorf("%s requires 2 or 3 arguments", n.Name)
+		}
+		return evalSub(n.Name, n.Args, ctx)
 	case "error":
-		if len(n.Args) == 0 {
-			return nil, fmt.Errorf("error")
+		if len(n.Args) > 1 {
+			return nil, fmt.Errorf("error takes 0 or 1 argument")
 		}
-		if len(n.Args) == 1 {
-			msgResults, err := evaluate(n.Args[0], ctx)
-			if err != nil {
-				return nil, err
-			}
-			if len(msgResults) > 0 {
-				if msg, ok := msgResults[0].Value.(string); ok {
-					return nil, fmt.Errorf("%s", msg)
-				}
-			}
-			return nil, fmt.Errorf("error")
+		return evalError(n.Args, ctx)
+	case "halt":
+		if len(n.Args) != 0 {
+			return nil, fmt.Errorf("halt takes no arguments")
 		}
-		return nil, fmt.Errorf("error takes 0 or 1 argument")
+		return evalHalt(ctx)
+	case "halt_error":
+		if len(n.Args) > 1 {
+			return nil, fmt.Errorf("halt_error takes 0 or 1 argument")
+		}
+		return evalHaltError(n.Args, ctx)
 	case "group_by":
 		if len(n.Args) != 1 {
 			return nil, fmt.Errorf("group_by requires 1 argument")
@@ -2382,15 +2354,35 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 			return nil, fmt.Errorf("map_values requires 1 argument")
 		}
 		return evalMapValues(n.Args[0], ctx)
+	case "walk":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("walk requires 1 argument")
+		}
+		return evalWalk(n.Args[0], ctx)
 	case "tostring":
 		return evalToString(ctx)
 	case "tonumber":
 		return evalToNumber(ctx)
+	case "tojson":
+		return evalEncode(jsonCodec, ctx)
+	case "fromjson":
+		return evalDecode(jsonCodec, ctx)
+	case "tohuml":
+		return evalEncode(humlCodec, ctx)
+	case "fromhuml":
+		return evalDecode(humlCodec, ctx)
+	case "toyaml":
+		return evalEncode(yamlCodec, ctx)
+	case "fromyaml":
+		return evalDecode(yamlCodec, ctx)
 	case "split":
-		if len(n.Args) != 1 {
-			return nil, fmt.Errorf("split requires 1 argument")
+		switch len(n.Args) {
+		case 1:
+			return evalSplit(n.Args[0], ctx)
+		case 2:
+			return evalRegexSplit(n.Name, n.Args, ctx)
 		}
-		return evalSplit(n.Args[0], ctx)
+		return nil, fmt.Errorf("split requires 1 or 2 arguments")
 	case "join":
 		if len(n.Args) != 1 {
 			return nil, fmt.Errorf("join requires 1 argument")
@@ -2400,6 +2392,21 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 		return evalASCIIDowncase(ctx)
 	case "ascii_upcase":
 		return evalASCIIUpcase(ctx)
+	case "downcase", "upcase":
+		return evalCase(n.Name, ctx)
+	case "explode":
+		return evalExplode(ctx)
+	case "implode":
+		return evalImplode(ctx)
+	case "ascii":
+		return evalASCII(ctx)
+	case "utf8bytelength":
+		return evalUTF8ByteLength(ctx)
+	case "splits":
+		if len(n.Args) < 1 || len(n.Args) > 2 {
+			return nil, fmt.Errorf("splits requires 1 or 2 arguments")
+		}
+		return evalRegexSplit(n.Name, n.Args, ctx)
 	case "startswith":
 		if len(n.Args) != 1 {
 			return nil, fmt.Errorf("startswith requires 1 argument")
@@ -2420,8 +2427,15 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 			return nil, fmt.Errorf("rtrimstr requires 1 argument")
 		}
 		return evalRtrimstr(n.Args[0], ctx)
+	case "trimstr":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("trimstr requires 1 argument")
+		}
+		return evalTrimstr(n.Args[0], ctx)
 	case "trim":
 		return evalTrim(ctx)
+	case "ltrim", "rtrim":
+		return evalTrimSpace(n.Name, ctx)
 	case "min":
 		return evalMin(ctx)
 	case "max":
@@ -2477,7 +2491,58 @@ func evalFunctionCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.
 			return nil, fmt.Errorf("delpaths requires 1 argument")
 		}
 		return evalDelpaths(n.Args[0], ctx)
+	case "input":
+		return evalInput(ctx)
+	case "document_index":
+		return evalDocumentIndex(ctx)
+	case "now":
+		return evalNow(ctx)
+	case "todate", "todateiso8601", "date":
+		return evalToDate(ctx)
+	case "fromdate", "fromdateiso8601":
+		return evalFromDate(ctx)
+	case "strftime", "strflocaltime":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("%s requires 1 argument", n.Name)
+		}
+		loc := time.UTC
+		if n.Name == "strflocaltime" {
+			loc = time.Local
+		}
+		return evalStrftime(n.Name, n.Args[0], loc, ctx)
+	case "strptime":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("strptime requires 1 argument")
+		}
+		return evalStrptime(n.Args[0], ctx)
+	case "mktime":
+		return evalMktime(ctx)
+	case "gmtime":
+		return evalGmtime("gmtime", time.UTC, ctx)
+	case "localtime":
+		return evalGmtime("localtime", time.Local, ctx)
+	case "dateadd", "datesub":
+		if len(n.Args) != 2 {
+			return nil, fmt.Errorf("%s requires 2 arguments", n.Name)
+		}
+		sign := 1.0
+		if n.Name == "datesub" {
+			sign = -1
+		}
+		return evalDateAdd(n.Name, n.Args[0], n.Args[1], sign, ctx)
+	case "env":
+		return evalEnv(ctx)
+	case "strenv":
+		if len(n.Args) != 1 {
+			return nil, fmt.Errorf("strenv requires 1 argument")
+		}
+		return evalStrenv(n.Args[0], ctx)
+	case "envsubst":
+		return evalEnvsubst(n.Args, ctx)
 	default:
+		if results, ok, err := evalMathCall(n, ctx); ok {
+			return results, err
+		}
 		return nil, fmt.Errorf("unknown function: %s", n.Name)
 	}
 }
@@ -2503,44 +2568,59 @@ func evalArrayConstruct(n *parser.ArrayConstructNode, ctx *types.Context) ([]*ty
 
 // evalObjectConstruct evaluates object construction {...}.
 func evalObjectConstruct(n *parser.ObjectConstructNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	if len(n.Fields) == 0 {
-		return []*types.CandidateNode{types.NewCandidateNode(map[string]any{})}, nil
-	}
+	var results []*types.CandidateNode
+
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.MatchingNodes = []*types.CandidateNode{node}
 
-	obj := make(map[string]any)
+		// Each field multiplies the objects built so far by its key and
+		// value outputs, so a field with no outputs produces no object
+		objs := []map[string]any{{}}
+		for _, field := range n.Fields {
+			keyResults, err := evaluate(field.Key, nodeCtx)
+			if err != nil {
+				return nil, err
+			}
+			valueResults, err := evaluate(field.Value, nodeCtx)
+			if err != nil {
+				return nil, err
+			}
 
-	for _, field := range n.Fields {
-		// Evaluate key
-		keyResults, err := evaluate(field.Key, ctx)
-		if err != nil {
-			return nil, err
-		}
-		if len(keyResults) == 0 {
-			continue
-		}
-		key, ok := keyResults[0].Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("object key must be a string, got %T", keyResults[0].Value)
+			next := make([]map[string]any, 0, len(objs)*len(keyResults)*len(valueResults))
+			for _, obj := range objs {
+				for _, k := range keyResults {
+					key, ok := k.Value.(string)
+					if !ok {
+						return nil, fmt.Errorf("object key must be a string, got %T", k.Value)
+					}
+					for _, v := range valueResults {
+						extended := make(map[string]any, len(obj)+1)
+						for fk, fv := range obj {
+							extended[fk] = fv
+						}
+						extended[key] = v.Value
+						next = append(next, extended)
+					}
+				}
+			}
+			objs = next
 		}
 
-		// Evaluate value
-		valueResults, err := evaluate(field.Value, ctx)
-		if err != nil {
-			return nil, err
-		}
-		if len(valueResults) == 0 {
-			obj[key] = nil
-		} else {
-			obj[key] = valueResults[0].Value
+		for _, obj := range objs {
+			results = append(results, types.NewCandidateNode(obj))
 		}
 	}
 
-	return []*types.CandidateNode{types.NewCandidateNode(obj)}, nil
+	return results, nil
 }
 
 // evalVariable evaluates a variable reference.
 func evalVariable(n *parser.VariableNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	val, ok := ctx.GetVariable(n.Name)
+	if !ok && n.Name == "ENV" {
+		val, ok = envObject(), true
+	}
 	if !ok {
 		return nil, fmt.Errorf("undefined variable: $%s", n.Name)
 	}
@@ -2551,6 +2631,15 @@ func evalVariable(n *parser.VariableNode, ctx *types.Context) ([]*types.Candidat
 // In jq, // returns the right side if left is false or null.
 func evalAlternative(n *parser.AlternativeNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	leftResults, err := evaluate(n.Left, ctx)
+	if isBreak(err) {
+		var truthy []*types.CandidateNode
+		for _, result := range leftResults {
+			if isTruthy(result.Value) {
+				truthy = append(truthy, result)
+			}
+		}
+		return truthy, err
+	}
 	if err == nil && len(leftResults) > 0 {
 		// Check if result is not null and not false (jq behavior)
 		for _, result := range leftResults {
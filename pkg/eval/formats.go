@@ -0,0 +1,277 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// evalFormat evaluates a bare @name, formatting each input as a string.
+func evalFormat(n *parser.FormatNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		s, err := applyFormat(n.Name, node.Value)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(s))
+	}
+	return results, nil
+}
+
+// applyFormat renders v with the named format (without the @).
+func applyFormat(name string, v any) (string, error) {
+	switch name {
+	case "text":
+		return interpolateToString(v), nil
+	case "json":
+		return toJSONText(v)
+	case "huml":
+		return toInlineHUML(v)
+	case "html":
+		return htmlEscaper.Replace(interpolateToString(v)), nil
+	case "uri":
+		return escapeURI(interpolateToString(v)), nil
+	case "csv":
+		return formatRow(v, "csv", ",", csvField)
+	case "tsv":
+		return formatRow(v, "tsv", "\t", tsvField)
+	case "sh":
+		return formatShell(v)
+	case "base64":
+		return base64.StdEncoding.EncodeToString([]byte(interpolateToString(v))), nil
+	case "base64d":
+		s := interpolateToString(v)
+		// Padding is optional, as in jq
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return "", fmt.Errorf("%s is not valid base64 data", describeValue(v))
+		}
+		return string(data), nil
+	case "base32":
+		return base32.StdEncoding.EncodeToString([]byte(interpolateToString(v))), nil
+	case "base32d":
+		s := interpolateToString(v)
+		data, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return "", fmt.Errorf("%s is not valid base32 data", describeValue(v))
+		}
+		return string(data), nil
+	}
+	return "", fmt.Errorf("%s is not a valid format", name)
+}
+
+var htmlEscaper = strings.NewReplacer(
+	"<", "&lt;",
+	">", "&gt;",
+	"&", "&amp;",
+	"'", "&#39;",
+	`"`, "&quot;",
+)
+
+// escapeURI percent-encodes every byte except the unreserved characters
+// A-Z, a-z, 0-9, -, _, . and ~.
+func escapeURI(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreservedURIChar(c) {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+func isUnreservedURIChar(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+// formatRow renders an array as one csv or tsv row, formatting each
+// element with field and joining them with sep.
+func formatRow(v any, name, sep string, field func(any) (string, bool)) (string, error) {
+	arr, ok := v.([]any)
+	if !ok {
+		return "", fmt.Errorf("%s cannot be %s-formatted, only an array can be", describeValue(v), name)
+	}
+
+	fields := make([]string, len(arr))
+	for i, elem := range arr {
+		s, ok := field(elem)
+		if !ok {
+			return "", fmt.Errorf("%s is not valid in a %s row", describeValue(elem), name)
+		}
+		fields[i] = s
+	}
+	return strings.Join(fields, sep), nil
+}
+
+// csvField quotes strings, doubling any quotes inside them.
+// Null is an empty field.
+func csvField(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return `"` + strings.ReplaceAll(val, `"`, `""`) + `"`, true
+	case nil:
+		return "", true
+	case float64, bool:
+		return interpolateToString(val), true
+	}
+	return "", false
+}
+
+var tsvEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+// tsvField escapes backslashes, tabs and line breaks in strings.
+// Null is an empty field.
+func tsvField(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return tsvEscaper.Replace(val), true
+	case nil:
+		return "", true
+	case float64, bool:
+		return interpolateToString(val), true
+	}
+	return "", false
+}
+
+// formatShell quotes a value for a POSIX shell command line. Strings are
+// single-quoted, and an array becomes its quoted elements separated by spaces.
+func formatShell(v any) (string, error) {
+	arr, ok := v.([]any)
+	if !ok {
+		arr = []any{v}
+	}
+
+	words := make([]string, len(arr))
+	for i, elem := range arr {
+		switch val := elem.(type) {
+		case string:
+			words[i] = "'" + strings.ReplaceAll(val, "'", `'\''`) + "'"
+		case float64, bool, nil:
+			words[i] = interpolateToString(val)
+		default:
+			return "", fmt.Errorf("%s can not be escaped for shell", describeValue(elem))
+		}
+	}
+	return strings.Join(words, " "), nil
+}
+
+// toInlineHUML renders v as inline HUML: scalars as literals, arrays as
+// "1, 2, 3" and objects as "a: 1, b: 2" with sorted keys. Inline HUML
+// cannot nest, so only empty arrays and objects may appear inside another.
+func toInlineHUML(v any) (string, error) {
+	switch val := v.(type) {
+	case []any:
+		if len(val) == 0 {
+			return "[]", nil
+		}
+		items := make([]string, len(val))
+		for i, elem := range val {
+			s, err := inlineHUMLScalar(elem)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ", "), nil
+	case map[string]any:
+		if len(val) == 0 {
+			return "{}", nil
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, k := range keys {
+			s, err := inlineHUMLScalar(val[k])
+			if err != nil {
+				return "", err
+			}
+			items[i] = humlKey(k) + ": " + s
+		}
+		return strings.Join(items, ", "), nil
+	}
+	return inlineHUMLScalar(v)
+}
+
+// inlineHUMLScalar renders a value that appears inside an inline list or dict.
+func inlineHUMLScalar(v any) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return toJSONText(val)
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return "nan", nil
+		case math.IsInf(val, 1):
+			return "inf", nil
+		case math.IsInf(val, -1):
+			return "-inf", nil
+		}
+		return interpolateToString(val), nil
+	case bool, nil:
+		return interpolateToString(val), nil
+	case []any:
+		if len(val) == 0 {
+			return "[]", nil
+		}
+	case map[string]any:
+		if len(val) == 0 {
+			return "{}", nil
+		}
+	}
+	return "", fmt.Errorf("%s cannot be nested in inline HUML", describeValue(v))
+}
+
+var bareHUMLKey = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+// humlKey quotes a key unless HUML allows it bare.
+func humlKey(k string) string {
+	if bareHUMLKey.MatchString(k) {
+		return k
+	}
+	s, _ := toJSONText(k)
+	return s
+}
+
+// describeValue names a value and shows it as JSON for error messages,
+// e.g. object ({"a":1}).
+func describeValue(v any) string {
+	s, err := toJSONText(v)
+	if err != nil {
+		s = interpolateToString(v)
+	}
+	return fmt.Sprintf("%s (%s)", typeName(v), s)
+}
+
+// toJSONText encodes v as compact JSON without HTML escaping. NaN and
+// infinities are written as jq writes them.
+func toJSONText(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(JSONCompatible(v)); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -2,15 +2,15 @@ package eval
 
 import (
 	"fmt"
-	"regexp"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/rhnvrm/hq/pkg/parser"
 	"github.com/rhnvrm/hq/pkg/types"
 )
 
-// evalLength returns the length of an array, string, or object.
+// evalLength returns the length of an array, string (in code points), or object.
 // For numbers, returns absolute value. For null, returns null.
 func evalLength(ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
@@ -20,7 +20,7 @@ func evalLength(ctx *types.Context) ([]*types.CandidateNode, error) {
 		case []any:
 			results = append(results, types.NewCandidateNode(float64(len(v))))
 		case string:
-			results = append(results, types.NewCandidateNode(float64(len(v))))
+			results = append(results, types.NewCandidateNode(float64(utf8.RuneCountInString(v))))
 		case map[string]any:
 			results = append(results, types.NewCandidateNode(float64(len(v))))
 		case nil:
@@ -139,31 +139,31 @@ func evalType(ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		var typeName string
-
-		switch node.Value.(type) {
-		case nil:
-			typeName = "null"
-		case bool:
-			typeName = "boolean"
-		case float64, int, int64:
-			typeName = "number"
-		case string:
-			typeName = "string"
-		case []any:
-			typeName = "array"
-		case map[string]any:
-			typeName = "object"
-		default:
-			typeName = "unknown"
-		}
-
-		results = append(results, types.NewCandidateNode(typeName))
+		results = append(results, types.NewCandidateNode(typeName(node.Value)))
 	}
 
 	return results, nil
 }
 
+// typeName returns the jq type name of a value.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
 // evalSelect filters values where the condition is truthy.
 func evalSelect(condition parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
@@ -268,6 +268,20 @@ func evalAdd(ctx *types.Context) ([]*types.CandidateNode, error) {
 			}
 			results = append(results, types.NewCandidateNode(result))
 
+		case map[string]any:
+			// Later objects win, as with +
+			result := make(map[string]any)
+			for _, elem := range arr {
+				m, ok := elem.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("add: cannot merge %T", elem)
+				}
+				for k, v := range m {
+					result[k] = v
+				}
+			}
+			results = append(results, types.NewCandidateNode(result))
+
 		default:
 			return nil, fmt.Errorf("add: unsupported type %T", arr[0])
 		}
@@ -295,21 +309,6 @@ func evalFirst(ctx *types.Context) ([]*types.CandidateNode, error) {
 	return results, nil
 }
 
-// evalFirstExpr evaluates an expression and returns the first result.
-func evalFirstExpr(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate the expression
-	results, err := evaluate(expr, ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(results) == 0 {
-		return nil, fmt.Errorf("cannot get first element of empty sequence")
-	}
-
-	return []*types.CandidateNode{results[0]}, nil
-}
-
 // evalLast returns the last element of an array.
 func evalLast(ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
@@ -329,7 +328,7 @@ func evalLast(ctx *types.Context) ([]*types.CandidateNode, error) {
 	return results, nil
 }
 
-// evalLastExpr evaluates an expression and returns the last result.
+// evalLastExpr evaluates an expression and returns its last result, if any.
 func evalLastExpr(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	// Evaluate the expression
 	results, err := evaluate(expr, ctx)
@@ -338,7 +337,7 @@ func evalLastExpr(expr parser.ExpressionNode, ctx *types.Context) ([]*types.Cand
 	}
 
 	if len(results) == 0 {
-		return nil, fmt.Errorf("cannot get last element of empty sequence")
+		return []*types.CandidateNode{}, nil
 	}
 
 	return []*types.CandidateNode{results[len(results)-1]}, nil
@@ -594,13 +593,7 @@ func compareValues(a, b any) int {
 	// Numbers
 	if an, aok := toNumber(a); aok {
 		if bn, bok := toNumber(b); bok {
-			if an < bn {
-				return -1
-			}
-			if an > bn {
-				return 1
-			}
-			return 0
+			return compareNumbers(an, bn)
 		}
 	}
 
@@ -932,293 +925,6 @@ func evalIterablesFilter(ctx *types.Context) ([]*types.CandidateNode, error) {
 	return results, nil
 }
 
-// evalTest tests if a string matches a regex pattern.
-func evalTest(patternExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate pattern
-	patternResults, err := evaluate(patternExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(patternResults) == 0 {
-		return nil, fmt.Errorf("test: pattern produced no value")
-	}
-	pattern, ok := patternResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("test: pattern must be a string, got %T", patternResults[0].Value)
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("test: invalid regex: %w", err)
-	}
-
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		s, ok := node.Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("test: input must be a string, got %T", node.Value)
-		}
-
-		results = append(results, types.NewCandidateNode(re.MatchString(s)))
-	}
-
-	return results, nil
-}
-
-// evalMatch returns match information for a regex.
-func evalMatch(patternExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate pattern
-	patternResults, err := evaluate(patternExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(patternResults) == 0 {
-		return nil, fmt.Errorf("match: pattern produced no value")
-	}
-	pattern, ok := patternResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("match: pattern must be a string, got %T", patternResults[0].Value)
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("match: invalid regex: %w", err)
-	}
-
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		s, ok := node.Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("match: input must be a string, got %T", node.Value)
-		}
-
-		match := re.FindStringSubmatchIndex(s)
-		if match == nil {
-			results = append(results, types.NewCandidateNode(nil))
-			continue
-		}
-
-		// Build match object
-		captures := buildCaptures(re, s, match)
-		if captures == nil {
-			captures = []any{} // Empty array, not null
-		}
-		matchObj := map[string]any{
-			"offset":   float64(match[0]),
-			"length":   float64(match[1] - match[0]),
-			"string":   s[match[0]:match[1]],
-			"captures": captures,
-		}
-
-		results = append(results, types.NewCandidateNode(matchObj))
-	}
-
-	return results, nil
-}
-
-// buildCaptures builds the captures array from match indices.
-// convertBackreferences converts jq-style backreferences (\1, \2) to Go style ($1, $2)
-func convertBackreferences(replacement string) string {
-	result := replacement
-	// Convert \0-\9 to $0-$9
-	for i := 9; i >= 0; i-- {
-		old := fmt.Sprintf("\\%d", i)
-		new := fmt.Sprintf("$%d", i)
-		result = strings.ReplaceAll(result, old, new)
-	}
-	return result
-}
-
-func buildCaptures(re *regexp.Regexp, s string, match []int) []any {
-	names := re.SubexpNames()
-	var captures []any
-
-	for i := 1; i < len(match)/2; i++ {
-		start, end := match[i*2], match[i*2+1]
-		// Use null for unnamed groups (empty string in Go)
-		var name any = nil
-		if names[i] != "" {
-			name = names[i]
-		}
-		if start == -1 {
-			captures = append(captures, map[string]any{
-				"offset": float64(-1),
-				"length": float64(0),
-				"string": nil,
-				"name":   name,
-			})
-		} else {
-			captures = append(captures, map[string]any{
-				"offset": float64(start),
-				"length": float64(end - start),
-				"string": s[start:end],
-				"name":   name,
-			})
-		}
-	}
-
-	return captures
-}
-
-// evalCapture extracts named capture groups.
-func evalCapture(patternExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate pattern
-	patternResults, err := evaluate(patternExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(patternResults) == 0 {
-		return nil, fmt.Errorf("capture: pattern produced no value")
-	}
-	pattern, ok := patternResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("capture: pattern must be a string, got %T", patternResults[0].Value)
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("capture: invalid regex: %w", err)
-	}
-
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		s, ok := node.Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("capture: input must be a string, got %T", node.Value)
-		}
-
-		match := re.FindStringSubmatch(s)
-		if match == nil {
-			results = append(results, types.NewCandidateNode(nil))
-			continue
-		}
-
-		// Build capture object with named groups
-		captureObj := make(map[string]any)
-		names := re.SubexpNames()
-		for i, name := range names {
-			if name != "" && i < len(match) {
-				captureObj[name] = match[i]
-			}
-		}
-
-		results = append(results, types.NewCandidateNode(captureObj))
-	}
-
-	return results, nil
-}
-
-// evalSub replaces first match of regex.
-func evalSub(patternExpr, replacementExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate pattern
-	patternResults, err := evaluate(patternExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(patternResults) == 0 {
-		return nil, fmt.Errorf("sub: pattern produced no value")
-	}
-	pattern, ok := patternResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("sub: pattern must be a string, got %T", patternResults[0].Value)
-	}
-
-	// Evaluate replacement
-	replacementResults, err := evaluate(replacementExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(replacementResults) == 0 {
-		return nil, fmt.Errorf("sub: replacement produced no value")
-	}
-	replacement, ok := replacementResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("sub: replacement must be a string, got %T", replacementResults[0].Value)
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("sub: invalid regex: %w", err)
-	}
-
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		s, ok := node.Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("sub: input must be a string, got %T", node.Value)
-		}
-
-		// Replace first match only
-		// Convert jq-style backreferences to Go style
-		goReplacement := convertBackreferences(replacement)
-		match := re.FindStringSubmatchIndex(s)
-		if match == nil {
-			results = append(results, types.NewCandidateNode(s))
-		} else {
-			result := string(re.ExpandString(nil, goReplacement, s, match))
-			result = s[:match[0]] + result + s[match[1]:]
-			results = append(results, types.NewCandidateNode(result))
-		}
-	}
-
-	return results, nil
-}
-
-// evalGsub replaces all matches of regex.
-func evalGsub(patternExpr, replacementExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
-	// Evaluate pattern
-	patternResults, err := evaluate(patternExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(patternResults) == 0 {
-		return nil, fmt.Errorf("gsub: pattern produced no value")
-	}
-	pattern, ok := patternResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("gsub: pattern must be a string, got %T", patternResults[0].Value)
-	}
-
-	// Evaluate replacement
-	replacementResults, err := evaluate(replacementExpr, ctx)
-	if err != nil {
-		return nil, err
-	}
-	if len(replacementResults) == 0 {
-		return nil, fmt.Errorf("gsub: replacement produced no value")
-	}
-	replacement, ok := replacementResults[0].Value.(string)
-	if !ok {
-		return nil, fmt.Errorf("gsub: replacement must be a string, got %T", replacementResults[0].Value)
-	}
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("gsub: invalid regex: %w", err)
-	}
-
-	// Convert jq-style backreferences (\1, \2) to Go style ($1, $2)
-	goReplacement := convertBackreferences(replacement)
-
-	var results []*types.CandidateNode
-
-	for _, node := range ctx.MatchingNodes {
-		s, ok := node.Value.(string)
-		if !ok {
-			return nil, fmt.Errorf("gsub: input must be a string, got %T", node.Value)
-		}
-
-		result := re.ReplaceAllString(s, goReplacement)
-		results = append(results, types.NewCandidateNode(result))
-	}
-
-	return results, nil
-}
-
 // evalGroupBy groups array elements by a key expression.
 func evalGroupBy(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
@@ -1302,33 +1008,70 @@ func evalMapValues(expr parser.ExpressionNode, ctx *types.Context) ([]*types.Can
 	return results, nil
 }
 
-// evalToString converts a value to string.
-func evalToString(ctx *types.Context) ([]*types.CandidateNode, error) {
+// evalWalk applies expr to every value bottom-up: children are walked first,
+// then expr is applied to the rebuilt container. Like map, array elements
+// take every output of expr; like map_values, object values take the first
+// and are removed when there is none.
+func evalWalk(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
 	for _, node := range ctx.MatchingNodes {
-		var str string
-		switch v := node.Value.(type) {
-		case string:
-			str = v
-		case float64:
-			if v == float64(int64(v)) {
-				str = fmt.Sprintf("%d", int64(v))
-			} else {
-				str = fmt.Sprintf("%v", v)
+		walked, err := walkValue(node.Value, expr, ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range walked {
+			results = append(results, types.NewCandidateNode(v))
+		}
+	}
+
+	return results, nil
+}
+
+func walkValue(value any, expr parser.ExpressionNode, ctx *types.Context) ([]any, error) {
+	switch v := value.(type) {
+	case []any:
+		arr := make([]any, 0, len(v))
+		for _, elem := range v {
+			walked, err := walkValue(elem, expr, ctx)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, walked...)
+		}
+		value = arr
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for _, k := range sortedKeys(v) {
+			walked, err := walkValue(v[k], expr, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if len(walked) > 0 {
+				obj[k] = walked[0]
 			}
-		case int:
-			str = fmt.Sprintf("%d", v)
-		case int64:
-			str = fmt.Sprintf("%d", v)
-		case bool:
-			str = fmt.Sprintf("%v", v)
-		case nil:
-			str = "null"
-		default:
-			str = fmt.Sprintf("%v", v)
 		}
-		results = append(results, types.NewCandidateNode(str))
+		value = obj
+	}
+
+	results, err := applyTo(expr, types.NewCandidateNode(value), ctx)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(results))
+	for i, r := range results {
+		values[i] = r.Value
+	}
+	return values, nil
+}
+
+// evalToString converts a value to string. Strings are returned unchanged;
+// arrays and objects are encoded as JSON text, the same as tojson.
+func evalToString(ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+
+	for _, node := range ctx.MatchingNodes {
+		results = append(results, types.NewCandidateNode(interpolateToString(node.Value)))
 	}
 
 	return results, nil
@@ -1435,7 +1178,7 @@ func evalJoin(delimExpr parser.ExpressionNode, ctx *types.Context) ([]*types.Can
 	return results, nil
 }
 
-// evalASCIIDowncase converts a string to lowercase.
+// evalASCIIDowncase converts the ASCII letters of a string to lowercase.
 func evalASCIIDowncase(ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
@@ -1445,13 +1188,13 @@ func evalASCIIDowncase(ctx *types.Context) ([]*types.CandidateNode, error) {
 			return nil, fmt.Errorf("ascii_downcase: input must be a string, got %T", node.Value)
 		}
 
-		results = append(results, types.NewCandidateNode(strings.ToLower(s)))
+		results = append(results, types.NewCandidateNode(asciiDowncase(s)))
 	}
 
 	return results, nil
 }
 
-// evalASCIIUpcase converts a string to uppercase.
+// evalASCIIUpcase converts the ASCII letters of a string to uppercase.
 func evalASCIIUpcase(ctx *types.Context) ([]*types.CandidateNode, error) {
 	var results []*types.CandidateNode
 
@@ -1461,7 +1204,7 @@ func evalASCIIUpcase(ctx *types.Context) ([]*types.CandidateNode, error) {
 			return nil, fmt.Errorf("ascii_upcase: input must be a string, got %T", node.Value)
 		}
 
-		results = append(results, types.NewCandidateNode(strings.ToUpper(s)))
+		results = append(results, types.NewCandidateNode(asciiUpcase(s)))
 	}
 
 	return results, nil
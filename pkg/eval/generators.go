@@ -0,0 +1,370 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// isGeneratorCall reports whether a call is a builtin that streams its
+// outputs through evalGeneratorCall instead of collecting them up front.
+func isGeneratorCall(n *parser.FunctionCallNode) bool {
+	switch n.Name {
+	case "range", "limit", "repeat", "while", "until", "recurse":
+		return true
+	case "inputs":
+		return len(n.Args) == 0
+	case "first":
+		return len(n.Args) == 1
+	}
+	return false
+}
+
+// evalGeneratorCall evaluates a generator builtin, passing each output to emit.
+func evalGeneratorCall(n *parser.FunctionCallNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	switch n.Name {
+	case "range":
+		if len(n.Args) < 1 || len(n.Args) > 3 {
+			return fmt.Errorf("range requires 1 to 3 arguments")
+		}
+		return evalRange(n.Args, ctx, emit)
+	case "limit":
+		if len(n.Args) != 2 {
+			return fmt.Errorf("limit requires 2 arguments")
+		}
+		return evalLimit(n.Args[0], n.Args[1], ctx, emit)
+	case "first":
+		return evalFirstExpr(n.Args[0], ctx, emit)
+	case "repeat":
+		if len(n.Args) != 1 {
+			return fmt.Errorf("repeat requires 1 argument")
+		}
+		return evalRepeat(n.Args[0], ctx, emit)
+	case "while":
+		if len(n.Args) != 2 {
+			return fmt.Errorf("while requires 2 arguments")
+		}
+		return evalWhile(n.Args[0], n.Args[1], ctx, emit)
+	case "until":
+		if len(n.Args) != 2 {
+			return fmt.Errorf("until requires 2 arguments")
+		}
+		return evalUntil(n.Args[0], n.Args[1], ctx, emit)
+	case "inputs":
+		return evalInputs(ctx, emit)
+	case "recurse":
+		switch len(n.Args) {
+		case 0:
+			return evalRecurse(nil, nil, ctx, emit)
+		case 1:
+			return evalRecurse(n.Args[0], nil, ctx, emit)
+		case 2:
+			return evalRecurse(n.Args[0], n.Args[1], ctx, emit)
+		}
+		return fmt.Errorf("recurse requires 0 to 2 arguments")
+	}
+	return fmt.Errorf("unknown function: %s", n.Name)
+}
+
+// evalRange evaluates range(UPTO), range(FROM; UPTO) and range(FROM; UPTO; BY).
+// The bounds are evaluated against each input in turn, and each combination
+// of argument outputs produces its own sequence.
+func evalRange(args []parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		bounds, err := rangeBounds(args, nodeCtx)
+		if err != nil {
+			return err
+		}
+		for _, from := range bounds[0] {
+			for _, upto := range bounds[1] {
+				for _, by := range bounds[2] {
+					if err := emitRange(from, upto, by, emit); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// rangeBounds evaluates the arguments of range into the outputs of FROM,
+// UPTO and BY, filling in the defaults for the shorter forms.
+func rangeBounds(args []parser.ExpressionNode, ctx *types.Context) ([][]float64, error) {
+	var bounds [][]float64
+	for _, arg := range args {
+		results, err := evaluate(arg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, 0, len(results))
+		for _, r := range results {
+			num, ok := toNumber(r.Value)
+			if !ok {
+				return nil, fmt.Errorf("range bounds must be numbers, got %T", r.Value)
+			}
+			values = append(values, num)
+		}
+		bounds = append(bounds, values)
+	}
+
+	// range(UPTO) counts from 0 in steps of 1
+	if len(bounds) == 1 {
+		bounds = [][]float64{{0}, bounds[0]}
+	}
+	if len(bounds) == 2 {
+		bounds = append(bounds, []float64{1})
+	}
+	return bounds, nil
+}
+
+// emitRange emits from, from+by, ... up to but excluding upto.
+// A step of zero produces nothing, and a negative step counts down.
+func emitRange(from, upto, by float64, emit func(*types.CandidateNode) error) error {
+	switch {
+	case by > 0:
+		for v := from; v < upto; v += by {
+			if err := emit(types.NewCandidateNode(v)); err != nil {
+				return err
+			}
+		}
+	case by < 0:
+		for v := from; v > upto; v += by {
+			if err := emit(types.NewCandidateNode(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evalLimit evaluates limit(N; EXPR), emitting at most N outputs of EXPR.
+// EXPR is stopped as soon as the limit is reached.
+func evalLimit(countExpr, expr parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	counts, err := evaluate(countExpr, ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range counts {
+		limit, ok := toNumber(c.Value)
+		if !ok {
+			return fmt.Errorf("limit requires a number, got %T", c.Value)
+		}
+		if err := emitFirstN(expr, int(limit), ctx, emit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// emitFirstN emits the first n outputs of expr and then stops it by raising
+// a break for a label scope of its own.
+func emitFirstN(expr parser.ExpressionNode, n int, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	if n <= 0 {
+		return nil
+	}
+
+	scope := &labelScope{name: "limit"}
+	seen := 0
+	err := evaluateEach(expr, ctx, func(result *types.CandidateNode) error {
+		if err := emit(result); err != nil {
+			return err
+		}
+		seen++
+		if seen >= n {
+			return &breakError{scope: scope}
+		}
+		return nil
+	})
+	if err != nil && !isBreakFor(err, scope) {
+		return err
+	}
+	return nil
+}
+
+// evalFirstExpr evaluates first(EXPR): the first output of EXPR, if any.
+// EXPR is not evaluated beyond its first output.
+func evalFirstExpr(expr parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	return emitFirstN(expr, 1, ctx, emit)
+}
+
+// evalRepeat evaluates repeat(EXPR): the input, then EXPR applied to it,
+// then EXPR applied to that, and so on.
+func evalRepeat(expr parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		if err := repeatNode(node, expr, ctx, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repeatNode emits node and repeats expr on each of its outputs. Single-output
+// steps are handled in a loop so long chains do not grow the Go stack.
+func repeatNode(node *types.CandidateNode, expr parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for {
+		if err := emit(node); err != nil {
+			return err
+		}
+
+		next, err := applyTo(expr, node, ctx)
+		if err != nil {
+			return err
+		}
+		if len(next) != 1 {
+			for _, n := range next {
+				if err := repeatNode(n, expr, ctx, emit); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		node = next[0]
+	}
+}
+
+// evalWhile evaluates while(COND; UPDATE): the input and each UPDATE of it,
+// for as long as COND holds.
+func evalWhile(cond, update parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		if err := whileNode(node, cond, update, ctx, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func whileNode(node *types.CandidateNode, cond, update parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for {
+		ok, err := holdsFor(cond, node, ctx)
+		if err != nil || !ok {
+			return err
+		}
+		if err := emit(node); err != nil {
+			return err
+		}
+
+		next, err := applyTo(update, node, ctx)
+		if err != nil {
+			return err
+		}
+		if len(next) != 1 {
+			for _, n := range next {
+				if err := whileNode(n, cond, update, ctx, emit); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		node = next[0]
+	}
+}
+
+// evalUntil evaluates until(COND; NEXT): NEXT is applied to the input until
+// COND holds, and the value for which it holds is emitted.
+func evalUntil(cond, next parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		if err := untilNode(node, cond, next, ctx, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func untilNode(node *types.CandidateNode, cond, next parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for {
+		ok, err := holdsFor(cond, node, ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return emit(node)
+		}
+
+		results, err := applyTo(next, node, ctx)
+		if err != nil {
+			return err
+		}
+		if len(results) != 1 {
+			for _, n := range results {
+				if err := untilNode(n, cond, next, ctx, emit); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		node = results[0]
+	}
+}
+
+// evalRecurse evaluates recurse, recurse(EXPR) and recurse(EXPR; COND).
+// Each value is emitted before the values EXPR produces from it (depth-first).
+// Without EXPR the children of arrays and objects are visited; with COND,
+// only values for which COND holds are emitted and recursed into.
+func evalRecurse(expr, cond parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for _, node := range ctx.MatchingNodes {
+		if err := recurseNode(node, expr, cond, ctx, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recurseNode(node *types.CandidateNode, expr, cond parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	if err := emit(node); err != nil {
+		return err
+	}
+
+	visit := func(child *types.CandidateNode) error {
+		if cond != nil {
+			ok, err := holdsFor(cond, child, ctx)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		return recurseNode(child, expr, cond, ctx, emit)
+	}
+
+	if expr == nil {
+		switch node.Value.(type) {
+		case []any, map[string]any:
+			children, err := iterateValue(node)
+			if err != nil {
+				return err
+			}
+			for _, child := range children {
+				if err := visit(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	childCtx := ctx.Clone()
+	childCtx.SetMatchingNodes([]*types.CandidateNode{node})
+	return evaluateEach(expr, childCtx, visit)
+}
+
+// applyTo evaluates expr with node as its only input.
+func applyTo(expr parser.ExpressionNode, node *types.CandidateNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	nodeCtx := ctx.Clone()
+	nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+	return evaluate(expr, nodeCtx)
+}
+
+// holdsFor reports whether the first output of cond for node is truthy.
+func holdsFor(cond parser.ExpressionNode, node *types.CandidateNode, ctx *types.Context) (bool, error) {
+	results, err := applyTo(cond, node, ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0 && isTruthy(results[0].Value), nil
+}
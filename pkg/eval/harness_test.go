@@ -30,26 +30,18 @@ func testScenario(t *testing.T, s *Scenario) {
 		}
 
 		// Parse the input document
-		// HUML first (native format), then JSON, then YAML as fallback
-		var input any
-		if s.Document != "" {
-			doc := strings.TrimSpace(s.Document)
-
-			// Try HUML first (native format for hq)
-			if err := gohuml.Unmarshal([]byte(doc), &input); err != nil {
-				// Try JSON (common for piping)
-				if err2 := json.Unmarshal([]byte(doc), &input); err2 != nil {
-					// Try YAML as fallback
-					if err3 := yaml.Unmarshal([]byte(doc), &input); err3 != nil {
-						t.Fatalf("failed to parse input document (HUML: %v, JSON: %v, YAML: %v)", err, err2, err3)
-					}
-				}
-			}
+		input := parseScenarioDocument(t, s.Document)
+
+		// Evaluate the expression, once per document if there is a second one
+		var results []any
+		var err error
+		if s.Document2 != "" {
+			input2 := parseScenarioDocument(t, s.Document2)
+			results, err = EvaluateDocuments(s.Expression, []any{input, input2}, Options{})
+		} else {
+			results, err = Evaluate(s.Expression, input)
 		}
 
-		// Evaluate the expression
-		results, err := Evaluate(s.Expression, input)
-
 		// Check for expected error
 		if s.ExpectedError != "" {
 			if err == nil {
@@ -78,6 +70,30 @@ func testScenario(t *testing.T, s *Scenario) {
 	})
 }
 
+// parseScenarioDocument parses a scenario document.
+// HUML first (native format), then JSON, then YAML as fallback
+func parseScenarioDocument(t *testing.T, document string) any {
+	t.Helper()
+
+	var input any
+	if document == "" {
+		return input
+	}
+	doc := strings.TrimSpace(document)
+
+	// Try HUML first (native format for hq)
+	if err := gohuml.Unmarshal([]byte(doc), &input); err != nil {
+		// Try JSON (common for piping)
+		if err2 := json.Unmarshal([]byte(doc), &input); err2 != nil {
+			// Try YAML as fallback
+			if err3 := yaml.Unmarshal([]byte(doc), &input); err3 != nil {
+				t.Fatalf("failed to parse input document (HUML: %v, JSON: %v, YAML: %v)", err, err2, err3)
+			}
+		}
+	}
+	return input
+}
+
 // valueToString converts a value to its JSON string representation for comparison.
 func valueToString(v any) string {
 	if v == nil {
@@ -0,0 +1,187 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// Options configures EvaluateStream and EvaluateDocuments.
+type Options struct {
+	// NullInput runs the expression once with null as its input, as jq -n
+	// does. The documents are then only read through input and inputs.
+	NullInput bool
+
+	// Now is the time reported by now. When it is zero, the HQ_NOW
+	// environment variable is used if set, and the current time otherwise.
+	Now time.Time
+
+	// NamedArgs are bound as global variables: {"name": v} is $name.
+	// They are also $__named and $ARGS.named.
+	NamedArgs map[string]any
+
+	// PositionalArgs are $ARGS.positional.
+	PositionalArgs []any
+}
+
+// ParseError is returned when the expression itself cannot be parsed, before
+// any input is read.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string { return "parse error: " + e.Err.Error() }
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// EvaluateStream evaluates expr once for each document returned by next,
+// passing every result to emit. next returns ok=false at the end of the
+// stream. The input and inputs builtins read from the same stream, so a
+// document they consume is not evaluated on its own. Evaluation stops at
+// the first error.
+func EvaluateStream(expr string, next func() (any, bool, error), opts Options, emit func(any) error) error {
+	ast, err := parser.Parse(expr)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+
+	inputs := types.NewInputs(next)
+	regexps := make(map[string]*regexp.Regexp)
+	args := argsObject(opts)
+	run := func(node *types.CandidateNode, doc any) error {
+		ctx := types.NewContext(nil)
+		ctx.SetMatchingNodes([]*types.CandidateNode{node})
+		// Arguments are ordinary variables in the root scope, so any
+		// binding inside the expression shadows them
+		for name, v := range opts.NamedArgs {
+			ctx.Variables[name] = v
+		}
+		ctx.Variables["ARGS"] = args
+		ctx.Variables["__named"] = args["named"]
+		ctx.ReadOnlyVariables["__doc"] = doc
+		ctx.Inputs = inputs
+		ctx.Now = opts.Now
+		ctx.Regexps = regexps
+		return evaluateEach(ast, ctx, func(result *types.CandidateNode) error {
+			return emit(result.Value)
+		})
+	}
+
+	if opts.NullInput {
+		return run(types.NewCandidateNode(nil), nil)
+	}
+
+	for {
+		node, ok, err := inputs.Next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := run(node, float64(node.Document)); err != nil {
+			return err
+		}
+	}
+}
+
+// argsObject returns $ARGS: {"positional": [...], "named": {...}}.
+func argsObject(opts Options) map[string]any {
+	named := make(map[string]any, len(opts.NamedArgs))
+	for name, v := range opts.NamedArgs {
+		named[name] = v
+	}
+	positional := make([]any, len(opts.PositionalArgs))
+	copy(positional, opts.PositionalArgs)
+	return map[string]any{"positional": positional, "named": named}
+}
+
+// MergeDocuments deep-merges objects in order, as * does: later documents
+// override earlier ones, and nested objects are merged key by key.
+func MergeDocuments(docs []any) (map[string]any, error) {
+	merged := make(map[string]any)
+	for i, doc := range docs {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("cannot merge document %d: %s is not an object", i+1, typeName(doc))
+		}
+		merged = deepMerge(merged, obj)
+	}
+	return merged, nil
+}
+
+// EvaluateDocuments evaluates expr over a stream of documents and returns
+// all results in order.
+func EvaluateDocuments(expr string, docs []any, opts Options) ([]any, error) {
+	next := func() (any, bool, error) {
+		if len(docs) == 0 {
+			return nil, false, nil
+		}
+		doc := docs[0]
+		docs = docs[1:]
+		return doc, true, nil
+	}
+
+	var results []any
+	err := EvaluateStream(expr, next, opts, func(v any) error {
+		results = append(results, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// evalInput evaluates input: the next document of the stream, for each input.
+func evalInput(ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for range ctx.MatchingNodes {
+		node, ok, err := nextInput(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("no more inputs")
+		}
+		results = append(results, node)
+	}
+	return results, nil
+}
+
+// evalInputs evaluates inputs, emitting the remaining documents one at a
+// time so that first(inputs) reads only one of them.
+func evalInputs(ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	for range ctx.MatchingNodes {
+		for {
+			node, ok, err := nextInput(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			if err := emit(node); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func nextInput(ctx *types.Context) (*types.CandidateNode, bool, error) {
+	if ctx.Inputs == nil {
+		return nil, false, nil
+	}
+	return ctx.Inputs.Next()
+}
+
+// evalDocumentIndex evaluates document_index: the index in the input stream
+// of the document each input came from.
+func evalDocumentIndex(ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		results = append(results, types.NewCandidateNode(float64(node.Document)))
+	}
+	return results, nil
+}
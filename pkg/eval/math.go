@@ -0,0 +1,300 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// mathFunctions are the jq math builtins that take their input as the only
+// operand, e.g. 2 | sqrt.
+var mathFunctions = map[string]func(float64) float64{
+	"floor":       math.Floor,
+	"ceil":        math.Ceil,
+	"round":       math.Round,
+	"trunc":       math.Trunc,
+	"rint":        math.RoundToEven,
+	"nearbyint":   math.RoundToEven,
+	"fabs":        math.Abs,
+	"sqrt":        math.Sqrt,
+	"cbrt":        math.Cbrt,
+	"exp":         math.Exp,
+	"exp2":        math.Exp2,
+	"exp10":       exp10,
+	"pow10":       exp10,
+	"expm1":       math.Expm1,
+	"log":         math.Log,
+	"log2":        math.Log2,
+	"log10":       math.Log10,
+	"log1p":       math.Log1p,
+	"logb":        math.Logb,
+	"gamma":       lgamma,
+	"lgamma":      lgamma,
+	"tgamma":      math.Gamma,
+	"sin":         math.Sin,
+	"cos":         math.Cos,
+	"tan":         math.Tan,
+	"asin":        math.Asin,
+	"acos":        math.Acos,
+	"atan":        math.Atan,
+	"sinh":        math.Sinh,
+	"cosh":        math.Cosh,
+	"tanh":        math.Tanh,
+	"asinh":       math.Asinh,
+	"acosh":       math.Acosh,
+	"atanh":       math.Atanh,
+	"j0":          math.J0,
+	"j1":          math.J1,
+	"y0":          math.Y0,
+	"y1":          math.Y1,
+	"significand": significand,
+}
+
+// mathFunctions2 are the jq math builtins with two operands, given as
+// arguments: pow(2; 10).
+var mathFunctions2 = map[string]func(float64, float64) float64{
+	"pow":        math.Pow,
+	"atan2":      math.Atan2,
+	"fmod":       math.Mod,
+	"drem":       math.Remainder,
+	"hypot":      math.Hypot,
+	"fmin":       math.Min,
+	"fmax":       math.Max,
+	"fdim":       math.Dim,
+	"copysign":   math.Copysign,
+	"nextafter":  math.Nextafter,
+	"nexttoward": math.Nextafter,
+	"ldexp":      ldexp,
+	"scalb":      ldexp,
+	"scalbln":    ldexp,
+}
+
+// mathFunctions3 are the jq math builtins with three operands.
+var mathFunctions3 = map[string]func(float64, float64, float64) float64{
+	"fma": math.FMA,
+}
+
+func exp10(x float64) float64 { return math.Pow(10, x) }
+
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+	return v
+}
+
+func ldexp(x, e float64) float64 { return math.Ldexp(x, int(e)) }
+
+// significand returns x scaled into [1, 2) by a power of two.
+func significand(x float64) float64 {
+	if x == 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return x
+	}
+	frac, _ := math.Frexp(x)
+	return frac * 2
+}
+
+// evalMathCall evaluates n if it is a math builtin and reports whether it was one.
+func evalMathCall(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.CandidateNode, bool, error) {
+	name, arity := n.Name, len(n.Args)
+
+	if f, ok := mathFunctions[name]; ok && arity == 0 {
+		results, err := mapNumbers(ctx, name, func(x float64) (any, error) {
+			return f(x), nil
+		})
+		return results, true, err
+	}
+	if f, ok := mathFunctions2[name]; ok && arity == 2 {
+		results, err := evalMathArgs(n.Args, ctx, name, func(xs []float64) float64 {
+			return f(xs[0], xs[1])
+		})
+		return results, true, err
+	}
+	if f, ok := mathFunctions3[name]; ok && arity == 3 {
+		results, err := evalMathArgs(n.Args, ctx, name, func(xs []float64) float64 {
+			return f(xs[0], xs[1], xs[2])
+		})
+		return results, true, err
+	}
+	if arity != 0 {
+		return nil, false, nil
+	}
+
+	var results []*types.CandidateNode
+	var err error
+	switch name {
+	case "nan":
+		results = nodesFor(ctx, math.NaN())
+	case "infinite":
+		results = nodesFor(ctx, math.Inf(1))
+	case "isnan":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			return math.IsNaN(x), nil
+		})
+	case "isinfinite":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			return math.IsInf(x, 0), nil
+		})
+	case "isnormal":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			return isNormal(x), nil
+		})
+	case "abs":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			return math.Abs(x), nil
+		})
+	case "frexp":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			frac, exp := math.Frexp(x)
+			return []any{frac, float64(exp)}, nil
+		})
+	case "modf":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			integer, frac := math.Modf(x)
+			return []any{frac, integer}, nil
+		})
+	case "lgamma_r":
+		results, err = mapNumbers(ctx, name, func(x float64) (any, error) {
+			v, sign := math.Lgamma(x)
+			return []any{v, float64(sign)}, nil
+		})
+	default:
+		return nil, false, nil
+	}
+	return results, true, err
+}
+
+// isNormal reports whether x is a normal floating point number: not zero,
+// subnormal, infinite or NaN.
+func isNormal(x float64) bool {
+	if x == 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return false
+	}
+	return math.Abs(x) >= 0x1p-1022
+}
+
+// mapNumbers applies f to each input, which must be a number.
+func mapNumbers(ctx *types.Context, name string, f func(float64) (any, error)) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		x, ok := toNumber(node.Value)
+		if !ok {
+			return nil, fmt.Errorf("%s requires a number, got %s", name, describeValue(node.Value))
+		}
+		v, err := f(x)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(v))
+	}
+	return results, nil
+}
+
+// evalMathArgs evaluates the arguments of a math builtin for each input and
+// applies f to every combination of their outputs, first argument outermost.
+func evalMathArgs(args []parser.ExpressionNode, ctx *types.Context, name string, f func([]float64) float64) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		operands := make([][]float64, len(args))
+		for i, arg := range args {
+			values, err := evaluate(arg, nodeCtx)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				x, ok := toNumber(v.Value)
+				if !ok {
+					return nil, fmt.Errorf("%s requires numbers, got %s", name, describeValue(v.Value))
+				}
+				operands[i] = append(operands[i], x)
+			}
+		}
+
+		xs := make([]float64, len(args))
+		var combine func(i int)
+		combine = func(i int) {
+			if i == len(args) {
+				results = append(results, types.NewCandidateNode(f(xs)))
+				return
+			}
+			for _, x := range operands[i] {
+				xs[i] = x
+				combine(i + 1)
+			}
+		}
+		combine(0)
+	}
+	return results, nil
+}
+
+// compareNumbers orders numbers as jq does: NaN sorts below every number,
+// itself included.
+func compareNumbers(a, b float64) int {
+	switch {
+	case math.IsNaN(a):
+		return -1
+	case math.IsNaN(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// JSONCompatible returns v with NaN replaced by null and infinities by the
+// largest finite numbers, which is how jq prints them as JSON. Values
+// without either are returned as they are.
+func JSONCompatible(v any) any {
+	if !hasNonFinite(v) {
+		return v
+	}
+	switch val := v.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(val):
+			return nil
+		case math.IsInf(val, 1):
+			return math.MaxFloat64
+		}
+		return -math.MaxFloat64
+	case []any:
+		out := make([]any, len(val))
+		for i, elem := range val {
+			out[i] = JSONCompatible(elem)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, elem := range val {
+			out[k] = JSONCompatible(elem)
+		}
+		return out
+	}
+	return v
+}
+
+// hasNonFinite reports whether v is or contains NaN or an infinity.
+func hasNonFinite(v any) bool {
+	switch val := v.(type) {
+	case float64:
+		return math.IsNaN(val) || math.IsInf(val, 0)
+	case []any:
+		for _, elem := range val {
+			if hasNonFinite(elem) {
+				return true
+			}
+		}
+	case map[string]any:
+		for _, elem := range val {
+			if hasNonFinite(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,699 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// Path mode
+//
+// Assignment, del, path and paths need to know where in the input the outputs
+// of a filter live, not just their values. evaluatePaths runs a filter in path
+// mode: every output is a CandidateNode whose Path is a concrete location in
+// the input and whose Value is the value found there (null when the location
+// does not exist yet). Only filters that navigate the input can run in path
+// mode; any other filter that produces a value is an invalid path expression.
+
+// pathsOf evaluates expr in path mode with node as the root input.
+func pathsOf(expr parser.ExpressionNode, node *types.CandidateNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	root := &types.CandidateNode{Value: node.Value, Document: node.Document}
+	rootCtx := ctx.Clone()
+	rootCtx.SetMatchingNodes([]*types.CandidateNode{root})
+	return evaluatePaths(expr, rootCtx)
+}
+
+// evaluatePaths evaluates an AST node in path mode.
+func evaluatePaths(node parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	switch n := node.(type) {
+	case *parser.IdentityNode:
+		return ctx.MatchingNodes, nil
+
+	case *parser.FieldAccessNode:
+		sources, err := pathSources(n.From, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []*types.CandidateNode
+		for _, source := range sources {
+			value, err := accessField(source.Value, n.Field)
+			if err != nil {
+				return nil, err
+			}
+			child := source.WithPath(n.Field)
+			child.Value = value
+			results = append(results, child)
+		}
+		return results, nil
+
+	case *parser.IndexAccessNode:
+		sources, err := pathSources(n.From, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []*types.CandidateNode
+		for _, source := range sources {
+			child := source.WithPath(n.Index)
+			child.Value = accessIndex(source.Value, n.Index)
+			results = append(results, child)
+		}
+		return results, nil
+
+	case *parser.DynamicIndexNode:
+		return evalDynamicIndexPaths(n, ctx)
+
+	case *parser.SliceNode:
+		sources, err := pathSources(n.From, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []*types.CandidateNode
+		for _, source := range sources {
+			child := source.WithPath(slicePathElement(n.Start, n.End))
+			child.Value = sliceValue(source.Value, n.Start, n.End)
+			results = append(results, child)
+		}
+		return results, nil
+
+	case *parser.IteratorNode:
+		sources, err := pathSources(n.From, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []*types.CandidateNode
+		for _, source := range sources {
+			items, err := iterateValue(source)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, items...)
+		}
+		return results, nil
+
+	case *parser.RecursiveDescentNode:
+		return evalRecursiveDescent(n, ctx)
+
+	case *parser.PipeNode:
+		leftPaths, leftErr := evaluatePaths(n.Left, ctx)
+		if leftErr != nil && !isBreak(leftErr) {
+			return nil, leftErr
+		}
+		var results []*types.CandidateNode
+		for _, left := range leftPaths {
+			rightCtx := ctx.Clone()
+			rightCtx.SetMatchingNodes([]*types.CandidateNode{left})
+			rightPaths, err := evaluatePaths(n.Right, rightCtx)
+			results = append(results, rightPaths...)
+			if err != nil {
+				return pathResults(results, err)
+			}
+		}
+		return results, leftErr
+
+	case *parser.CommaNode:
+		var results []*types.CandidateNode
+		for _, expr := range n.Expressions {
+			exprPaths, err := evaluatePaths(expr, ctx)
+			results = append(results, exprPaths...)
+			if err != nil {
+				return pathResults(results, err)
+			}
+		}
+		return results, nil
+
+	case *parser.ConditionalNode:
+		var results []*types.CandidateNode
+		for _, node := range ctx.MatchingNodes {
+			ok, err := holdsFor(n.Condition, node, ctx)
+			if err != nil {
+				return nil, err
+			}
+			branch := n.Else
+			if ok {
+				branch = n.Then
+			}
+			branchCtx := ctx.Clone()
+			branchCtx.SetMatchingNodes([]*types.CandidateNode{node})
+			branchPaths, err := evaluatePaths(branch, branchCtx)
+			results = append(results, branchPaths...)
+			if err != nil {
+				return pathResults(results, err)
+			}
+		}
+		return results, nil
+
+	case *parser.AlternativeNode:
+		// Paths of the left side whose values are truthy, or else the right side
+		leftPaths, err := evaluatePaths(n.Left, ctx)
+		var truthy []*types.CandidateNode
+		for _, left := range leftPaths {
+			if isTruthy(left.Value) {
+				truthy = append(truthy, left)
+			}
+		}
+		if isBreak(err) {
+			return truthy, err
+		}
+		if err == nil && len(truthy) > 0 {
+			return truthy, nil
+		}
+		return evaluatePaths(n.Right, ctx)
+
+	case *parser.OptionalNode:
+		results, err := evaluatePaths(n.Expr, ctx)
+		if err != nil && !isBreak(err) {
+			return []*types.CandidateNode{}, nil
+		}
+		return results, err
+
+	case *parser.TryCatchNode:
+		results, err := evaluatePaths(n.Try, ctx)
+		if err == nil || isBreak(err) {
+			return results, err
+		}
+		if n.Catch != nil {
+			return evaluatePaths(n.Catch, ctx)
+		}
+		return []*types.CandidateNode{}, nil
+
+	case *parser.VariableBindNode:
+		var results []*types.CandidateNode
+		for _, node := range ctx.MatchingNodes {
+			values, err := applyTo(n.Expr, node, ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				bodyCtx := ctx.Clone()
+				bodyCtx.SetMatchingNodes([]*types.CandidateNode{node})
+				bodyCtx.Variables[n.VarName] = value.Value
+				bodyPaths, err := evaluatePaths(n.Body, bodyCtx)
+				results = append(results, bodyPaths...)
+				if err != nil {
+					return pathResults(results, err)
+				}
+			}
+		}
+		return results, nil
+
+	case *parser.DestructureBindNode:
+		var results []*types.CandidateNode
+		for _, node := range ctx.MatchingNodes {
+			values, err := applyTo(n.Expr, node, ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				err := bindPatterns(n.Patterns, value.Value, ctx, func(bound *types.Context) error {
+					bodyCtx := bound.Clone()
+					bodyCtx.SetMatchingNodes([]*types.CandidateNode{node})
+					bodyPaths, err := evaluatePaths(n.Body, bodyCtx)
+					results = append(results, bodyPaths...)
+					return err
+				})
+				if err != nil {
+					return pathResults(results, err)
+				}
+			}
+		}
+		return results, nil
+
+	case *parser.FunctionDefNode:
+		scope := ctx.Clone()
+		scope.Functions[types.FunctionKey(n.Name, len(n.Params))] = &types.FunctionDef{
+			Params: n.Params,
+			Body:   n.Body,
+			Scope:  scope,
+		}
+		return evaluatePaths(n.Rest, scope)
+
+	case *parser.LabelNode:
+		var results []*types.CandidateNode
+		for _, node := range ctx.MatchingNodes {
+			scope := &labelScope{name: n.Name}
+			labelCtx := ctx.Clone()
+			labelCtx.SetMatchingNodes([]*types.CandidateNode{node})
+			labelCtx.Variables[labelVarPrefix+n.Name] = scope
+			bodyPaths, err := evaluatePaths(n.Body, labelCtx)
+			results = append(results, bodyPaths...)
+			if err != nil && !isBreakFor(err, scope) {
+				return pathResults(results, err)
+			}
+		}
+		return results, nil
+
+	case *parser.BreakNode:
+		return evalBreak(n, ctx)
+
+	case *parser.FunctionCallNode:
+		return evalFunctionCallPaths(n, ctx)
+	}
+
+	return invalidPath(node, ctx)
+}
+
+// pathSources returns the path-mode sources of a postfix access: the paths of
+// from, or the current nodes when there is no from.
+func pathSources(from parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	if from == nil {
+		return ctx.MatchingNodes, nil
+	}
+	return evaluatePaths(from, ctx)
+}
+
+// pathResults returns the paths collected before a break alongside it, and
+// drops them for any other error.
+func pathResults(results []*types.CandidateNode, err error) ([]*types.CandidateNode, error) {
+	if err != nil && !isBreak(err) {
+		return nil, err
+	}
+	return results, err
+}
+
+// evalDynamicIndexPaths evaluates .[expr] in path mode.
+func evalDynamicIndexPaths(n *parser.DynamicIndexNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	sources, err := pathSources(n.From, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*types.CandidateNode
+	for _, source := range sources {
+		indexResults, err := applyTo(n.Index, source, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, indexResult := range indexResults {
+			var child *types.CandidateNode
+			switch idx := indexResult.Value.(type) {
+			case string:
+				value, err := accessField(source.Value, idx)
+				if err != nil {
+					return nil, err
+				}
+				child = source.WithPath(idx)
+				child.Value = value
+			case float64:
+				child = source.WithPath(int(idx))
+				child.Value = accessIndex(source.Value, int(idx))
+			default:
+				return nil, fmt.Errorf("index must be string or number, got %T", indexResult.Value)
+			}
+			results = append(results, child)
+		}
+	}
+
+	return results, nil
+}
+
+// evalFunctionCallPaths evaluates the builtins that can be used as path
+// expressions, and user-defined functions, in path mode.
+func evalFunctionCallPaths(n *parser.FunctionCallNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	if fn, ok := ctx.GetFunction(n.Name, len(n.Args)); ok {
+		return callUserFunctionPaths(fn, n.Args, ctx)
+	}
+
+	switch {
+	case n.Name == "empty":
+		return []*types.CandidateNode{}, nil
+
+	case n.Name == "select" && len(n.Args) == 1,
+		n.Name == "objects", n.Name == "arrays", n.Name == "strings", n.Name == "numbers",
+		n.Name == "booleans", n.Name == "nulls", n.Name == "scalars", n.Name == "iterables":
+		// Filters that pass their input through keep its path
+		return evalFunctionCall(n, ctx)
+
+	case n.Name == "getpath" && len(n.Args) == 1:
+		var results []*types.CandidateNode
+		for _, node := range ctx.MatchingNodes {
+			pathResults, err := applyTo(n.Args[0], node, ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range pathResults {
+				pathArr, ok := p.Value.([]any)
+				if !ok {
+					return nil, fmt.Errorf("getpath: path must be an array")
+				}
+				value, err := getPath(node.Value, pathArr)
+				if err != nil {
+					return nil, err
+				}
+				child := node
+				for _, elem := range pathArr {
+					child = child.WithPath(normalizePathElement(elem))
+				}
+				child.Value = value
+				results = append(results, child)
+			}
+		}
+		return results, nil
+
+	case (n.Name == "first" || n.Name == "last") && len(n.Args) == 0:
+		// first and last are .[0] and .[-1]
+		index := 0
+		if n.Name == "last" {
+			index = -1
+		}
+		return evaluatePaths(&parser.IndexAccessNode{Index: index}, ctx)
+
+	case n.Name == "first" && len(n.Args) == 1:
+		results, err := evaluatePaths(n.Args[0], ctx)
+		if err != nil || len(results) == 0 {
+			return results, err
+		}
+		return results[:1], nil
+
+	case n.Name == "last" && len(n.Args) == 1:
+		results, err := evaluatePaths(n.Args[0], ctx)
+		if err != nil || len(results) == 0 {
+			return results, err
+		}
+		return results[len(results)-1:], nil
+
+	case n.Name == "limit" && len(n.Args) == 2:
+		counts, err := evaluate(n.Args[0], ctx)
+		if err != nil {
+			return nil, err
+		}
+		var results []*types.CandidateNode
+		for _, c := range counts {
+			limit, ok := toNumber(c.Value)
+			if !ok {
+				return nil, fmt.Errorf("limit requires a number, got %T", c.Value)
+			}
+			if limit <= 0 {
+				continue
+			}
+			limited, err := evaluatePaths(n.Args[1], ctx)
+			if err != nil {
+				return nil, err
+			}
+			if int(limit) < len(limited) {
+				limited = limited[:int(limit)]
+			}
+			results = append(results, limited...)
+		}
+		return results, nil
+
+	case n.Name == "recurse" && len(n.Args) <= 2:
+		var expr, cond parser.ExpressionNode
+		if len(n.Args) > 0 {
+			expr = n.Args[0]
+		}
+		if len(n.Args) > 1 {
+			cond = n.Args[1]
+		}
+		var results []*types.CandidateNode
+		err := evalRecursePaths(expr, cond, ctx, func(node *types.CandidateNode) error {
+			results = append(results, node)
+			return nil
+		})
+		return pathResults(results, err)
+	}
+
+	return invalidPath(n, ctx)
+}
+
+// evalRecursePaths is recurse(EXPR; COND) in path mode: EXPR is followed in
+// path mode, and COND is evaluated on the values found.
+func evalRecursePaths(expr, cond parser.ExpressionNode, ctx *types.Context, emit func(*types.CandidateNode) error) error {
+	var visit func(node *types.CandidateNode) error
+	visit = func(node *types.CandidateNode) error {
+		if err := emit(node); err != nil {
+			return err
+		}
+
+		var children []*types.CandidateNode
+		var err error
+		if expr == nil {
+			switch node.Value.(type) {
+			case []any, map[string]any:
+				children, err = iterateValue(node)
+			}
+		} else {
+			childCtx := ctx.Clone()
+			childCtx.SetMatchingNodes([]*types.CandidateNode{node})
+			children, err = evaluatePaths(expr, childCtx)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, child := range children {
+			if cond != nil {
+				ok, err := holdsFor(cond, child, ctx)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					continue
+				}
+			}
+			if err := visit(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, node := range ctx.MatchingNodes {
+		if err := visit(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callUserFunctionPaths calls a user-defined function in path mode.
+func callUserFunctionPaths(fn *types.FunctionDef, args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	err := bindFunctionArgs(fn, args, ctx, func(callCtx *types.Context) error {
+		bodyPaths, err := evaluatePaths(fn.Body, callCtx)
+		results = append(results, bodyPaths...)
+		return err
+	})
+	return pathResults(results, err)
+}
+
+// invalidPath evaluates a filter that cannot be followed in path mode. It is
+// only an error if the filter produces a value; a filter with no outputs
+// (such as error) behaves as it would outside path mode.
+func invalidPath(node parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	results, err := evaluate(node, ctx)
+	if len(results) > 0 {
+		return nil, fmt.Errorf("invalid path expression with result %s", formatPathResult(results[0].Value))
+	}
+	return nil, err
+}
+
+// formatPathResult formats a value for an invalid path expression error.
+func formatPathResult(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// pathToArray converts a node path into an hq array value.
+func pathToArray(path []any) []any {
+	arr := make([]any, len(path))
+	for i, p := range path {
+		if idx, ok := p.(int); ok {
+			arr[i] = float64(idx)
+		} else {
+			arr[i] = p
+		}
+	}
+	return arr
+}
+
+// slicePathElement returns the path element of .[start:end], an object with
+// start and end keys as in jq. A missing bound is null.
+func slicePathElement(start, end *int) map[string]any {
+	elem := map[string]any{"start": nil, "end": nil}
+	if start != nil {
+		elem["start"] = float64(*start)
+	}
+	if end != nil {
+		elem["end"] = float64(*end)
+	}
+	return elem
+}
+
+// sliceBounds resolves a slice path element against a length, counting
+// negative bounds from the end and clamping both into [0, length].
+func sliceBounds(elem map[string]any, length int) (int, int, error) {
+	bound := func(key string, def int) (int, error) {
+		v, ok := elem[key]
+		if !ok || v == nil {
+			return def, nil
+		}
+		num, ok := toNumber(v)
+		if !ok {
+			return 0, fmt.Errorf("array slice %s must be a number, got %T", key, v)
+		}
+		i := int(math.Floor(num))
+		if i < 0 {
+			i += length
+		}
+		return min(max(i, 0), length), nil
+	}
+
+	start, err := bound("start", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := bound("end", length)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, max(start, end), nil
+}
+
+// getSlicePath returns the part of an array or string that a slice path
+// element refers to.
+func getSlicePath(value any, elem map[string]any) (any, error) {
+	switch v := value.(type) {
+	case []any:
+		start, end, err := sliceBounds(elem, len(v))
+		if err != nil {
+			return nil, err
+		}
+		return v[start:end], nil
+	case string:
+		start, end, err := sliceBounds(elem, utf8.RuneCountInString(v))
+		if err != nil {
+			return nil, err
+		}
+		return sliceString(v, start, end), nil
+	}
+	return nil, fmt.Errorf("cannot index %T with object", value)
+}
+
+// setSlicePath replaces the part of an array that a slice path element refers
+// to with the elements of newValue, which must be an array.
+func setSlicePath(value any, elem map[string]any, newValue any) (any, error) {
+	if value == nil {
+		value = []any{}
+	}
+	arr, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("cannot update slice of %T", value)
+	}
+	replacement, ok := newValue.([]any)
+	if !ok {
+		return nil, fmt.Errorf("a slice of an array can only be assigned another array, got %T", newValue)
+	}
+	start, end, err := sliceBounds(elem, len(arr))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]any, 0, len(arr)-(end-start)+len(replacement))
+	result = append(result, copySlice(arr[:start])...)
+	result = append(result, replacement...)
+	result = append(result, copySlice(arr[end:])...)
+	return result, nil
+}
+
+// updatePaths replaces the value at each path with f applied to it. Paths are
+// updated in order, each one seeing the result of the updates before it. A
+// path that an earlier update made unreachable, by replacing one of its
+// parents with a scalar, is skipped. Paths for which f reports no value are
+// deleted once all updates are done.
+func updatePaths(value any, paths []*types.CandidateNode, f func(any) (any, bool, error)) (any, error) {
+	var deleted [][]any
+	for _, p := range paths {
+		current, err := getPath(value, p.Path)
+		if err != nil {
+			continue
+		}
+		newValue, ok, err := f(current)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			deleted = append(deleted, p.Path)
+			continue
+		}
+		value, err = setPath(value, p.Path, newValue)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(deleted) > 0 {
+		return deletePaths(value, deleted)
+	}
+	return value, nil
+}
+
+// deletePaths removes the values at all of the given paths. Paths are deleted
+// from the last to the first in sorted order, so deleting an array element
+// does not shift the elements other paths refer to.
+func deletePaths(value any, paths [][]any) (any, error) {
+	sorted := make([][]any, len(paths))
+	for i, p := range paths {
+		normalized := make([]any, len(p))
+		for j, elem := range p {
+			normalized[j] = normalizePathElement(elem)
+		}
+		sorted[i] = normalized
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePaths(sorted[i], sorted[j]) < 0
+	})
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if i < len(sorted)-1 && comparePaths(sorted[i], sorted[i+1]) == 0 {
+			continue
+		}
+		var err error
+		value, err = deletePath(value, sorted[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// comparePaths orders paths element by element, numbers before strings, with
+// a path sorting before the paths it is a prefix of.
+func comparePaths(a, b []any) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ai, aIsInt := a[i].(int)
+		bi, bIsInt := b[i].(int)
+		switch {
+		case aIsInt && bIsInt:
+			if ai != bi {
+				if ai < bi {
+					return -1
+				}
+				return 1
+			}
+		case aIsInt:
+			return -1
+		case bIsInt:
+			return 1
+		default:
+			if c := compareValues(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,416 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// The regex builtins take a pattern and optional jq flags, either as two
+// arguments, test("a"; "gi"), or as one array, test(["a", "gi"]). The flags
+// are:
+//
+//	g  every match, not just the first
+//	i  case insensitive
+//	x  extended: whitespace and # comments in the pattern are ignored
+//	n  ignore empty matches
+//	s  single line: ^ and $ match at the ends of the string (the default)
+//	p  as s, and . also matches newlines
+//	l  longest matches instead of leftmost-first ones
+//
+// Offsets and lengths in match objects count code points.
+
+const regexFlagChars = "gixnslp"
+
+// regexOptions are the flags that apply to matching rather than compiling.
+type regexOptions struct {
+	global    bool
+	skipEmpty bool
+}
+
+// regexArgs evaluates the pattern and flags of a regex builtin. args is
+// (RE), (RE; FLAGS) or ([RE, FLAGS]); a null FLAGS means none.
+func regexArgs(name string, args []parser.ExpressionNode, ctx *types.Context) (string, string, error) {
+	results, err := evaluate(args[0], ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if len(results) == 0 {
+		return "", "", fmt.Errorf("%s: pattern produced no value", name)
+	}
+
+	var patternValue, flagsValue any
+	if arr, ok := results[0].Value.([]any); ok {
+		if len(args) > 1 {
+			return "", "", fmt.Errorf("%s: flags cannot be given both in the array and as an argument", name)
+		}
+		if len(arr) < 1 || len(arr) > 2 {
+			return "", "", fmt.Errorf("%s: array argument must be [pattern] or [pattern, flags]", name)
+		}
+		patternValue = arr[0]
+		if len(arr) == 2 {
+			flagsValue = arr[1]
+		}
+	} else {
+		patternValue = results[0].Value
+		if len(args) > 1 {
+			flagResults, err := evaluate(args[1], ctx)
+			if err != nil {
+				return "", "", err
+			}
+			if len(flagResults) == 0 {
+				return "", "", fmt.Errorf("%s: flags produced no value", name)
+			}
+			flagsValue = flagResults[0].Value
+		}
+	}
+
+	pattern, ok := patternValue.(string)
+	if !ok {
+		return "", "", fmt.Errorf("%s: pattern must be a string, got %s", name, typeName(patternValue))
+	}
+	var flags string
+	if flagsValue != nil {
+		if flags, ok = flagsValue.(string); !ok {
+			return "", "", fmt.Errorf("%s: flags must be a string, got %s", name, typeName(flagsValue))
+		}
+	}
+	return pattern, flags, nil
+}
+
+// compileRegex compiles pattern with flags. Compiled patterns are cached in
+// the context for the rest of the evaluation.
+func compileRegex(name, pattern, flags string, ctx *types.Context) (*regexp.Regexp, regexOptions, error) {
+	var opts regexOptions
+	var prefix string
+	var extended, longest bool
+	for _, f := range flags {
+		switch f {
+		case 'g':
+			opts.global = true
+		case 'n':
+			opts.skipEmpty = true
+		case 'i':
+			prefix += "i"
+		case 'p':
+			prefix += "s"
+		case 'x':
+			extended = true
+		case 'l':
+			longest = true
+		case 's':
+		default:
+			return nil, opts, fmt.Errorf("%s: %q is not a valid modifier string, flags are %q", name, flags, regexFlagChars)
+		}
+	}
+
+	key := flags + "/" + pattern
+	if re, ok := ctx.Regexps[key]; ok {
+		return re, opts, nil
+	}
+
+	expr := pattern
+	if extended {
+		expr = stripExtended(expr)
+	}
+	if prefix != "" {
+		expr = "(?" + prefix + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, opts, fmt.Errorf("%s: invalid regex: %w", name, err)
+	}
+	if longest {
+		re.Longest()
+	}
+	if ctx.Regexps != nil {
+		ctx.Regexps[key] = re
+	}
+	return re, opts, nil
+}
+
+// stripExtended removes the whitespace and # comments that the x flag
+// ignores. Escaped characters and character classes are kept as written.
+func stripExtended(pattern string) string {
+	var sb strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			sb.WriteByte(c)
+			i++
+			sb.WriteByte(pattern[i])
+			continue
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '#':
+			for i < len(pattern) && pattern[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// findMatches returns the submatch indices of the first match of re in s,
+// or of every match with the g flag.
+func findMatches(re *regexp.Regexp, s string, opts regexOptions) [][]int {
+	n := 1
+	if opts.global {
+		n = -1
+	}
+	matches := re.FindAllStringSubmatchIndex(s, n)
+	if !opts.skipEmpty {
+		return matches
+	}
+	kept := matches[:0]
+	for _, m := range matches {
+		if m[1] > m[0] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// regexInput returns the input of a regex builtin as a string.
+func regexInput(name string, node *types.CandidateNode) (string, error) {
+	s, ok := node.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: input must be a string, got %s", name, describeValue(node.Value))
+	}
+	return s, nil
+}
+
+// runeOffset converts a byte offset in s to a code point offset.
+func runeOffset(s string, i int) float64 {
+	return float64(utf8.RuneCountInString(s[:i]))
+}
+
+// matchObject builds the jq match object for the submatch indices m.
+func matchObject(re *regexp.Regexp, s string, m []int) map[string]any {
+	names := re.SubexpNames()
+	captures := make([]any, 0, len(names)-1)
+	for i := 1; i < len(m)/2; i++ {
+		start, end := m[2*i], m[2*i+1]
+		var name any
+		if names[i] != "" {
+			name = names[i]
+		}
+		if start == -1 {
+			captures = append(captures, map[string]any{
+				"offset": float64(-1),
+				"length": float64(0),
+				"string": nil,
+				"name":   name,
+			})
+			continue
+		}
+		captures = append(captures, map[string]any{
+			"offset": runeOffset(s, start),
+			"length": float64(utf8.RuneCountInString(s[start:end])),
+			"string": s[start:end],
+			"name":   name,
+		})
+	}
+	return map[string]any{
+		"offset":   runeOffset(s, m[0]),
+		"length":   float64(utf8.RuneCountInString(s[m[0]:m[1]])),
+		"string":   s[m[0]:m[1]],
+		"captures": captures,
+	}
+}
+
+// captureObject maps the named groups of a match to the text they matched,
+// or null for groups that took no part in it.
+func captureObject(re *regexp.Regexp, s string, m []int) map[string]any {
+	obj := make(map[string]any)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if m[2*i] == -1 {
+			obj[name] = nil
+			continue
+		}
+		obj[name] = s[m[2*i]:m[2*i+1]]
+	}
+	return obj
+}
+
+// evalRegex evaluates the pattern and flags of a regex builtin, then calls
+// f for each input with its matches.
+func evalRegex(name string, args []parser.ExpressionNode, ctx *types.Context, forceGlobal bool,
+	f func(re *regexp.Regexp, s string, matches [][]int, opts regexOptions) ([]*types.CandidateNode, error)) ([]*types.CandidateNode, error) {
+	pattern, flags, err := regexArgs(name, args, ctx)
+	if err != nil {
+		return nil, err
+	}
+	re, opts, err := compileRegex(name, pattern, flags, ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts.global = opts.global || forceGlobal
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		s, err := regexInput(name, node)
+		if err != nil {
+			return nil, err
+		}
+		out, err := f(re, s, findMatches(re, s, opts), opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, out...)
+	}
+	return results, nil
+}
+
+// evalTest evaluates test(RE), test(RE; FLAGS) and test([RE, FLAGS]).
+func evalTest(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return evalRegex("test", args, ctx, false, func(_ *regexp.Regexp, _ string, matches [][]int, _ regexOptions) ([]*types.CandidateNode, error) {
+		return []*types.CandidateNode{types.NewCandidateNode(len(matches) > 0)}, nil
+	})
+}
+
+// evalMatch evaluates match: a match object for the first match, or null
+// if there is none. With the g flag there is one object per match.
+func evalMatch(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return evalRegex("match", args, ctx, false, func(re *regexp.Regexp, s string, matches [][]int, opts regexOptions) ([]*types.CandidateNode, error) {
+		if len(matches) == 0 && !opts.global {
+			return []*types.CandidateNode{types.NewCandidateNode(nil)}, nil
+		}
+		results := make([]*types.CandidateNode, len(matches))
+		for i, m := range matches {
+			results[i] = types.NewCandidateNode(matchObject(re, s, m))
+		}
+		return results, nil
+	})
+}
+
+// evalCapture evaluates capture: an object of the named groups of the first
+// match, or null if there is none. With the g flag there is one per match.
+func evalCapture(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return evalRegex("capture", args, ctx, false, func(re *regexp.Regexp, s string, matches [][]int, opts regexOptions) ([]*types.CandidateNode, error) {
+		if len(matches) == 0 && !opts.global {
+			return []*types.CandidateNode{types.NewCandidateNode(nil)}, nil
+		}
+		results := make([]*types.CandidateNode, len(matches))
+		for i, m := range matches {
+			results[i] = types.NewCandidateNode(captureObject(re, s, m))
+		}
+		return results, nil
+	})
+}
+
+// evalScan evaluates scan(RE) and scan(RE; FLAGS): every match, as the
+// matched text, or as an array of the groups' text if RE has groups.
+func evalScan(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return evalRegex("scan", args, ctx, true, func(re *regexp.Regexp, s string, matches [][]int, _ regexOptions) ([]*types.CandidateNode, error) {
+		results := make([]*types.CandidateNode, len(matches))
+		for i, m := range matches {
+			if re.NumSubexp() == 0 {
+				results[i] = types.NewCandidateNode(s[m[0]:m[1]])
+				continue
+			}
+			groups := make([]any, re.NumSubexp())
+			for g := range groups {
+				if start := m[2*g+2]; start != -1 {
+					groups[g] = s[start:m[2*g+3]]
+				}
+			}
+			results[i] = types.NewCandidateNode(groups)
+		}
+		return results, nil
+	})
+}
+
+// evalRegexSplit evaluates split(RE; FLAGS), an array of the parts of the
+// input between matches, and splits(RE) and splits(RE; FLAGS), which emit
+// the parts one at a time.
+func evalRegexSplit(name string, args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return evalRegex(name, args, ctx, true, func(_ *regexp.Regexp, s string, matches [][]int, _ regexOptions) ([]*types.CandidateNode, error) {
+		parts := make([]any, 0, len(matches)+1)
+		prev := 0
+		for _, m := range matches {
+			parts = append(parts, s[prev:m[0]])
+			prev = m[1]
+		}
+		parts = append(parts, s[prev:])
+
+		if name == "split" {
+			return []*types.CandidateNode{types.NewCandidateNode(parts)}, nil
+		}
+		results := make([]*types.CandidateNode, len(parts))
+		for i, p := range parts {
+			results[i] = types.NewCandidateNode(p)
+		}
+		return results, nil
+	})
+}
+
+// evalSub evaluates sub(RE; STR), sub(RE; STR; FLAGS) and gsub, which always
+// replaces every match. STR is evaluated with the match's capture object as
+// its input, so "\(.name)" refers to a named group; \1 in its result refers
+// to a numbered one. Each output of STR gives a result.
+func evalSub(name string, args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	regexArgList := []parser.ExpressionNode{args[0]}
+	if len(args) == 3 {
+		regexArgList = append(regexArgList, args[2])
+	}
+	replacement := args[1]
+
+	return evalRegex(name, regexArgList, ctx, name == "gsub", func(re *regexp.Regexp, s string, matches [][]int, _ regexOptions) ([]*types.CandidateNode, error) {
+		// Build every combination of replacement outputs, match by match
+		partials := []string{""}
+		prev := 0
+		for _, m := range matches {
+			outputs, err := applyTo(replacement, types.NewCandidateNode(captureObject(re, s, m)), ctx)
+			if err != nil {
+				return nil, err
+			}
+			var next []string
+			for _, p := range partials {
+				for _, out := range outputs {
+					str, ok := out.Value.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s: replacement must be a string, got %s", name, typeName(out.Value))
+					}
+					expanded := re.ExpandString(nil, convertBackreferences(str), s, m)
+					next = append(next, p+s[prev:m[0]]+string(expanded))
+				}
+			}
+			partials = next
+			prev = m[1]
+		}
+
+		results := make([]*types.CandidateNode, len(partials))
+		for i, p := range partials {
+			results[i] = types.NewCandidateNode(p + s[prev:])
+		}
+		return results, nil
+	})
+}
+
+// convertBackreferences converts jq-style backreferences (\1, \2) to Go style ($1, $2)
+func convertBackreferences(replacement string) string {
+	result := replacement
+	// Convert \0-\9 to $0-$9
+	for i := 9; i >= 0; i-- {
+		old := fmt.Sprintf("\\%d", i)
+		new := fmt.Sprintf("${%d}", i)
+		result = strings.ReplaceAll(result, old, new)
+	}
+	return result
+}
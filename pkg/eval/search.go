@@ -0,0 +1,361 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// evalQuantifier evaluates any and all with 0, 1 or 2 arguments:
+// any, any(COND) and any(GEN; COND), and the same for all. Without GEN the
+// elements of the input are used, and without COND their own truthiness.
+// Evaluation stops at the first value that decides the result.
+func evalQuantifier(name string, args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var gen, cond parser.ExpressionNode
+	switch len(args) {
+	case 0:
+	case 1:
+		cond = args[0]
+	case 2:
+		gen, cond = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("%s requires 0 to 2 arguments", name)
+	}
+	// any stops at the first truthy value, all at the first falsy one
+	decisive := name == "any"
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		scope := &labelScope{name: name}
+		check := func(v *types.CandidateNode) error {
+			if cond == nil {
+				if isTruthy(v.Value) == decisive {
+					return &breakError{scope: scope}
+				}
+				return nil
+			}
+			condCtx := nodeCtx.Clone()
+			condCtx.SetMatchingNodes([]*types.CandidateNode{v})
+			return evaluateEach(cond, condCtx, func(c *types.CandidateNode) error {
+				if isTruthy(c.Value) == decisive {
+					return &breakError{scope: scope}
+				}
+				return nil
+			})
+		}
+
+		var err error
+		if gen != nil {
+			err = evaluateEach(gen, nodeCtx, check)
+		} else {
+			err = eachElement(node, name, check)
+		}
+
+		switch {
+		case isBreakFor(err, scope):
+			results = append(results, types.NewCandidateNode(decisive))
+		case err != nil:
+			return nil, err
+		default:
+			results = append(results, types.NewCandidateNode(!decisive))
+		}
+	}
+	return results, nil
+}
+
+// eachElement passes each element of an array or value of an object to f.
+func eachElement(node *types.CandidateNode, name string, f func(*types.CandidateNode) error) error {
+	switch node.Value.(type) {
+	case []any, map[string]any:
+	default:
+		return fmt.Errorf("%s requires an array or object, got %s", name, typeName(node.Value))
+	}
+	children, err := iterateValue(node)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := f(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalIsValid evaluates isvalid(EXPR): true if EXPR can be evaluated on the
+// input without an error, as getpath can for an existing path. Only the
+// first output of EXPR is computed.
+func evalIsValid(expr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		scope := &labelScope{name: "isvalid"}
+		err := evaluateEach(expr, nodeCtx, func(*types.CandidateNode) error {
+			return &breakError{scope: scope}
+		})
+		switch {
+		case err == nil || isBreakFor(err, scope):
+			results = append(results, types.NewCandidateNode(true))
+		case isBreak(err):
+			return nil, err
+		default:
+			results = append(results, types.NewCandidateNode(false))
+		}
+	}
+	return results, nil
+}
+
+// evalIndices evaluates indices(S), index(S) and rindex(S). For strings the
+// offsets count code points; for arrays S may be an element or a subarray.
+// Overlapping matches are all reported.
+func evalIndices(name string, arg parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+		targets, err := evaluate(arg, nodeCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, target := range targets {
+			found, err := findIndices(node.Value, target.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+
+			var result any
+			switch {
+			case found == nil:
+			case name == "indices":
+				result = found
+			case len(found) == 0:
+			case name == "index":
+				result = found[0]
+			default:
+				result = found[len(found)-1]
+			}
+			results = append(results, types.NewCandidateNode(result))
+		}
+	}
+	return results, nil
+}
+
+// findIndices returns the offsets of target in v, or nil if v is null.
+func findIndices(v, target any) ([]any, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		sub, ok := target.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot search a string for %s", typeName(target))
+		}
+		found := []any{}
+		if sub == "" {
+			return found, nil
+		}
+		runes := 0
+		for i := range val {
+			if strings.HasPrefix(val[i:], sub) {
+				found = append(found, float64(runes))
+			}
+			runes++
+		}
+		return found, nil
+	case []any:
+		sub, ok := target.([]any)
+		if !ok {
+			sub = []any{target}
+		}
+		found := []any{}
+		if len(sub) == 0 {
+			return found, nil
+		}
+		for i := 0; i+len(sub) <= len(val); i++ {
+			if equals(val[i:i+len(sub)], sub) {
+				found = append(found, float64(i))
+			}
+		}
+		return found, nil
+	}
+	return nil, fmt.Errorf("cannot search %s", typeName(v))
+}
+
+// evalIN evaluates IN(S), true if the input is one of the outputs of S,
+// and IN(SRC; S), true if any output of SRC is an output of S.
+func evalIN(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var src, set parser.ExpressionNode
+	switch len(args) {
+	case 1:
+		set = args[0]
+	case 2:
+		src, set = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("IN requires 1 or 2 arguments")
+	}
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		scope := &labelScope{name: "IN"}
+		member := func(v *types.CandidateNode) error {
+			return evaluateEach(set, nodeCtx, func(s *types.CandidateNode) error {
+				if equals(v.Value, s.Value) {
+					return &breakError{scope: scope}
+				}
+				return nil
+			})
+		}
+
+		var err error
+		if src != nil {
+			err = evaluateEach(src, nodeCtx, member)
+		} else {
+			err = member(node)
+		}
+
+		switch {
+		case isBreakFor(err, scope):
+			results = append(results, types.NewCandidateNode(true))
+		case err != nil:
+			return nil, err
+		default:
+			results = append(results, types.NewCandidateNode(false))
+		}
+	}
+	return results, nil
+}
+
+// evalINDEX evaluates INDEX(IDX) and INDEX(STREAM; IDX): an object of the
+// rows of STREAM (the elements of the input by default), keyed by IDX as a
+// string. Later rows replace earlier ones with the same key.
+func evalINDEX(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	var stream, idx parser.ExpressionNode
+	switch len(args) {
+	case 1:
+		idx = args[0]
+	case 2:
+		stream, idx = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("INDEX requires 1 or 2 arguments")
+	}
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		index := make(map[string]any)
+		add := func(row *types.CandidateNode) error {
+			keys, err := applyTo(idx, row, nodeCtx)
+			if err != nil {
+				return err
+			}
+			for _, k := range keys {
+				index[interpolateToString(k.Value)] = row.Value
+			}
+			return nil
+		}
+
+		var err error
+		if stream != nil {
+			err = evaluateEach(stream, nodeCtx, add)
+		} else {
+			err = eachElement(node, "INDEX", add)
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(index))
+	}
+	return results, nil
+}
+
+// evalJOIN evaluates the SQL-style joins against an index object built
+// with INDEX:
+//
+//	JOIN($idx; IDX)              [.[] | [., $idx[IDX]]]
+//	JOIN($idx; STREAM; IDX)      STREAM | [., $idx[IDX]]
+//	JOIN($idx; STREAM; IDX; F)   STREAM | [., $idx[IDX]] | F
+func evalJOIN(args []parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return nil, fmt.Errorf("JOIN requires 2 to 4 arguments")
+	}
+
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		nodeCtx := ctx.Clone()
+		nodeCtx.SetMatchingNodes([]*types.CandidateNode{node})
+
+		idxExpr := args[1]
+		if len(args) > 2 {
+			idxExpr = args[2]
+		}
+
+		indexes, err := evaluate(args[0], nodeCtx)
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			obj, ok := index.Value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("JOIN requires an index object, got %s", typeName(index.Value))
+			}
+
+			var pairs []*types.CandidateNode
+			pair := func(row *types.CandidateNode) error {
+				keys, err := applyTo(idxExpr, row, nodeCtx)
+				if err != nil {
+					return err
+				}
+				for _, k := range keys {
+					key, ok := k.Value.(string)
+					if !ok {
+						return fmt.Errorf("JOIN index keys must be strings, got %s", typeName(k.Value))
+					}
+					pairs = append(pairs, types.NewCandidateNode([]any{row.Value, obj[key]}))
+				}
+				return nil
+			}
+
+			switch len(args) {
+			case 2:
+				if err := eachElement(node, "JOIN", pair); err != nil {
+					return nil, err
+				}
+				rows := make([]any, len(pairs))
+				for i, p := range pairs {
+					rows[i] = p.Value
+				}
+				results = append(results, types.NewCandidateNode(rows))
+			case 3:
+				if err := evaluateEach(args[1], nodeCtx, pair); err != nil {
+					return nil, err
+				}
+				results = append(results, pairs...)
+			case 4:
+				if err := evaluateEach(args[1], nodeCtx, pair); err != nil {
+					return nil, err
+				}
+				for _, p := range pairs {
+					joined, err := applyTo(args[3], p, nodeCtx)
+					if err != nil {
+						return nil, err
+					}
+					results = append(results, joined...)
+				}
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,233 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
+
+// Strings are sequences of Unicode code points: length, slices, explode and
+// the offsets of indices all count code points, never bytes.
+
+// mapStrings applies f to each input, which must be a string.
+func mapStrings(ctx *types.Context, name string, f func(string) (any, error)) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		s, ok := node.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s requires a string, got %s", name, describeValue(node.Value))
+		}
+		v, err := f(s)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, types.NewCandidateNode(v))
+	}
+	return results, nil
+}
+
+// sliceString returns the code points of s from start up to end, which
+// are already clamped to the string's length in code points.
+func sliceString(s string, start, end int) string {
+	if isASCII(s) {
+		return s[start:end]
+	}
+	return string([]rune(s)[start:end])
+}
+
+// isASCII reports whether s has no multi-byte characters, so that byte
+// and code point offsets agree.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// evalExplode evaluates explode: a string as an array of its code points.
+func evalExplode(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapStrings(ctx, "explode", func(s string) (any, error) {
+		codes := make([]any, 0, len(s))
+		for _, r := range s {
+			codes = append(codes, float64(r))
+		}
+		return codes, nil
+	})
+}
+
+// evalImplode evaluates implode: an array of code points as a string.
+func evalImplode(ctx *types.Context) ([]*types.CandidateNode, error) {
+	var results []*types.CandidateNode
+	for _, node := range ctx.MatchingNodes {
+		codes, ok := node.Value.([]any)
+		if !ok {
+			return nil, fmt.Errorf("implode requires an array of code points, got %s", describeValue(node.Value))
+		}
+		var sb strings.Builder
+		for _, c := range codes {
+			r, err := codePoint(c)
+			if err != nil {
+				return nil, fmt.Errorf("implode: %w", err)
+			}
+			sb.WriteRune(r)
+		}
+		results = append(results, types.NewCandidateNode(sb.String()))
+	}
+	return results, nil
+}
+
+// codePoint converts a number to the rune it encodes, rejecting surrogates
+// and values outside the Unicode range.
+func codePoint(v any) (rune, error) {
+	n, ok := toNumber(v)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a code point", describeValue(v))
+	}
+	r := rune(n)
+	if float64(r) != n || !utf8.ValidRune(r) {
+		return 0, fmt.Errorf("%s is not a valid code point", describeValue(v))
+	}
+	return r, nil
+}
+
+// evalASCII evaluates ascii: a code point from 0 to 127 as a one-character string.
+func evalASCII(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapNumbers(ctx, "ascii", func(x float64) (any, error) {
+		if x < 0 || x > unicode.MaxASCII || x != float64(int(x)) {
+			return nil, fmt.Errorf("ascii requires a code point from 0 to 127, got %s", describeValue(x))
+		}
+		return string(rune(x)), nil
+	})
+}
+
+// evalUTF8ByteLength evaluates utf8bytelength: the number of bytes a string
+// takes in UTF-8.
+func evalUTF8ByteLength(ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapStrings(ctx, "utf8bytelength", func(s string) (any, error) {
+		return float64(len(s)), nil
+	})
+}
+
+// evalTrimstr evaluates trimstr(S): the input without S at either end.
+func evalTrimstr(strExpr parser.ExpressionNode, ctx *types.Context) ([]*types.CandidateNode, error) {
+	trim, err := stringArg("trimstr", "argument", strExpr, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mapStrings(ctx, "trimstr", func(s string) (any, error) {
+		s = strings.TrimPrefix(s, trim)
+		return strings.TrimSuffix(s, trim), nil
+	})
+}
+
+// evalTrimSpace evaluates ltrim and rtrim: the input without leading or
+// trailing whitespace.
+func evalTrimSpace(name string, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapStrings(ctx, name, func(s string) (any, error) {
+		if name == "ltrim" {
+			return strings.TrimLeftFunc(s, unicode.IsSpace), nil
+		}
+		return strings.TrimRightFunc(s, unicode.IsSpace), nil
+	})
+}
+
+// evalCase evaluates downcase and upcase with the full Unicode case
+// mappings, in which a character may become several: "ß" upcases to "SS".
+func evalCase(name string, ctx *types.Context) ([]*types.CandidateNode, error) {
+	return mapStrings(ctx, name, func(s string) (any, error) {
+		if name == "downcase" {
+			return downcase(s), nil
+		}
+		return upcase(s), nil
+	})
+}
+
+// specialUpper holds the unconditional upper case mappings of
+// SpecialCasing.txt that expand to more than one character.
+var specialUpper = map[rune]string{
+	'ß': "SS",
+	'ŉ': "\u02BCN",
+	'ǰ': "J\u030C",
+	'ΐ': "\u0399\u0308\u0301",
+	'ΰ': "\u03A5\u0308\u0301",
+	'և': "ԵՒ",
+	'ẖ': "H\u0331",
+	'ẗ': "T\u0308",
+	'ẘ': "W\u030A",
+	'ẙ': "Y\u030A",
+	'ẚ': "A\u02BE",
+	'ﬀ': "FF",
+	'ﬁ': "FI",
+	'ﬂ': "FL",
+	'ﬃ': "FFI",
+	'ﬄ': "FFL",
+	'ﬅ': "ST",
+	'ﬆ': "ST",
+	'ﬓ': "ՄՆ",
+	'ﬔ': "ՄԵ",
+	'ﬕ': "ՄԻ",
+	'ﬖ': "ՎՆ",
+	'ﬗ': "ՄԽ",
+}
+
+func upcase(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if special, ok := specialUpper[r]; ok {
+			sb.WriteString(special)
+			continue
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// downcase lower-cases s. "İ" keeps its dot as a combining character, and
+// a capital sigma at the end of a word becomes a final sigma.
+func downcase(s string) string {
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == 'İ':
+			sb.WriteString("i\u0307")
+		case r == 'Σ' && endsWord(runes, i):
+			sb.WriteRune('ς')
+		default:
+			sb.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return sb.String()
+}
+
+// endsWord reports whether the character at i follows a letter and is not
+// followed by one, the Final_Sigma condition.
+func endsWord(runes []rune, i int) bool {
+	return i > 0 && unicode.IsLetter(runes[i-1]) &&
+		(i+1 == len(runes) || !unicode.IsLetter(runes[i+1]))
+}
+
+// asciiDowncase and asciiUpcase change the case of A-Z and a-z only.
+func asciiDowncase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+func asciiUpcase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - ('a' - 'A')
+		}
+		return r
+	}, s)
+}
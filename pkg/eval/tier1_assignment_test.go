@@ -120,6 +120,94 @@ lastName: "Smith"
 fullName: "Alice Smith"
 `)},
 		},
+		{
+			Description: "set through select",
+			Document: huml(`
+users::
+  - ::
+    name: "Alice"
+    role: "admin"
+    active: true
+  - ::
+    name: "Bob"
+    role: "user"
+    active: true
+`),
+			Expression: `(.users[] | select(.role == "admin") | .active) = false`,
+			Expected:   []string{`{"users": [{"name": "Alice", "role": "admin", "active": false}, {"name": "Bob", "role": "user", "active": true}]}`},
+		},
+		{
+			Description: "set several paths",
+			Document:    `{"a": 1, "b": 2, "c": 3}`,
+			Expression:  `(.a, .c) = 0`,
+			Expected:    []string{`{"a": 0, "b": 2, "c": 0}`},
+		},
+		{
+			Description: "value is evaluated against the input",
+			Document:    `{"default": 5, "items": [1, 2]}`,
+			Expression:  `.items[] = .default`,
+			Expected:    []string{`{"default": 5, "items": [5, 5]}`},
+		},
+		{
+			Description: "set every string via recursive descent",
+			Document:    `{"a": "x", "b": [1, "y"]}`,
+			Expression:  `(.. | strings) = "redacted"`,
+			Expected:    []string{`{"a": "redacted", "b": [1, "redacted"]}`},
+		},
+		{
+			Description: "one output per value",
+			Document:    `{"a": 0}`,
+			Expression:  `.a = (1, 2)`,
+			Expected:    []string{`{"a": 1}`, `{"a": 2}`},
+		},
+		{
+			Description: "empty value produces no output",
+			Document:    `{"a": 0}`,
+			Expression:  `[.a = empty]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "each output sets every path",
+			Document:    `{"a": 0, "b": 0}`,
+			Expression:  `[(.a, .b) = (1, 2)]`,
+			Expected:    []string{`[{"a": 1, "b": 1}, {"a": 2, "b": 2}]`},
+		},
+		{
+			Description:   "set invalid path",
+			Document:      `{"a": 1}`,
+			Expression:    `(.a | tostring) = 2`,
+			ExpectedError: "invalid path expression",
+		},
+		{
+			Description: "assign to a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `.[1:3] = ["x"]`,
+			Expected:    []string{`[1, "x", 4]`},
+		},
+		{
+			Description: "assign into an element of a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `.[1:3][0] = 9`,
+			Expected:    []string{`[1, 9, 3, 4]`},
+		},
+		{
+			Description:   "assign a non-array to a slice",
+			Document:      `[1, 2, 3]`,
+			Expression:    `.[1:] = 5`,
+			ExpectedError: "a slice of an array can only be assigned another array",
+		},
+		{
+			Description: "assignment after a pipe",
+			Document:    `null`,
+			Expression:  `{} | .a = 1`,
+			Expected:    []string{`{"a": 1}`},
+		},
+		{
+			Description: "pipe binds looser than assignment on both sides",
+			Document:    `{"a": 1}`,
+			Expression:  `.a = 2 | .b = 3`,
+			Expected:    []string{`{"a": 2, "b": 3}`},
+		},
 	},
 }
 
@@ -195,6 +283,78 @@ status: "pending"
 status: "active"
 `)},
 		},
+		{
+			Description: "update to empty deletes the field",
+			Document:    `{"a": 1, "b": 2}`,
+			Expression:  `.a |= empty`,
+			Expected:    []string{`{"b": 2}`},
+		},
+		{
+			Description: "update to empty deletes matching elements",
+			Document:    `[1, 5, 2, 8, 3]`,
+			Expression:  `(.[] | select(. > 2)) |= empty`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "update to empty selectively",
+			Document:    `{"a": 1, "b": null, "c": 3}`,
+			Expression:  `.[] |= select(. != null)`,
+			Expected:    []string{`{"a": 1, "c": 3}`},
+		},
+		{
+			Description: "update uses the first output",
+			Document:    `{"a": 1}`,
+			Expression:  `.a |= (. + 1, . + 2)`,
+			Expected:    []string{`{"a": 2}`},
+		},
+		{
+			Description: "update several paths",
+			Document:    `{"a": 1, "b": 2}`,
+			Expression:  `(.a, .b) |= . * 10`,
+			Expected:    []string{`{"a": 10, "b": 20}`},
+		},
+		{
+			Description: "update selected elements",
+			Document:    `[1, 5, 2, 8]`,
+			Expression:  `(.[] | select(. > 4)) |= . * 100`,
+			Expected:    []string{`[1, 500, 2, 800]`},
+		},
+		{
+			Description: "update with alternative path",
+			Document:    `{"b": 1}`,
+			Expression:  `(.a // .b) |= . + 1`,
+			Expected:    []string{`{"b": 2}`},
+		},
+		{
+			Description: "update through if-then-else",
+			Document:    `{"legacy": true, "old": 1, "new": 1}`,
+			Expression:  `(if .legacy then .old else .new end) |= . + 1`,
+			Expected:    []string{`{"legacy": true, "old": 2, "new": 1}`},
+		},
+		{
+			Description: "update first match",
+			Document:    `[{"id": 1}, {"id": 2}, {"id": 2}]`,
+			Expression:  `first(.[] | select(.id == 2)) |= . + {"hit": true}`,
+			Expected:    []string{`[{"id": 1}, {"id": 2, "hit": true}, {"id": 2}]`},
+		},
+		{
+			Description: "update a nested slice",
+			Document:    `{"a": [1, 2, 3]}`,
+			Expression:  `.a[1:] |= map(. * 10)`,
+			Expected:    []string{`{"a": [1, 20, 30]}`},
+		},
+		{
+			Description: "update a slice from the end",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `.[-2:] |= reverse`,
+			Expected:    []string{`[1, 2, 4, 3]`},
+		},
+		{
+			Description: "update after a pipe",
+			Document:    `null`,
+			Expression:  `{} | .a |= 1`,
+			Expected:    []string{`{"a": 1}`},
+		},
 	},
 }
 
@@ -250,6 +410,97 @@ config:
   port: 8080
 `)},
 		},
+		{
+			Description: "add to selected elements",
+			Document:    `{"items": [{"n": 1, "on": true}, {"n": 2, "on": false}]}`,
+			Expression:  `(.items[] | select(.on) | .n) += 10`,
+			Expected:    []string{`{"items": [{"n": 11, "on": true}, {"n": 2, "on": false}]}`},
+		},
+		{
+			Description: "right side is evaluated against the input",
+			Document:    `{"step": 5, "values": [1, 2]}`,
+			Expression:  `.values[] += .step`,
+			Expected:    []string{`{"step": 5, "values": [6, 7]}`},
+		},
+		{
+			Description: "add-assign on a piped value",
+			Document:    `{"x": {"a": 1}}`,
+			Expression:  `.x | .a += 1`,
+			Expected:    []string{`{"a": 2}`},
+		},
+	},
+}
+
+var arithmeticUpdateScenarios = ScenarioGroup{
+	Name:        "arithmetic-update",
+	Description: "Arithmetic update operators (-=, *=, /=, %=, //=)",
+	Scenarios: []Scenario{
+		{
+			Description: "subtract-assign",
+			Document:    `{"count": 10}`,
+			Expression:  `.count -= 3`,
+			Expected:    []string{`{"count": 7}`},
+		},
+		{
+			Description: "subtract-assign removes array elements",
+			Document:    `{"tags": ["a", "b", "c"]}`,
+			Expression:  `.tags -= ["b"]`,
+			Expected:    []string{`{"tags": ["a", "c"]}`},
+		},
+		{
+			Description: "multiply-assign",
+			Document:    `{"price": 4}`,
+			Expression:  `.price *= 2.5`,
+			Expected:    []string{`{"price": 10}`},
+		},
+		{
+			Description: "divide-assign",
+			Document:    `{"ms": 1500}`,
+			Expression:  `.ms /= 1000`,
+			Expected:    []string{`{"ms": 1.5}`},
+		},
+		{
+			Description: "divide-assign every element",
+			Document:    `[10, 20, 30]`,
+			Expression:  `.[] /= 10`,
+			Expected:    []string{`[1, 2, 3]`},
+		},
+		{
+			Description: "modulo-assign",
+			Document:    `{"n": 17}`,
+			Expression:  `.n %= 5`,
+			Expected:    []string{`{"n": 2}`},
+		},
+		{
+			Description: "alternative-assign sets missing values",
+			Document:    `{"a": 1, "b": null}`,
+			Expression:  `(.a, .b, .c) //= 0`,
+			Expected:    []string{`{"a": 1, "b": 0, "c": 0}`},
+		},
+		{
+			Description: "alternative-assign replaces false",
+			Document:    `{"enabled": false}`,
+			Expression:  `.enabled //= true`,
+			Expected:    []string{`{"enabled": true}`},
+		},
+		{
+			Description: "right side is evaluated against the input",
+			Document:    `{"total": 200, "share": 50}`,
+			Expression:  `.share /= .total`,
+			Expected:    []string{`{"total": 200, "share": 0.25}`},
+		},
+		{
+			Description: "one output per right side value",
+			Document:    `{"n": 10}`,
+			Expression:  `.n += (1, 2)`,
+			Expected:    []string{`{"n": 11}`, `{"n": 12}`},
+		},
+		{
+			Description:   "divide-assign by zero",
+			Document:      `{"n": 1}`,
+			Expression:    `.n /= 0`,
+			ExpectedError: "division by zero",
+		},
 	},
 }
 
@@ -335,6 +586,48 @@ name: "Alice"
 name: "Alice"
 `)},
 		},
+		{
+			Description: "delete several array elements",
+			Document:    `["a", "b", "c", "d"]`,
+			Expression:  `del(.[0], .[2])`,
+			Expected:    []string{`["b", "d"]`},
+		},
+		{
+			Description: "delete matching object values",
+			Document:    `{"a": {"x": true}, "b": {"x": false}, "c": {"x": true}}`,
+			Expression:  `del(.[] | select(.x))`,
+			Expected:    []string{`{"b": {"x": false}}`},
+		},
+		{
+			Description: "delete nested matches",
+			Document:    `{"users": [{"name": "a", "tmp": 1}, {"name": "b", "tmp": 2}]}`,
+			Expression:  `del(.users[].tmp)`,
+			Expected:    []string{`{"users": [{"name": "a"}, {"name": "b"}]}`},
+		},
+		{
+			Description: "delete every null",
+			Document:    `{"a": null, "b": [1, null, 2], "c": {"d": null}}`,
+			Expression:  `del(.. | nulls)`,
+			Expected:    []string{`{"b": [1, 2], "c": {}}`},
+		},
+		{
+			Description: "delete through user function",
+			Document:    `{"name": "db", "password": "x", "replica": {"name": "r", "password": "y"}}`,
+			Expression:  `def everywhere(f): .. | objects | f; del(everywhere(.password))`,
+			Expected:    []string{`{"name": "db", "replica": {"name": "r"}}`},
+		},
+		{
+			Description:   "delete invalid path",
+			Document:      `{"a": 1}`,
+			Expression:    `del(1)`,
+			ExpectedError: "invalid path expression with result 1",
+		},
+		{
+			Description: "delete a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `del(.[1:3])`,
+			Expected:    []string{`[1, 4]`},
+		},
 	},
 }
 
@@ -350,6 +643,10 @@ func TestAddAssignScenarios(t *testing.T) {
 	runScenarios(t, addAssignScenarios)
 }
 
+func TestArithmeticUpdateScenarios(t *testing.T) {
+	runScenarios(t, arithmeticUpdateScenarios)
+}
+
 func TestDeleteScenarios(t *testing.T) {
 	runScenarios(t, deleteScenarios)
 }
@@ -80,6 +80,89 @@ users:
 			Expression:  `{}`,
 			Expected:    []string{`{}`},
 		},
+		{
+			Description: "multi-output value produces one object per output",
+			Document:    `{"users": [{"name": "Alice"}, {"name": "Bob"}]}`,
+			Expression:  `{name: .users[].name}`,
+			Expected:    []string{`{"name": "Alice"}`, `{"name": "Bob"}`},
+		},
+		{
+			Description: "multi-output key",
+			Document:    `{"a": "x", "b": "y"}`,
+			Expression:  `{(.a, .b): 1}`,
+			Expected:    []string{`{"x": 1}`, `{"y": 1}`},
+		},
+		{
+			Description: "cartesian product of fields",
+			Document:    `null`,
+			Expression:  `{a: (1, 2), b: (3, 4)}`,
+			Expected: []string{
+				`{"a": 1, "b": 3}`,
+				`{"a": 1, "b": 4}`,
+				`{"a": 2, "b": 3}`,
+				`{"a": 2, "b": 4}`,
+			},
+		},
+		{
+			Description: "empty value produces no object",
+			Document:    `{"a": 1}`,
+			Expression:  `[{a: .a, b: empty}]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "object per input",
+			Document:    `[1, 2]`,
+			Expression:  `[.[] as $x | {x: $x}] | length`,
+			Expected:    []string{`2`},
+		},
+		{
+			Description: "variable shorthand",
+			Document:    `null`,
+			Expression:  `"Alice" as $name | 30 as $age | {$name, $age}`,
+			Expected:    []string{`{"name": "Alice", "age": 30}`},
+		},
+		{
+			Description: "variable value as key",
+			Document:    `null`,
+			Expression:  `"region" as $k | {$k: "eu"}`,
+			Expected:    []string{`{"region": "eu"}`},
+		},
+		{
+			Description: "interpolated key",
+			Document:    `{"env": "prod", "port": 8080}`,
+			Expression:  `{"\(.env)_port": .port}`,
+			Expected:    []string{`{"prod_port": 8080}`},
+		},
+		{
+			Description: "quoted key shorthand",
+			Document:    `{"pool size": 10, "other": 1}`,
+			Expression:  `{"pool size"}`,
+			Expected:    []string{`{"pool size": 10}`},
+		},
+		{
+			Description: "format key",
+			Document:    `{"user": "admin"}`,
+			Expression:  `{@base64 "\(.user)": true}`,
+			Expected:    []string{`{"YWRtaW4=": true}`},
+		},
+		{
+			Description: "keyword keys",
+			Document:    `{"if": "x", "then": "y"}`,
+			Expression:  `{if: 1, end: 2, then}`,
+			Expected:    []string{`{"if": 1, "end": 2, "then": "y"}`},
+		},
+		{
+			Description:   "non-string key",
+			Document:      `null`,
+			Expression:    `{(1): 2}`,
+			ExpectedError: "object key must be a string",
+		},
+		{
+			Description: "interpolated key with several outputs",
+			Document:    `{"envs": ["dev", "prod"]}`,
+			Expression:  `{"\(.envs[])_port": 80}`,
+			Expected:    []string{`{"dev_port": 80}`, `{"prod_port": 80}`},
+		},
 	},
 }
 
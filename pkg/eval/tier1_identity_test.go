@@ -147,6 +147,75 @@ name: "Alice"
 			Expression: `.["123"]`,
 			Expected:   []string{`"value"`},
 		},
+		{
+			Description: "quoted field with a dash",
+			Document: huml(`
+database:
+  "pool-size": 10
+`),
+			Expression: `.database."pool-size"`,
+			Expected:   []string{`10`},
+		},
+		{
+			Description: "quoted field at the start",
+			Document:    `{"first name": "Alice"}`,
+			Expression:  `."first name"`,
+			Expected:    []string{`"Alice"`},
+		},
+		{
+			Description: "interpolated quoted field",
+			Document:    `{"env": "prod", "prod-url": "https://example.com"}`,
+			Expression:  `."\(.env)-url"`,
+			Expected:    []string{`"https://example.com"`},
+		},
+		{
+			Description: "interpolated bracket key",
+			Document:    `{"env": "prod", "prod-url": "https://example.com"}`,
+			Expression:  `.["\(.env)-url"]`,
+			Expected:    []string{`"https://example.com"`},
+		},
+		{
+			Description: "keyword field names",
+			Document:    `{"if": {"end": 1}, "as": 2, "not": 3, "empty": 4}`,
+			Expression:  `.if.end, .as, .not, .empty`,
+			Expected:    []string{`1`, `2`, `3`, `4`},
+		},
+		{
+			Description: "keyword field inside a conditional",
+			Document:    `{"start": 1, "end": 5}`,
+			Expression:  `if .start < .end then .end else .start end`,
+			Expected:    []string{`5`},
+		},
+		{
+			Description: "dot before a keyword is still the identity",
+			Document:    `{"a": 1}`,
+			Expression:  `. as $x | $x.a`,
+			Expected:    []string{`1`},
+		},
+		{
+			Description: "quoted and keyword fields on a variable",
+			Document:    `{"pool-size": 10, "end": 20}`,
+			Expression:  `. as $c | [$c."pool-size", $c.end]`,
+			Expected:    []string{`[10, 20]`},
+		},
+		{
+			Description: "field after an optional bracket",
+			Document:    `{"a": {"b": 1}}`,
+			Expression:  `.["a"]?.b`,
+			Expected:    []string{`1`},
+		},
+		{
+			Description:   "trailing dot",
+			Document:      `{"a": 1}`,
+			Expression:    `.a.`,
+			ExpectedError: "expected field name after . at line 1, column 3",
+		},
+		{
+			Description:   "number after a dot",
+			Document:      `{"a": 1}`,
+			Expression:    `.a.1`,
+			ExpectedError: "expected field name after ., got 1 at line 1, column 4",
+		},
 	},
 }
 
@@ -139,6 +139,30 @@ d: 4
 			Expression: `((.a + .b) * (.c + .d))`,
 			Expected:   []string{`21`},
 		},
+		{
+			Description: "field access on a parenthesized expression",
+			Document:    `{"primary": null, "fallback": {"host": "db"}}`,
+			Expression:  `(.primary // .fallback).host`,
+			Expected:    []string{`"db"`},
+		},
+		{
+			Description: "index into a function result",
+			Document:    `{"b": 1, "a": 2}`,
+			Expression:  `keys[0]`,
+			Expected:    []string{`"a"`},
+		},
+		{
+			Description: "index into a constructed array",
+			Document:    `null`,
+			Expression:  `[10, 20, 30][1]`,
+			Expected:    []string{`20`},
+		},
+		{
+			Description: "optional suffix on a parenthesized expression",
+			Document:    `"text"`,
+			Expression:  `[(.a)?]`,
+			Expected:    []string{`[]`},
+		},
 	},
 }
 
@@ -223,6 +223,12 @@ var comparisonScenarios = ScenarioGroup{
 			Expression:  `. == 43`,
 			Expected:    []string{`false`},
 		},
+		{
+			Description: "equality of arrays and objects",
+			Document:    `{"a": [1, {"b": 2}]}`,
+			Expression:  `. == {"a": [1, {"b": 2}]}, .a == [1, {"b": 3}], .a == [1]`,
+			Expected:    []string{`true`, `false`, `false`},
+		},
 		{
 			Description: "inequality true",
 			Document:    `42`,
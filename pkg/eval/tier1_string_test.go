@@ -41,6 +41,30 @@ name: "ALICE"
 			Expression: `.name | ascii_downcase`,
 			Expected:   []string{`"alice"`},
 		},
+		{
+			Description: "ascii_upcase leaves non-ASCII letters alone",
+			Document:    `"straße café"`,
+			Expression:  `ascii_upcase`,
+			Expected:    []string{`"STRAßE CAFé"`},
+		},
+		{
+			Description: "upcase with full case mapping",
+			Document:    `"straße café"`,
+			Expression:  `upcase`,
+			Expected:    []string{`"STRASSE CAFÉ"`},
+		},
+		{
+			Description: "downcase with final sigma",
+			Document:    `"ΟΔΥΣΣΕΥΣ"`,
+			Expression:  `downcase`,
+			Expected:    []string{`"οδυσσευς"`},
+		},
+		{
+			Description:   "downcase a non-string",
+			Document:      `42`,
+			Expression:    `downcase`,
+			ExpectedError: "downcase requires a string, got number (42)",
+		},
 	},
 }
 
@@ -90,6 +114,24 @@ var stringTrimScenarios = ScenarioGroup{
 			Expression:  `trim`,
 			Expected:    []string{`""`},
 		},
+		{
+			Description: "ltrim and rtrim",
+			Document:    `"  hello  "`,
+			Expression:  `ltrim, rtrim`,
+			Expected:    []string{`"hello  "`, `"  hello"`},
+		},
+		{
+			Description: "trimstr at both ends",
+			Document:    `"--value--"`,
+			Expression:  `trimstr("--")`,
+			Expected:    []string{`"value"`},
+		},
+		{
+			Description: "ltrimstr and rtrimstr with multi-byte characters",
+			Document:    `"¿qué?"`,
+			Expression:  `ltrimstr("¿"), rtrimstr("é?")`,
+			Expected:    []string{`"qué?"`, `"¿qu"`},
+		},
 	},
 }
 
@@ -291,6 +333,85 @@ user:
 			Expression: `"User: \(.user.name)"`,
 			Expected:   []string{`"User: Alice"`},
 		},
+		{
+			Description: "one string per combination of outputs",
+			Document:    `null`,
+			Expression:  `"\(1, 2)-\(3, 4)"`,
+			Expected:    []string{`"1-3"`, `"2-3"`, `"1-4"`, `"2-4"`},
+		},
+		{
+			Description: "empty interpolation produces no string",
+			Document:    `null`,
+			Expression:  `["x\(empty)"]`,
+			Expected:    []string{`[]`},
+		},
+	},
+}
+
+var unicodeScenarios = ScenarioGroup{
+	Name:        "unicode",
+	Description: "Strings count and slice by code point",
+	Scenarios: []Scenario{
+		{
+			Description: "length counts code points",
+			Document:    `"Zürich 東京"`,
+			Expression:  `length, utf8bytelength`,
+			Expected:    []string{`9`, `14`},
+		},
+		{
+			Description: "slice by code points",
+			Document:    `"Zürich 東京"`,
+			Expression:  `.[1:3], .[-2:]`,
+			Expected:    []string{`"ür"`, `"東京"`},
+		},
+		{
+			Description: "explode",
+			Document:    `"aé€😀"`,
+			Expression:  `explode`,
+			Expected:    []string{`[97, 233, 8364, 128512]`},
+		},
+		{
+			Description: "implode",
+			Document:    `[97, 233, 8364, 128512]`,
+			Expression:  `implode`,
+			Expected:    []string{`"aé€😀"`},
+		},
+		{
+			Description: "explode and implode round trip",
+			Document:    `"São Paulo"`,
+			Expression:  `explode | map(if . == 227 then 97 else . end) | implode`,
+			Expected:    []string{`"Sao Paulo"`},
+		},
+		{
+			Description:   "implode rejects surrogates",
+			Document:      `[55296]`,
+			Expression:    `implode`,
+			ExpectedError: "implode: number (55296) is not a valid code point",
+		},
+		{
+			Description: "ascii",
+			Document:    `[72, 113]`,
+			Expression:  `map(ascii) | add`,
+			Expected:    []string{`"Hq"`},
+		},
+		{
+			Description:   "ascii out of range",
+			Document:      `233`,
+			Expression:    `ascii`,
+			ExpectedError: "ascii requires a code point from 0 to 127, got number (233)",
+		},
+		{
+			Description:   "utf8bytelength of a non-string",
+			Document:      `[1]`,
+			Expression:    `utf8bytelength`,
+			ExpectedError: "utf8bytelength requires a string, got array ([1])",
+		},
+		{
+			Description: "splits on a regex",
+			Document:    `"a, b;c"`,
+			Expression:  `[splits("[,;] *")]`,
+			Expected:    []string{`["a", "b", "c"]`},
+		},
 	},
 }
 
@@ -313,3 +434,7 @@ func TestStringCheckScenarios(t *testing.T) {
 func TestStringInterpolationScenarios(t *testing.T) {
 	runScenarios(t, stringInterpolationScenarios)
 }
+
+func TestUnicodeScenarios(t *testing.T) {
+	runScenarios(t, unicodeScenarios)
+}
@@ -0,0 +1,147 @@
+package eval
+
+import "testing"
+
+// Codec tests
+// Tier 2 - Important (next 8% of use cases)
+
+var codecScenarios = ScenarioGroup{
+	Name:        "codecs",
+	Description: "tojson/fromjson, tohuml/fromhuml and toyaml/fromyaml encode values to and decode values from strings",
+	Scenarios: []Scenario{
+		{
+			Description: "tojson",
+			Document:    `{"a": [1, "x", null], "b": true}`,
+			Expression:  `tojson`,
+			Expected:    []string{`"{\"a\":[1,\"x\",null],\"b\":true}"`},
+		},
+		{
+			Description: "tojson of a string quotes it",
+			Document:    `"a<b"`,
+			Expression:  `tojson`,
+			Expected:    []string{`"\"a<b\""`},
+		},
+		{
+			Description: "fromjson",
+			Document:    `"{\"replicas\": 3, \"tags\": [\"a\"]}"`,
+			Expression:  `fromjson`,
+			Expected:    []string{`{"replicas": 3, "tags": ["a"]}`},
+		},
+		{
+			Description: "fromjson of an embedded annotation",
+			Document: huml(`
+metadata::
+  annotations::
+    config: "{\"debug\": true, \"level\": 2}"
+`),
+			Expression: `.metadata.annotations.config | fromjson | .level`,
+			Expected:   []string{`2`},
+		},
+		{
+			Description: "update an embedded JSON string",
+			Document:    `{"config": "{\"level\":2}"}`,
+			Expression:  `.config |= (fromjson | (.level += 1) | tojson)`,
+			Expected:    []string{`{"config": "{\"level\":3}"}`},
+		},
+		{
+			Description: "tohuml",
+			Document:    `{"name": "web", "ports": [80, 443]}`,
+			Expression:  `tohuml`,
+			Expected:    []string{`"name: \"web\"\nports::\n  - 80\n  - 443"`},
+		},
+		{
+			Description: "fromhuml",
+			Document:    `"name: \"web\"\nports:: 80, 443"`,
+			Expression:  `fromhuml`,
+			Expected:    []string{`{"name": "web", "ports": [80, 443]}`},
+		},
+		{
+			Description: "fromhuml numbers are numbers",
+			Document:    `"n: 2"`,
+			Expression:  `fromhuml | .n + 1`,
+			Expected:    []string{`3`},
+		},
+		{
+			Description: "toyaml",
+			Document:    `{"a": 1, "b": "x"}`,
+			Expression:  `toyaml`,
+			Expected:    []string{`"a: 1\nb: x"`},
+		},
+		{
+			Description: "fromyaml",
+			Document:    `"replicas: 3\nimage: nginx\nports: [80, 443]"`,
+			Expression:  `fromyaml`,
+			Expected:    []string{`{"replicas": 3, "image": "nginx", "ports": [80, 443]}`},
+		},
+		{
+			Description: "fromyaml keeps dates as strings",
+			Document:    `"released: 2024-01-15"`,
+			Expression:  `fromyaml | .released`,
+			Expected:    []string{`"2024-01-15"`},
+		},
+		{
+			Description: "fromyaml keeps a midnight UTC datetime as written",
+			Document:    `"at: 2024-01-15T00:00:00Z"`,
+			Expression:  `fromyaml | .at`,
+			Expected:    []string{`"2024-01-15T00:00:00Z"`},
+		},
+		{
+			Description: "fromyaml keeps a space-separated datetime as written",
+			Document:    `"at: 2024-01-15 10:00:00"`,
+			Expression:  `fromyaml | .at`,
+			Expected:    []string{`"2024-01-15 10:00:00"`},
+		},
+		{
+			Description: "fromyaml with non-string keys",
+			Document:    `"1: one\n2: two"`,
+			Expression:  `fromyaml | keys`,
+			Expected:    []string{`["1", "2"]`},
+		},
+		{
+			Description: "round trips",
+			Document:    `{"a": [1, {"b": "x"}], "c": null}`,
+			Expression:  `[(tojson | fromjson), (tohuml | fromhuml), (toyaml | fromyaml)] | map(. == {"a": [1, {"b": "x"}], "c": null})`,
+			Expected:    []string{`[true, true, true]`},
+		},
+		{
+			Description: "decode errors can be caught",
+			Document:    `["{\"a\": 1}", "{oops"]`,
+			Expression:  `[.[] | try fromjson catch "invalid"]`,
+			Expected:    []string{`[{"a": 1}, "invalid"]`},
+		},
+		{
+			Description:   "fromjson of invalid JSON",
+			Document:      `"{oops"`,
+			Expression:    `fromjson`,
+			ExpectedError: `cannot parse "{oops" as JSON`,
+		},
+		{
+			Description:   "fromjson rejects trailing data",
+			Document:      `"1 2"`,
+			Expression:    `fromjson`,
+			ExpectedError: "as JSON",
+		},
+		{
+			Description:   "fromyaml of invalid YAML",
+			Document:      `"a: [1"`,
+			Expression:    `fromyaml`,
+			ExpectedError: "as YAML",
+		},
+		{
+			Description:   "fromhuml of invalid HUML",
+			Document:      `"a:: b: c:"`,
+			Expression:    `fromhuml`,
+			ExpectedError: "as HUML",
+		},
+		{
+			Description:   "decoding requires a string",
+			Document:      `{"a": 1}`,
+			Expression:    `fromjson`,
+			ExpectedError: "object ({\"a\":1}) cannot be parsed as JSON, only a string can be",
+		},
+	},
+}
+
+func TestCodecScenarios(t *testing.T) {
+	runScenarios(t, codecScenarios)
+}
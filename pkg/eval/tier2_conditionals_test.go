@@ -147,6 +147,115 @@ values:
 	},
 }
 
+var destructuringScenarios = ScenarioGroup{
+	Name:        "destructuring",
+	Description: "Array, object and nested patterns in as, reduce and foreach, with ?// alternatives",
+	Scenarios: []Scenario{
+		{
+			Description: "array pattern",
+			Document:    `[1, 2, 3]`,
+			Expression:  `. as [$a, $b] | {$a, $b}`,
+			Expected:    []string{`{"a": 1, "b": 2}`},
+		},
+		{
+			Description: "array pattern past the end binds null",
+			Document:    `[1]`,
+			Expression:  `. as [$a, $b] | [$a, $b]`,
+			Expected:    []string{`[1, null]`},
+		},
+		{
+			Description: "nested pattern",
+			Document:    `{"user": {"name": "Alice"}, "tags": ["admin", "ops"]}`,
+			Expression:  `. as {user: {name: $n}, tags: [$first]} | "\($n): \($first)"`,
+			Expected:    []string{`"Alice: admin"`},
+		},
+		{
+			Description: "variable shorthand",
+			Document:    `{"name": "Alice", "age": 30}`,
+			Expression:  `. as {$name, $age} | "\($name) is \($age)"`,
+			Expected:    []string{`"Alice is 30"`},
+		},
+		{
+			Description: "variable key with a nested pattern binds both",
+			Document:    `{"server": {"host": "db", "port": 5432}}`,
+			Expression:  `. as {$server: {$port}} | [$server.host, $port]`,
+			Expected:    []string{`["db", 5432]`},
+		},
+		{
+			Description: "computed key",
+			Document:    `{"key": "port", "port": 8080}`,
+			Expression:  `. as {(.key): $v} | $v`,
+			Expected:    []string{`8080`},
+		},
+		{
+			Description: "computed key using an earlier variable",
+			Document:    `{"primary": "eu", "eu": "https://eu.example.com"}`,
+			Expression:  `. as {primary: $p, ($p): $url} | $url`,
+			Expected:    []string{`"https://eu.example.com"`},
+		},
+		{
+			Description: "string and keyword keys",
+			Document:    `{"pool-size": 10, "end": 20}`,
+			Expression:  `. as {"pool-size": $size, end: $end} | $size + $end`,
+			Expected:    []string{`30`},
+		},
+		{
+			Description: "destructuring each output",
+			Document:    `[[1, 2], [3, 4]]`,
+			Expression:  `.[] as [$a, $b] | $a * $b`,
+			Expected:    []string{`2`, `12`},
+		},
+		{
+			Description: "pattern in reduce",
+			Document:    `[{"name": "a", "n": 1}, {"name": "b", "n": 2}]`,
+			Expression:  `reduce .[] as {$name, $n} ({}; .[$name] = $n)`,
+			Expected:    []string{`{"a": 1, "b": 2}`},
+		},
+		{
+			Description: "pattern in foreach",
+			Document:    `[[1, 2], [3, 4]]`,
+			Expression:  `[foreach .[] as [$a, $b] (0; . + $a * $b)]`,
+			Expected:    []string{`[2, 14]`},
+		},
+		{
+			Description: "alternative patterns",
+			Document:    `[{"a": 1}, [2]]`,
+			Expression:  `[.[] as {a: $x} ?// [$x] | $x]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "variables of other alternatives are null",
+			Document:    `[[3]]`,
+			Expression:  `.[] as [$a] ?// {b: $b} | {$a, $b}`,
+			Expected:    []string{`{"a": 3, "b": null}`},
+		},
+		{
+			Description: "an error in the body tries the next alternative",
+			Document:    `[[3]]`,
+			Expression:  `.[] as [$a] ?// [$b] | if $a != null then error("err: \($a)") else {$a, $b} end`,
+			Expected:    []string{`{"a": null, "b": 3}`},
+		},
+		{
+			Description: "alternatives in reduce",
+			Document:    `[1, [2], {"v": 3}]`,
+			Expression:  `reduce .[] as [$x] ?// {v: $x} ?// $x (0; . + $x)`,
+			Expected:    []string{`6`},
+		},
+		{
+			Description:   "error from the last alternative",
+			Document:      `"str"`,
+			Expression:    `. as [$a] ?// {a: $a} | $a`,
+			ExpectedError: "cannot index string",
+		},
+		{
+			Description:   "array pattern on an object",
+			Document:      `{"a": 1}`,
+			Expression:    `. as [$a] | $a`,
+			ExpectedError: "cannot index map[string]interface {} with number",
+		},
+	},
+}
+
 var recursiveDescentScenarios = ScenarioGroup{
 	Name:        "recursive-descent",
 	Description: "Recursive descent operator (..)",
@@ -209,6 +318,110 @@ children:
 	},
 }
 
+var recursiveUpdateScenarios = ScenarioGroup{
+	Name:        "recursive-update",
+	Description: "Updating every value with .. |= f",
+	Scenarios: []Scenario{
+		{
+			Description: "lowercase every string",
+			Document: huml(`
+name: "Web"
+tags:
+  - "PROD"
+  - "Edge"
+db:
+  host: "DB.LOCAL"
+  port: 5432
+`),
+			Expression: `.. |= (if type == "string" then ascii_downcase else . end)`,
+			Expected:   []string{`{"name": "web", "tags": ["prod", "edge"], "db": {"host": "db.local", "port": 5432}}`},
+		},
+		{
+			Description: "increment every number",
+			Document:    `{"a": 1, "b": [2, {"c": 3}]}`,
+			Expression:  `.. |= (if type == "number" then . + 1 else . end)`,
+			Expected:    []string{`{"a": 2, "b": [3, {"c": 4}]}`},
+		},
+		{
+			Description: "parents are updated before children",
+			Document:    `{"a": {"b": 1}}`,
+			Expression:  `.. |= (if type == "object" then . + {"seen": true} else . end)`,
+			Expected:    []string{`{"a": {"b": 1, "seen": true}, "seen": true}`},
+		},
+		{
+			Description: "recursive add-assign on a scalar",
+			Document:    `5`,
+			Expression:  `.. += 1`,
+			Expected:    []string{`6`},
+		},
+		{
+			Description: "recursive descent values keep their paths",
+			Document:    `{"a": [1, 2]}`,
+			Expression:  `[.. | numbers] | length`,
+			Expected:    []string{`2`},
+		},
+	},
+}
+
+var walkScenarios = ScenarioGroup{
+	Name:        "walk",
+	Description: "Bottom-up transformation of every value with walk(f)",
+	Scenarios: []Scenario{
+		{
+			Description: "lowercase every string",
+			Document:    `{"Name": "ALICE", "tags": ["A", "B"]}`,
+			Expression:  `walk(if type == "string" then ascii_downcase else . end)`,
+			Expected:    []string{`{"Name": "alice", "tags": ["a", "b"]}`},
+		},
+		{
+			Description: "drop every null",
+			Document: huml(`
+name: "svc"
+owner: null
+ports:
+  - 80
+  - null
+  - 443
+db:
+  host: "localhost"
+  password: null
+`),
+			Expression: `walk(select(. != null))`,
+			Expected:   []string{`{"name": "svc", "ports": [80, 443], "db": {"host": "localhost"}}`},
+		},
+		{
+			Description: "children are walked before their parent",
+			Document:    `[[3, 1], [2]]`,
+			Expression:  `walk(if type == "array" then sort else . end)`,
+			Expected:    []string{`[[1, 3], [2]]`},
+		},
+		{
+			Description: "rebuild objects",
+			Document:    `{"a": {"b": 1}}`,
+			Expression:  `walk(if type == "object" then with_entries(.key |= ascii_upcase) else . end)`,
+			Expected:    []string{`{"A": {"B": 1}}`},
+		},
+		{
+			Description: "scalars are passed to f",
+			Document:    `3`,
+			Expression:  `walk(. * 2)`,
+			Expected:    []string{`6`},
+		},
+		{
+			Description: "array elements take every output",
+			Document:    `[1, 2]`,
+			Expression:  `walk(if type == "number" then ., . * 10 else . end)`,
+			Expected:    []string{`[1, 10, 2, 20]`},
+		},
+		{
+			Description: "object values are walked in key order",
+			Document:    `{"c": 3, "a": 1, "b": 2}`,
+			Expression:  `try walk(if type == "number" then error(tostring) else . end) catch .`,
+			Expected:    []string{`"1"`},
+		},
+	},
+}
+
 var reduceScenarios = ScenarioGroup{
 	Name:        "reduce",
 	Description: "reduce for aggregation",
@@ -273,6 +486,78 @@ var reduceScenarios = ScenarioGroup{
 	},
 }
 
+var foreachScenarios = ScenarioGroup{
+	Name:        "foreach",
+	Description: "Emit every intermediate state with foreach EXPR as $x (INIT; UPDATE; EXTRACT)",
+	Scenarios: []Scenario{
+		{
+			Description: "running total",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `foreach .[] as $x (0; . + $x)`,
+			Expected:    []string{`1`, `3`, `6`, `10`},
+		},
+		{
+			Description: "running total collected",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `[foreach .[] as $x (0; . + $x)]`,
+			Expected:    []string{`[1, 3, 6, 10]`},
+		},
+		{
+			Description: "extract clause",
+			Document:    `[1, 2, 3]`,
+			Expression:  `[foreach .[] as $x (0; . + $x; [$x, .])]`,
+			Expected:    []string{`[[1, 1], [2, 3], [3, 6]]`},
+		},
+		{
+			Description: "extract with empty skips outputs",
+			Document:    `[1, 2, 3, 4, 5]`,
+			Expression:  `[foreach .[] as $x (0; . + $x; if . % 2 == 0 then . else empty end)]`,
+			Expected:    []string{`[6, 10]`},
+		},
+		{
+			Description: "stateful scan over config list",
+			Document: huml(`
+ports::
+  - ::
+    name: "http"
+    port: 80
+  - ::
+    name: "https"
+    port: 443
+  - ::
+    name: "http"
+    port: 8080
+`),
+			Expression: `[foreach .ports[] as $p ({}; .[$p.name] += 1; {name: $p.name, seen: .[$p.name]})]`,
+			Expected:   []string{`[{"name": "http", "seen": 1}, {"name": "https", "seen": 1}, {"name": "http", "seen": 2}]`},
+		},
+		{
+			Description: "state is an object",
+			Document:    `["a", "b", "a"]`,
+			Expression:  `foreach .[] as $x ({}; .[$x] = true) | keys`,
+			Expected:    []string{`["a"]`, `["a", "b"]`, `["a", "b"]`},
+		},
+		{
+			Description: "iterator over range of values",
+			Document:    `null`,
+			Expression:  `[foreach (1, 2, 3) as $x (1; . * $x)]`,
+			Expected:    []string{`[1, 2, 6]`},
+		},
+		{
+			Description: "empty input produces no output",
+			Document:    `[]`,
+			Expression:  `[foreach .[] as $x (0; . + $x)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description:   "missing update clause",
+			Document:      `[]`,
+			Expression:    `foreach .[] as $x (0)`,
+			ExpectedError: "expected (init; update) or (init; update; extract) in foreach",
+		},
+	},
+}
+
 func TestConditionalScenarios(t *testing.T) {
 	runScenarios(t, conditionalScenarios)
 }
@@ -281,10 +566,26 @@ func TestVariableScenarios(t *testing.T) {
 	runScenarios(t, variableScenarios)
 }
 
+func TestDestructuringScenarios(t *testing.T) {
+	runScenarios(t, destructuringScenarios)
+}
+
 func TestRecursiveDescentScenarios(t *testing.T) {
 	runScenarios(t, recursiveDescentScenarios)
 }
 
+func TestRecursiveUpdateScenarios(t *testing.T) {
+	runScenarios(t, recursiveUpdateScenarios)
+}
+
+func TestWalkScenarios(t *testing.T) {
+	runScenarios(t, walkScenarios)
+}
+
 func TestReduceScenarios(t *testing.T) {
 	runScenarios(t, reduceScenarios)
 }
+
+func TestForeachScenarios(t *testing.T) {
+	runScenarios(t, foreachScenarios)
+}
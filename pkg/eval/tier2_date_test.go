@@ -0,0 +1,218 @@
+package eval
+
+import (
+	"testing"
+	"time"
+)
+
+// Date and time tests
+// Tier 2 - Important (next 8% of use cases)
+
+var dateScenarios = ScenarioGroup{
+	Name:        "dates",
+	Description: "now, todate, fromdate, strftime, strptime, mktime, gmtime, dateadd and datesub",
+	Scenarios: []Scenario{
+		{
+			Description: "now from HQ_NOW as a date",
+			Document:    `null`,
+			Expression:  `now`,
+			EnvVars:     map[string]string{"HQ_NOW": "2024-06-01T12:00:00Z"},
+			Expected:    []string{`1717243200`},
+		},
+		{
+			Description: "now from HQ_NOW in seconds",
+			Document:    `null`,
+			Expression:  `now | todate`,
+			EnvVars:     map[string]string{"HQ_NOW": "1717243200"},
+			Expected:    []string{`"2024-06-01T12:00:00Z"`},
+		},
+		{
+			Description: "expired certificates",
+			Document: huml(`
+certs::
+  - ::
+    name: "api"
+    expires: "2024-05-01T00:00:00Z"
+  - ::
+    name: "web"
+    expires: "2024-09-01T00:00:00Z"
+`),
+			Expression: `[.certs[] | select((.expires | fromdate) < now) | .name]`,
+			EnvVars:    map[string]string{"HQ_NOW": "2024-06-01T12:00:00Z"},
+			Expected:   []string{`["api"]`},
+		},
+		{
+			Description: "todate",
+			Document:    `1425599621`,
+			Expression:  `todate`,
+			Expected:    []string{`"2015-03-05T23:53:41Z"`},
+		},
+		{
+			Description: "fromdate",
+			Document:    `"2015-03-05T23:51:47Z"`,
+			Expression:  `fromdate`,
+			Expected:    []string{`1425599507`},
+		},
+		{
+			Description: "fromdate with an offset",
+			Document:    `"2015-03-06T01:51:47+02:00"`,
+			Expression:  `fromdate | todate`,
+			Expected:    []string{`"2015-03-05T23:51:47Z"`},
+		},
+		{
+			Description: "fromdate with fractional seconds",
+			Document:    `"2024-01-01T00:00:00.5Z"`,
+			Expression:  `fromdate`,
+			Expected:    []string{`1704067200.5`},
+		},
+		{
+			Description: "fromdate of a date without a time",
+			Document:    `"2024-01-01"`,
+			Expression:  `fromdate`,
+			Expected:    []string{`1704067200`},
+		},
+		{
+			Description: "strftime",
+			Document:    `1425599621`,
+			Expression:  `strftime("%A, %B %d, %Y at %I:%M %p (day %j)")`,
+			Expected:    []string{`"Thursday, March 05, 2015 at 11:53 PM (day 064)"`},
+		},
+		{
+			Description: "strftime of a broken down time",
+			Document:    `[2015, 2, 5, 23, 51, 47, 4, 63]`,
+			Expression:  `strftime("%F %T %Z")`,
+			Expected:    []string{`"2015-03-05 23:51:47 UTC"`},
+		},
+		{
+			Description: "strptime",
+			Document:    `"2015-03-05T23:51:47Z"`,
+			Expression:  `strptime("%Y-%m-%dT%H:%M:%SZ")`,
+			Expected:    []string{`[2015, 2, 5, 23, 51, 47, 4, 63]`},
+		},
+		{
+			Description: "strptime with month names and an offset",
+			Document:    `"Sun, 10 Mar 2024 14:05:00 +0530"`,
+			Expression:  `strptime("%a, %d %b %Y %T %z") | mktime | todate`,
+			Expected:    []string{`"2024-03-10T08:35:00Z"`},
+		},
+		{
+			Description: "strptime and mktime",
+			Document:    `"2015-03-05T23:51:47Z"`,
+			Expression:  `strptime("%Y-%m-%dT%H:%M:%SZ") | mktime`,
+			Expected:    []string{`1425599507`},
+		},
+		{
+			Description: "gmtime",
+			Document:    `1425599621`,
+			Expression:  `gmtime`,
+			Expected:    []string{`[2015, 2, 5, 23, 53, 41, 4, 63]`},
+		},
+		{
+			Description: "gmtime and mktime round trip",
+			Document:    `1700000000`,
+			Expression:  `gmtime | mktime`,
+			Expected:    []string{`1700000000`},
+		},
+		{
+			Description: "dateadd to a number",
+			Document:    `1700000000`,
+			Expression:  `dateadd("hours"; 2) - .`,
+			Expected:    []string{`7200`},
+		},
+		{
+			Description: "dateadd to a date string keeps its offset",
+			Document:    `"2024-01-31T10:00:00+05:30"`,
+			Expression:  `dateadd("hours"; 30)`,
+			Expected:    []string{`"2024-02-01T16:00:00+05:30"`},
+		},
+		{
+			Description: "dateadd days to a date",
+			Document:    `"2024-02-27"`,
+			Expression:  `dateadd("days"; 3)`,
+			Expected:    []string{`"2024-03-01"`},
+		},
+		{
+			Description: "datesub",
+			Document:    `"2025-01-15T00:00:00Z"`,
+			Expression:  `datesub("years"; 1)`,
+			Expected:    []string{`"2024-01-15T00:00:00Z"`},
+		},
+		{
+			Description: "rotation due within 30 days",
+			Document:    `{"rotated": "2024-05-10T00:00:00Z"}`,
+			Expression:  `(.rotated | dateadd("days"; 30) | fromdate) - now < 30 * 86400`,
+			EnvVars:     map[string]string{"HQ_NOW": "2024-06-01T00:00:00Z"},
+			Expected:    []string{`true`},
+		},
+		{
+			Description:   "fromdate of an invalid date",
+			Document:      `"yesterday"`,
+			Expression:    `fromdate`,
+			ExpectedError: `date "yesterday" is not an ISO 8601 date`,
+		},
+		{
+			Description:   "strptime with a mismatched date",
+			Document:      `"2024/01/01"`,
+			Expression:    `strptime("%Y-%m-%d")`,
+			ExpectedError: `date "2024/01/01" does not match format "%Y-%m-%d"`,
+		},
+		{
+			Description:   "todate of a string",
+			Document:      `"2024-01-01"`,
+			Expression:    `todate`,
+			ExpectedError: "todate requires a number or a broken down time, got string",
+		},
+		{
+			Description:   "dateadd with an unknown unit",
+			Document:      `0`,
+			Expression:    `dateadd("fortnights"; 1)`,
+			ExpectedError: `unknown unit "fortnights"`,
+		},
+		{
+			Description:   "invalid HQ_NOW",
+			Document:      `null`,
+			Expression:    `now`,
+			EnvVars:       map[string]string{"HQ_NOW": "soon"},
+			ExpectedError: `invalid HQ_NOW "soon"`,
+		},
+		{
+			Description: "dateadd months clamps to the end of a shorter month",
+			Document:    `"2024-01-31"`,
+			Expression:  `dateadd("months"; 1)`,
+			Expected:    []string{`"2024-02-29"`},
+		},
+		{
+			Description: "datesub years from a leap day",
+			Document:    `"2024-02-29T10:00:00Z"`,
+			Expression:  `datesub("years"; 1)`,
+			Expected:    []string{`"2023-02-28T10:00:00Z"`},
+		},
+		{
+			Description: "dateadd fractional hours",
+			Document:    `"2024-01-15T00:00:00Z"`,
+			Expression:  `dateadd("hours"; 1.5)`,
+			Expected:    []string{`"2024-01-15T01:30:00Z"`},
+		},
+		{
+			Description:   "dateadd rejects fractional days",
+			Document:      `"2024-01-15"`,
+			Expression:    `dateadd("days"; 1.5)`,
+			ExpectedError: "days must be a whole number, got 1.5",
+		},
+	},
+}
+
+func TestDateScenarios(t *testing.T) {
+	runScenarios(t, dateScenarios)
+}
+
+func TestNowOption(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	results, err := EvaluateDocuments(`now | todate`, []any{nil}, Options{Now: now})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0] != "2024-06-01T12:00:00Z" {
+		t.Errorf("expected [\"2024-06-01T12:00:00Z\"], got %v", results)
+	}
+}
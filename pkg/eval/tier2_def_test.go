@@ -0,0 +1,185 @@
+package eval
+
+import "testing"
+
+// User-defined function tests
+// Tier 2 - Important (next 8% of use cases)
+
+var defScenarios = ScenarioGroup{
+	Name:        "def",
+	Description: "User-defined functions with def NAME(PARAMS): BODY;",
+	Scenarios: []Scenario{
+		{
+			Description: "simple function",
+			Document:    `3`,
+			Expression:  `def double: . * 2; double`,
+			Expected:    []string{`6`},
+		},
+		{
+			Description: "function used in map",
+			Document:    `[1, 2, 3]`,
+			Expression:  `def inc: . + 1; map(inc)`,
+			Expected:    []string{`[2, 3, 4]`},
+		},
+		{
+			Description: "filter parameter",
+			Document:    `[1, 2, 3]`,
+			Expression:  `def apply(f): [.[] | f]; apply(. * 10)`,
+			Expected:    []string{`[10, 20, 30]`},
+		},
+		{
+			Description: "filter parameter is evaluated for each input",
+			Document:    `{"a": 1, "b": 2}`,
+			Expression:  `def twice(f): f | f; .a | twice(. + 1)`,
+			Expected:    []string{`3`},
+		},
+		{
+			Description: "filter parameter producing multiple outputs",
+			Document:    `null`,
+			Expression:  `def each(f): f; [each(1, 2, 3)]`,
+			Expected:    []string{`[1, 2, 3]`},
+		},
+		{
+			Description: "value parameter",
+			Document:    `10`,
+			Expression:  `def addn($n): . + $n; addn(5)`,
+			Expected:    []string{`15`},
+		},
+		{
+			Description: "value parameter is evaluated against the caller input",
+			Document:    `{"x": 2, "items": [1, 2, 3]}`,
+			Expression:  `def scale($k): map(. * $k); .x as $x | .items | scale($x)`,
+			Expected:    []string{`[2, 4, 6]`},
+		},
+		{
+			Description: "value parameter also usable as a filter",
+			Document:    `null`,
+			Expression:  `def f($a): [$a, a]; f(7)`,
+			Expected:    []string{`[7, 7]`},
+		},
+		{
+			Description: "value parameter with multiple outputs",
+			Document:    `null`,
+			Expression:  `def pair($a; $b): [$a, $b]; [pair(1, 2; 3, 4)]`,
+			Expected:    []string{`[[1, 3], [1, 4], [2, 3], [2, 4]]`},
+		},
+		{
+			Description: "multiple parameters",
+			Document:    `{"a": 2, "b": 3}`,
+			Expression:  `def combine(f; g): f * g; combine(.a; .b)`,
+			Expected:    []string{`6`},
+		},
+		{
+			Description: "recursion",
+			Document:    `5`,
+			Expression:  `def fact: if . <= 1 then 1 else . * (. - 1 | fact) end; fact`,
+			Expected:    []string{`120`},
+		},
+		{
+			Description: "recursion over a tree",
+			Document: huml(`
+name: "root"
+children::
+  - ::
+    name: "a"
+    children:: []
+  - ::
+    name: "b"
+    children::
+      - ::
+        name: "c"
+        children:: []
+`),
+			Expression: `def names: .name, (.children[] | names); [names]`,
+			Expected:   []string{`["root", "a", "b", "c"]`},
+		},
+		{
+			Description: "closure over outer variable",
+			Document:    `[1, 2, 3]`,
+			Expression:  `10 as $base | def addbase: . + $base; map(addbase)`,
+			Expected:    []string{`[11, 12, 13]`},
+		},
+		{
+			Description: "closure sees variables at definition, not call site",
+			Document:    `null`,
+			Expression:  `1 as $x | def getx: $x; 2 as $x | [getx, $x]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "filter argument sees caller variables",
+			Document:    `null`,
+			Expression:  `def call(f): 1 as $x | f; 5 as $x | call($x)`,
+			Expected:    []string{`5`},
+		},
+		{
+			Description: "shadowing a builtin",
+			Document:    `[3, 1, 2]`,
+			Expression:  `def length: "custom"; length`,
+			Expected:    []string{`"custom"`},
+		},
+		{
+			Description: "builtin with different arity is not shadowed",
+			Document:    `[1, 2]`,
+			Expression:  `def map: "custom"; map(. + 1)`,
+			Expected:    []string{`[2, 3]`},
+		},
+		{
+			Description: "redefinition shadows earlier definition",
+			Document:    `null`,
+			Expression:  `def f: 1; def f: 2; f`,
+			Expected:    []string{`2`},
+		},
+		{
+			Description: "overloading by arity",
+			Document:    `10`,
+			Expression:  `def f: "zero"; def f(a): "one"; [f, f(.)]`,
+			Expected:    []string{`["zero", "one"]`},
+		},
+		{
+			Description: "nested definition",
+			Document:    `3`,
+			Expression:  `def outer: def inner: . * 2; inner + 1; outer`,
+			Expected:    []string{`7`},
+		},
+		{
+			Description: "definition inside parentheses",
+			Document:    `2`,
+			Expression:  `(def sq: . * .; sq) + 1`,
+			Expected:    []string{`5`},
+		},
+		{
+			Description: "definition after pipe",
+			Document:    `{"n": 4}`,
+			Expression:  `.n | def half: . / 2; half`,
+			Expected:    []string{`2`},
+		},
+		{
+			Description: "function body with reduce",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `def sum: reduce .[] as $x (0; . + $x); sum`,
+			Expected:    []string{`10`},
+		},
+		{
+			Description: "definition inside function argument",
+			Document:    `[1, 2]`,
+			Expression:  `map(def f: . * 3; f)`,
+			Expected:    []string{`[3, 6]`},
+		},
+		{
+			Description:   "wrong arity is an unknown function",
+			Document:      `null`,
+			Expression:    `def f(a): a; f`,
+			ExpectedError: "unknown function: f",
+		},
+		{
+			Description:   "missing semicolon after body",
+			Document:      `null`,
+			Expression:    `def f: 1`,
+			ExpectedError: "expected ';' after body of def f",
+		},
+	},
+}
+
+func TestDefScenarios(t *testing.T) {
+	runScenarios(t, defScenarios)
+}
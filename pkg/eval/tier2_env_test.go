@@ -0,0 +1,173 @@
+package eval
+
+import "testing"
+
+// Environment variable tests
+// Tier 2 - Important (next 8% of use cases)
+
+var envScenarios = ScenarioGroup{
+	Name:        "env",
+	Description: "Read environment variables with $ENV, env and strenv",
+	Scenarios: []Scenario{
+		{
+			Description: "$ENV field",
+			Document:    `null`,
+			Expression:  `$ENV.HQ_TEST_REGION`,
+			EnvVars:     map[string]string{"HQ_TEST_REGION": "eu-west-1"},
+			Expected:    []string{`"eu-west-1"`},
+		},
+		{
+			Description: "env field",
+			Document:    `null`,
+			Expression:  `env.HQ_TEST_REGION`,
+			EnvVars:     map[string]string{"HQ_TEST_REGION": "eu-west-1"},
+			Expected:    []string{`"eu-west-1"`},
+		},
+		{
+			Description: "missing variable is null",
+			Document:    `null`,
+			Expression:  `$ENV.HQ_TEST_MISSING`,
+			Expected:    []string{`null`},
+		},
+		{
+			Description: "env as an object",
+			Document:    `null`,
+			Expression:  `env | has("HQ_TEST_REGION")`,
+			EnvVars:     map[string]string{"HQ_TEST_REGION": "eu-west-1"},
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "set a field from the environment",
+			Document:    `{"image": "app", "tag": "latest"}`,
+			Expression:  `.tag = $ENV.HQ_TEST_TAG`,
+			EnvVars:     map[string]string{"HQ_TEST_TAG": "v1.2.3"},
+			Expected:    []string{`{"image": "app", "tag": "v1.2.3"}`},
+		},
+		{
+			Description: "strenv with a bare name",
+			Document:    `null`,
+			Expression:  `strenv(HQ_TEST_PORT)`,
+			EnvVars:     map[string]string{"HQ_TEST_PORT": "8080"},
+			Expected:    []string{`"8080"`},
+		},
+		{
+			Description: "strenv with a string",
+			Document:    `null`,
+			Expression:  `strenv("HQ_TEST_PORT")`,
+			EnvVars:     map[string]string{"HQ_TEST_PORT": "8080"},
+			Expected:    []string{`"8080"`},
+		},
+		{
+			Description: "strenv of an unset variable is empty",
+			Document:    `null`,
+			Expression:  `strenv(HQ_TEST_MISSING)`,
+			Expected:    []string{`""`},
+		},
+	},
+}
+
+var envsubstScenarios = ScenarioGroup{
+	Name:        "envsubst",
+	Description: "Expand ${VAR} references in string values with envsubst",
+	Scenarios: []Scenario{
+		{
+			Description: "expand a string",
+			Document:    `"postgres://${HQ_TEST_HOST}:5432/app"`,
+			Expression:  `envsubst`,
+			EnvVars:     map[string]string{"HQ_TEST_HOST": "db.internal"},
+			Expected:    []string{`"postgres://db.internal:5432/app"`},
+		},
+		{
+			Description: "expand every string in a document",
+			Document: huml(`
+host: "${HQ_TEST_HOST}"
+port: 5432
+replicas::
+  - "${HQ_TEST_HOST}-1"
+`),
+			Expression: `envsubst`,
+			EnvVars:    map[string]string{"HQ_TEST_HOST": "db"},
+			Expected:   []string{`{"host": "db", "port": 5432, "replicas": ["db-1"]}`},
+		},
+		{
+			Description: "default for unset or empty",
+			Document:    `["${HQ_TEST_MISSING:-info}", "${HQ_TEST_EMPTY:-info}"]`,
+			Expression:  `envsubst`,
+			EnvVars:     map[string]string{"HQ_TEST_EMPTY": ""},
+			Expected:    []string{`["info", "info"]`},
+		},
+		{
+			Description: "default for unset only",
+			Document:    `["${HQ_TEST_MISSING-info}", "${HQ_TEST_EMPTY-info}"]`,
+			Expression:  `envsubst`,
+			EnvVars:     map[string]string{"HQ_TEST_EMPTY": ""},
+			Expected:    []string{`["info", ""]`},
+		},
+		{
+			Description: "unset variables expand to nothing",
+			Document:    `"a${HQ_TEST_MISSING}b"`,
+			Expression:  `envsubst`,
+			Expected:    []string{`"ab"`},
+		},
+		{
+			Description: "keep unset references",
+			Document:    `"${HQ_TEST_HOST}:${HQ_TEST_MISSING}"`,
+			Expression:  `envsubst(keep)`,
+			EnvVars:     map[string]string{"HQ_TEST_HOST": "db"},
+			Expected:    []string{`"db:${HQ_TEST_MISSING}"`},
+		},
+		{
+			Description: "escaped reference",
+			Document:    `"$${HQ_TEST_HOST} is ${HQ_TEST_HOST}"`,
+			Expression:  `envsubst`,
+			EnvVars:     map[string]string{"HQ_TEST_HOST": "db"},
+			Expected:    []string{`"${HQ_TEST_HOST} is db"`},
+		},
+		{
+			Description: "plain dollar signs are left alone",
+			Document:    `"pa$$word $HOME"`,
+			Expression:  `envsubst`,
+			Expected:    []string{`"pa$$word $HOME"`},
+		},
+		{
+			Description: "update selected fields",
+			Document:    `{"url": "${HQ_TEST_HOST}", "note": "${HQ_TEST_HOST}"}`,
+			Expression:  `.url |= envsubst`,
+			EnvVars:     map[string]string{"HQ_TEST_HOST": "db"},
+			Expected:    []string{`{"url": "db", "note": "${HQ_TEST_HOST}"}`},
+		},
+		{
+			Description:   "fail on unset variables",
+			Document:      `"${HQ_TEST_MISSING}"`,
+			Expression:    `envsubst(nu)`,
+			ExpectedError: "variable HQ_TEST_MISSING not set",
+		},
+		{
+			Description: "default satisfies nu",
+			Document:    `"${HQ_TEST_MISSING:-x}"`,
+			Expression:  `envsubst(nu)`,
+			Expected:    []string{`"x"`},
+		},
+		{
+			Description:   "fail on empty variables",
+			Document:      `"${HQ_TEST_EMPTY}"`,
+			Expression:    `envsubst(nu, ne)`,
+			EnvVars:       map[string]string{"HQ_TEST_EMPTY": ""},
+			ExpectedError: "variable HQ_TEST_EMPTY set but empty",
+		},
+		{
+			Description:   "unknown option",
+			Document:      `"x"`,
+			Expression:    `envsubst(strict)`,
+			ExpectedError: "envsubst options must be nu, ne or keep",
+		},
+	},
+}
+
+func TestEnvScenarios(t *testing.T) {
+	runScenarios(t, envScenarios)
+}
+
+func TestEnvsubstScenarios(t *testing.T) {
+	runScenarios(t, envsubstScenarios)
+}
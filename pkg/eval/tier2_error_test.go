@@ -1,6 +1,9 @@
 package eval
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 // Error handling tests
 // Tier 2 - Important (next 8% of use cases)
@@ -158,6 +161,94 @@ count: -1
 	},
 }
 
+var errorValueScenarios = ScenarioGroup{
+	Name:        "error-values",
+	Description: "Errors carry any value to catch",
+	Scenarios: []Scenario{
+		{
+			Description: "catch receives the message",
+			Document:    `null`,
+			Expression:  `try error("fail") catch .`,
+			Expected:    []string{`"fail"`},
+		},
+		{
+			Description: "catch receives an object",
+			Document: huml(`
+port: -1
+`),
+			Expression: `try (if .port < 0 then error({code: 3, path: ["port"]}) else . end) catch .code`,
+			Expected:   []string{`3`},
+		},
+		{
+			Description: "catch receives the message of a builtin error",
+			Document:    `{"a": 1}`,
+			Expression:  `try (.a | explode) catch .`,
+			Expected:    []string{`"explode requires a string, got number (1)"`},
+		},
+		{
+			Description: "error without an argument raises its input",
+			Document:    `{"reason": "bad"}`,
+			Expression:  `try error catch .reason`,
+			Expected:    []string{`"bad"`},
+		},
+		{
+			Description: "error(null) is caught as null",
+			Document:    `null`,
+			Expression:  `try error(null) catch .`,
+			Expected:    []string{`null`},
+		},
+		{
+			Description: "outputs before the error are kept",
+			Document:    `null`,
+			Expression:  `[try (1, 2, error("x"), 3) catch "caught"]`,
+			Expected:    []string{`[1, 2, "caught"]`},
+		},
+		{
+			Description: "each input is tried on its own",
+			Document:    `[1, "a", 2]`,
+			Expression:  `[.[] | try (. + 1) catch "bad"]`,
+			Expected:    []string{`[2, "bad", 3]`},
+		},
+		{
+			Description:   "uncaught non-string error",
+			Document:      `null`,
+			Expression:    `error({code: 3})`,
+			ExpectedError: `error (not a string): {"code":3}`,
+		},
+		{
+			Description:   "uncaught null error",
+			Document:      `null`,
+			Expression:    `error(null)`,
+			ExpectedError: `error (not a string): null`,
+		},
+		{
+			Description:   "error from a catch handler",
+			Document:      `null`,
+			Expression:    `try error("a") catch error("b: " + .)`,
+			ExpectedError: "b: a",
+		},
+		{
+			Description: "$__loc__",
+			Document:    `null`,
+			Expression: `1 |
+  $__loc__`,
+			Expected: []string{`{"file": "<stdin>", "line": 2}`},
+		},
+		{
+			Description: "$__loc__ in an error",
+			Document:    `null`,
+			Expression:  `try error({msg: "bad", at: $__loc__.line}) catch .at`,
+			Expected:    []string{`1`},
+		},
+		{
+			Description: "$__loc__ in object shorthand",
+			Document:    `null`,
+			Expression:  `{$__loc__}`,
+			Expected:    []string{`{"__loc__": {"file": "<stdin>", "line": 1}}`},
+		},
+	},
+}
+
 func TestTryCatchScenarios(t *testing.T) {
 	runScenarios(t, tryCatchScenarios)
 }
@@ -169,3 +260,71 @@ func TestOptionalAccessScenarios(t *testing.T) {
 func TestErrorFunctionScenarios(t *testing.T) {
 	runScenarios(t, errorFunctionScenarios)
 }
+
+func TestErrorValueScenarios(t *testing.T) {
+	runScenarios(t, errorValueScenarios)
+}
+
+var haltScenarios = ScenarioGroup{
+	Name:        "halt",
+	Description: "halt and halt_error stop the program",
+	Scenarios: []Scenario{
+		{
+			Description:   "halt is not caught by try",
+			Document:      `null`,
+			Expression:    `try halt catch "caught"`,
+			ExpectedError: "halted with exit status 0",
+		},
+		{
+			Description:   "halt_error is not suppressed by ?",
+			Document:      `"stop"`,
+			Expression:    `(halt_error)?`,
+			ExpectedError: "halted with exit status 5",
+		},
+		{
+			Description:   "halt_error with an exit status",
+			Document:      `{"ok": false}`,
+			Expression:    `if .ok then . else halt_error(2) end`,
+			ExpectedError: "halted with exit status 2",
+		},
+		{
+			Description:   "halt_error needs an integer status",
+			Document:      `null`,
+			Expression:    `halt_error("x")`,
+			ExpectedError: `halt_error requires an integer exit status, got string ("x")`,
+		},
+	},
+}
+
+func TestHaltScenarios(t *testing.T) {
+	runScenarios(t, haltScenarios)
+}
+
+func TestHaltError(t *testing.T) {
+	// Results before the halt are still emitted
+	docs := []any{[]any{1.0, 2.0, 3.0}}
+	next := func() (any, bool, error) {
+		if len(docs) == 0 {
+			return nil, false, nil
+		}
+		doc := docs[0]
+		docs = docs[1:]
+		return doc, true, nil
+	}
+	var results []any
+	err := EvaluateStream(`.[] | if . > 2 then {n: .} | halt_error(1) else . end`, next, Options{}, func(v any) error {
+		results = append(results, v)
+		return nil
+	})
+
+	var halt *HaltError
+	if !errors.As(err, &halt) {
+		t.Fatalf("expected a HaltError, got %v", err)
+	}
+	if halt.Code != 1 || !halt.HasMessage || !equals(halt.Message, map[string]any{"n": 3.0}) {
+		t.Errorf("unexpected halt: %+v", halt)
+	}
+	if !equals(results, []any{1.0, 2.0}) {
+		t.Errorf("expected [1 2] before the halt, got %v", results)
+	}
+}
@@ -0,0 +1,173 @@
+package eval
+
+import "testing"
+
+// Format string tests
+// Tier 2 - Important (next 8% of use cases)
+
+var formatScenarios = ScenarioGroup{
+	Name:        "format",
+	Description: "@name formats its input as a string; @name \"...\" formats each interpolated value",
+	Scenarios: []Scenario{
+		{
+			Description: "@text",
+			Document:    `[1, "a"]`,
+			Expression:  `@text`,
+			Expected:    []string{`"[1,\"a\"]"`},
+		},
+		{
+			Description: "@json",
+			Document:    `{"a": "<x>"}`,
+			Expression:  `@json`,
+			Expected:    []string{`"{\"a\":\"<x>\"}"`},
+		},
+		{
+			Description: "@html escapes markup",
+			Document:    `"<a href=\"x\">Tom & Jerry's</a>"`,
+			Expression:  `@html`,
+			Expected:    []string{`"&lt;a href=&quot;x&quot;&gt;Tom &amp; Jerry&#39;s&lt;/a&gt;"`},
+		},
+		{
+			Description: "@uri keeps unreserved characters",
+			Document:    `"a b&c=d/é~_.-"`,
+			Expression:  `@uri`,
+			Expected:    []string{`"a%20b%26c%3Dd%2F%C3%A9~_.-"`},
+		},
+		{
+			Description: "@csv",
+			Document:    `[1, "a", "say \"hi\"", null, true]`,
+			Expression:  `@csv`,
+			Expected:    []string{`"1,\"a\",\"say \"\"hi\"\"\",,true"`},
+		},
+		{
+			Description: "@tsv escapes tabs, newlines and backslashes",
+			Document:    `["a\tb", "c\nd", "e\\f", 2, null]`,
+			Expression:  `@tsv`,
+			Expected:    []string{`"a\\tb\tc\\nd\te\\\\f\t2\t"`},
+		},
+		{
+			Description: "@sh quotes a string",
+			Document:    `"it's here"`,
+			Expression:  `@sh`,
+			Expected:    []string{`"'it'\\''s here'"`},
+		},
+		{
+			Description: "@sh joins array elements with spaces",
+			Document:    `["a b", 1, false]`,
+			Expression:  `@sh`,
+			Expected:    []string{`"'a b' 1 false"`},
+		},
+		{
+			Description: "@base64 and @base64d",
+			Document:    `"hello, world"`,
+			Expression:  `@base64, (@base64 | @base64d)`,
+			Expected:    []string{`"aGVsbG8sIHdvcmxk"`, `"hello, world"`},
+		},
+		{
+			Description: "@base64d without padding",
+			Document:    `"aGk"`,
+			Expression:  `@base64d`,
+			Expected:    []string{`"hi"`},
+		},
+		{
+			Description: "@base32 and @base32d",
+			Document:    `"hi"`,
+			Expression:  `@base32, (@base32 | @base32d)`,
+			Expected:    []string{`"NBUQ===="`, `"hi"`},
+		},
+		{
+			Description: "@huml renders an object inline",
+			Document:    `{"name": "web", "port": 80, "tls key": null}`,
+			Expression:  `@huml`,
+			Expected:    []string{`"name: \"web\", port: 80, \"tls key\": null"`},
+		},
+		{
+			Description: "@huml renders an array inline",
+			Document:    `[1, "a", [], {}]`,
+			Expression:  `@huml`,
+			Expected:    []string{`"1, \"a\", [], {}"`},
+		},
+		{
+			Description: "@huml of a scalar",
+			Document:    `"x"`,
+			Expression:  `@huml`,
+			Expected:    []string{`"\"x\""`},
+		},
+		{
+			Description: "format applied in a pipe",
+			Document:    `{"args": ["ls", "my dir"]}`,
+			Expression:  `.args | @sh`,
+			Expected:    []string{`"'ls' 'my dir'"`},
+		},
+		{
+			Description: "format prefix applies to interpolated values only",
+			Document:    `{"q": "a&b c"}`,
+			Expression:  `@uri "https://example.com/?q=\(.q)"`,
+			Expected:    []string{`"https://example.com/?q=a%26b%20c"`},
+		},
+		{
+			Description: "@sh interpolation",
+			Document:    `{"file": "my file.txt"}`,
+			Expression:  `@sh "cat \(.file)"`,
+			Expected:    []string{`"cat 'my file.txt'"`},
+		},
+		{
+			Description: "@json interpolation",
+			Document:    `{"v": "x"}`,
+			Expression:  `@json "value: \(.v)"`,
+			Expected:    []string{`"value: \"x\""`},
+		},
+		{
+			Description: "format of each input",
+			Document:    `[["a", 1], ["b", 2]]`,
+			Expression:  `.[] | @csv`,
+			Expected:    []string{`"\"a\",1"`, `"\"b\",2"`},
+		},
+		{
+			Description:   "@csv requires an array",
+			Document:      `{"a": 1}`,
+			Expression:    `@csv`,
+			ExpectedError: "cannot be csv-formatted, only an array can be",
+		},
+		{
+			Description:   "@csv rejects nested values",
+			Document:      `[[1]]`,
+			Expression:    `@csv`,
+			ExpectedError: "array ([1]) is not valid in a csv row",
+		},
+		{
+			Description:   "@sh rejects objects",
+			Document:      `{"a": 1}`,
+			Expression:    `@sh`,
+			ExpectedError: "can not be escaped for shell",
+		},
+		{
+			Description:   "@base64d rejects invalid data",
+			Document:      `"%%%"`,
+			Expression:    `@base64d`,
+			ExpectedError: "is not valid base64 data",
+		},
+		{
+			Description:   "@huml cannot nest non-empty values",
+			Document:      `{"a": {"b": 1}}`,
+			Expression:    `@huml`,
+			ExpectedError: "cannot be nested in inline HUML",
+		},
+		{
+			Description:   "unknown format",
+			Document:      `null`,
+			Expression:    `@nope`,
+			ExpectedError: "nope is not a valid format",
+		},
+		{
+			Description: "format string with a multi-output interpolation",
+			Document:    `null`,
+			Expression:  `@base64 "x\(1, 2)"`,
+			Expected:    []string{`"xMQ=="`, `"xMg=="`},
+		},
+	},
+}
+
+func TestFormatScenarios(t *testing.T) {
+	runScenarios(t, formatScenarios)
+}
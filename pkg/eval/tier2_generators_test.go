@@ -0,0 +1,278 @@
+package eval
+
+import "testing"
+
+// Generator builtin tests
+// Tier 2 - Important (next 8% of use cases)
+
+var rangeScenarios = ScenarioGroup{
+	Name:        "range",
+	Description: "Number sequences with range(UPTO), range(FROM; UPTO), range(FROM; UPTO; BY)",
+	Scenarios: []Scenario{
+		{
+			Description: "range upto",
+			Document:    `null`,
+			Expression:  `[range(5)]`,
+			Expected:    []string{`[0, 1, 2, 3, 4]`},
+		},
+		{
+			Description: "range from upto",
+			Document:    `null`,
+			Expression:  `[range(2; 5)]`,
+			Expected:    []string{`[2, 3, 4]`},
+		},
+		{
+			Description: "range with step",
+			Document:    `null`,
+			Expression:  `[range(0; 10; 3)]`,
+			Expected:    []string{`[0, 3, 6, 9]`},
+		},
+		{
+			Description: "range counting down",
+			Document:    `null`,
+			Expression:  `[range(5; 0; -2)]`,
+			Expected:    []string{`[5, 3, 1]`},
+		},
+		{
+			Description: "range with zero step is empty",
+			Document:    `null`,
+			Expression:  `[range(0; 5; 0)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "range with empty bounds",
+			Document:    `null`,
+			Expression:  `[range(0)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "range over array indices",
+			Document:    `["a", "b", "c"]`,
+			Expression:  `[range(length) as $i | "\($i):\(.[$i])"]`,
+			Expected:    []string{`["0:a", "1:b", "2:c"]`},
+		},
+		{
+			Description: "range with multiple bounds",
+			Document:    `null`,
+			Expression:  `[range(0, 1; 3, 4)]`,
+			Expected:    []string{`[0, 1, 2, 0, 1, 2, 3, 1, 2, 1, 2, 3]`},
+		},
+		{
+			Description: "range bounds from each input",
+			Document:    `[1, 3]`,
+			Expression:  `.[] | [range(.)]`,
+			Expected:    []string{`[0]`, `[0, 1, 2]`},
+		},
+		{
+			Description:   "range with non-numeric bound",
+			Document:      `null`,
+			Expression:    `[range("a")]`,
+			ExpectedError: "range bounds must be numbers",
+		},
+	},
+}
+
+var limitScenarios = ScenarioGroup{
+	Name:        "limit",
+	Description: "limit(N; EXPR) and first(EXPR) stop EXPR once they have enough outputs",
+	Scenarios: []Scenario{
+		{
+			Description: "limit outputs",
+			Document:    `[1, 2, 3, 4, 5]`,
+			Expression:  `[limit(3; .[])]`,
+			Expected:    []string{`[1, 2, 3]`},
+		},
+		{
+			Description: "limit larger than outputs",
+			Document:    `[1, 2]`,
+			Expression:  `[limit(5; .[])]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "limit zero",
+			Document:    `[1, 2]`,
+			Expression:  `[limit(0; .[])]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "limit does not evaluate past the limit",
+			Document:    `null`,
+			Expression:  `[limit(2; 1, 2, error("not reached"))]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "limit of an infinite generator",
+			Document:    `1`,
+			Expression:  `[limit(5; repeat(. * 2))]`,
+			Expected:    []string{`[1, 2, 4, 8, 16]`},
+		},
+		{
+			Description: "nested limits",
+			Document:    `null`,
+			Expression:  `[limit(3; limit(2; range(10)), 100)]`,
+			Expected:    []string{`[0, 1, 100]`},
+		},
+		{
+			Description: "first does not evaluate past the first output",
+			Document:    `null`,
+			Expression:  `first(1, error("not reached"))`,
+			Expected:    []string{`1`},
+		},
+		{
+			Description: "first of an infinite generator",
+			Document:    `3`,
+			Expression:  `first(repeat(. + 1) | select(. > 10))`,
+			Expected:    []string{`11`},
+		},
+		{
+			Description: "first of empty produces nothing",
+			Document:    `null`,
+			Expression:  `[first(empty)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "last of empty produces nothing",
+			Document:    `null`,
+			Expression:  `[last(empty)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "first inside a user function",
+			Document:    `[3, 8, 12, 5]`,
+			Expression:  `def find(f): first(.[] | select(f)); find(. > 7)`,
+			Expected:    []string{`8`},
+		},
+		{
+			Description:   "limit with non-numeric count",
+			Document:      `null`,
+			Expression:    `[limit("a"; 1)]`,
+			ExpectedError: "limit requires a number",
+		},
+	},
+}
+
+var loopScenarios = ScenarioGroup{
+	Name:        "loops",
+	Description: "repeat, while and until",
+	Scenarios: []Scenario{
+		{
+			Description: "while",
+			Document:    `1`,
+			Expression:  `[while(. < 100; . * 2)]`,
+			Expected:    []string{`[1, 2, 4, 8, 16, 32, 64]`},
+		},
+		{
+			Description: "while false from the start",
+			Document:    `100`,
+			Expression:  `[while(. < 10; . + 1)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "until",
+			Document:    `1`,
+			Expression:  `until(. > 100; . * 3)`,
+			Expected:    []string{`243`},
+		},
+		{
+			Description: "until already satisfied",
+			Document:    `5`,
+			Expression:  `until(. > 0; . + 1)`,
+			Expected:    []string{`5`},
+		},
+		{
+			Description: "until with state object",
+			Document:    `{"n": 5, "acc": 1}`,
+			Expression:  `until(.n == 0; {n: (.n - 1), acc: (.acc * .n)}) | .acc`,
+			Expected:    []string{`120`},
+		},
+		{
+			Description: "repeat emits the input first",
+			Document:    `"a"`,
+			Expression:  `[limit(3; repeat(. + "a"))]`,
+			Expected:    []string{`["a", "aa", "aaa"]`},
+		},
+		{
+			Description: "repeat stops when the step is empty",
+			Document:    `[1, 2, 3]`,
+			Expression:  `[repeat(if length > 0 then .[1:] else empty end)]`,
+			Expected:    []string{`[[1, 2, 3], [2, 3], [3], []]`},
+		},
+		{
+			Description: "long loop",
+			Document:    `0`,
+			Expression:  `until(. >= 100000; . + 1)`,
+			Expected:    []string{`100000`},
+		},
+	},
+}
+
+var recurseScenarios = ScenarioGroup{
+	Name:        "recurse",
+	Description: "recurse, recurse(f) and recurse(f; cond)",
+	Scenarios: []Scenario{
+		{
+			Description: "recurse visits every value depth-first",
+			Document:    `{"a": [1, {"b": 2}]}`,
+			Expression:  `[recurse | numbers]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "recurse keeps null values",
+			Document:    `[null, [null]]`,
+			Expression:  `[recurse] | length`,
+			Expected:    []string{`4`},
+		},
+		{
+			Description: "recurse with a child function",
+			Document: huml(`
+name: "root"
+children::
+  - ::
+    name: "a"
+    children:: []
+  - ::
+    name: "b"
+    children::
+      - ::
+        name: "c"
+        children:: []
+`),
+			Expression: `[recurse(.children[]) | .name]`,
+			Expected:   []string{`["root", "a", "b", "c"]`},
+		},
+		{
+			Description: "recurse with a condition",
+			Document:    `2`,
+			Expression:  `[recurse(. * .; . < 100)]`,
+			Expected:    []string{`[2, 4, 16]`},
+		},
+		{
+			Description: "recurse over optional children",
+			Document:    `{"name": "x", "parent": {"name": "y", "parent": {"name": "z"}}}`,
+			Expression:  `[recurse(.parent; . != null) | .name]`,
+			Expected:    []string{`["x", "y", "z"]`},
+		},
+		{
+			Description: "first match in a deep tree",
+			Document:    `{"a": {"b": {"target": 1}}, "c": {"target": 2}}`,
+			Expression:  `first(recurse | objects | select(has("target")) | .target)`,
+			Expected:    []string{`1`},
+		},
+	},
+}
+
+func TestRangeScenarios(t *testing.T) {
+	runScenarios(t, rangeScenarios)
+}
+
+func TestLimitScenarios(t *testing.T) {
+	runScenarios(t, limitScenarios)
+}
+
+func TestLoopScenarios(t *testing.T) {
+	runScenarios(t, loopScenarios)
+}
+
+func TestRecurseScenarios(t *testing.T) {
+	runScenarios(t, recurseScenarios)
+}
@@ -0,0 +1,140 @@
+package eval
+
+import "testing"
+
+// input/inputs and multi-document tests
+// Tier 2 - Important (next 8% of use cases)
+
+var inputScenarios = ScenarioGroup{
+	Name:        "input",
+	Description: "The expression runs once per document; input and inputs read the documents that follow",
+	Scenarios: []Scenario{
+		{
+			Description: "expression runs once per document",
+			Document:    `{"a": 1}`,
+			Document2:   `{"a": 2}`,
+			Expression:  `.a`,
+			Expected:    []string{`1`, `2`},
+		},
+		{
+			Description: "input consumes the next document",
+			Document:    `1`,
+			Document2:   `2`,
+			Expression:  `[., input]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "inputs collects the remaining documents",
+			Document:    `1`,
+			Document2:   `2`,
+			Expression:  `[., inputs]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "inputs is empty after the last document",
+			Document:    `1`,
+			Expression:  `[inputs]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "first(inputs) leaves the rest unread",
+			Document:    `1`,
+			Document2:   `2`,
+			Expression:  `[first(inputs)], [inputs]`,
+			Expected:    []string{`[2]`, `[]`},
+		},
+		{
+			Description: "$__doc is the document index",
+			Document:    `"a"`,
+			Document2:   `"b"`,
+			Expression:  `"\($__doc): \(.)"`,
+			Expected:    []string{`"0: a"`, `"1: b"`},
+		},
+		{
+			Description: "document_index of each input",
+			Document:    `{"a": 1}`,
+			Document2:   `{"a": 2}`,
+			Expression:  `document_index`,
+			Expected:    []string{`0`, `1`},
+		},
+		{
+			Description: "document_index of a document read with input",
+			Document:    `1`,
+			Document2:   `2`,
+			Expression:  `input | document_index`,
+			Expected:    []string{`1`},
+		},
+		{
+			Description:   "input past the last document",
+			Document:      `1`,
+			Expression:    `input`,
+			ExpectedError: "no more inputs",
+		},
+	},
+}
+
+func TestInputScenarios(t *testing.T) {
+	runScenarios(t, inputScenarios)
+}
+
+func TestArgsOptions(t *testing.T) {
+	opts := Options{
+		NullInput:      true,
+		NamedArgs:      map[string]any{"env": "prod", "n": 2.0},
+		PositionalArgs: []any{"a"},
+	}
+	results, err := EvaluateDocuments(`[$env, $n, $__named.env, $ARGS.positional[0], ($ARGS.named | length)]`, nil, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []any{"prod", 2.0, "prod", "a", 2.0}
+	if len(results) != 1 || !equals(results[0], want) {
+		t.Errorf("expected %v, got %v", want, results)
+	}
+}
+
+func TestArgsAreShadowed(t *testing.T) {
+	opts := Options{
+		NullInput: true,
+		NamedArgs: map[string]any{"x": "a", "n": "5"},
+	}
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{`"b" as $x | $x`, "b"},
+		{`reduce (1, 2, 3) as $x (0; . + $x)`, 6.0},
+		{`def f($n): $n; f(1)`, 1.0},
+		{`def f: $n; 1 as $n | f`, "5"},
+		{`("b" as $x | $x), $x`, "a"},
+	}
+	for _, tt := range tests {
+		results, err := EvaluateDocuments(tt.expr, nil, opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if len(results) == 0 || !equals(results[len(results)-1], tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.want, results)
+		}
+	}
+}
+
+func TestMergeDocuments(t *testing.T) {
+	docs := []any{
+		map[string]any{"db": map[string]any{"host": "localhost", "port": 5432.0}, "debug": true},
+		map[string]any{"db": map[string]any{"host": "db.prod"}},
+	}
+	merged, err := MergeDocuments(docs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{"db": map[string]any{"host": "db.prod", "port": 5432.0}, "debug": true}
+	if !equals(merged, want) {
+		t.Errorf("expected %v, got %v", want, merged)
+	}
+
+	if _, err := MergeDocuments([]any{map[string]any{}, "x"}); err == nil {
+		t.Error("expected an error merging a string")
+	}
+}
@@ -0,0 +1,123 @@
+package eval
+
+import "testing"
+
+// label/break tests
+// Tier 2 - Important (next 8% of use cases)
+
+var labelScenarios = ScenarioGroup{
+	Name:        "label",
+	Description: "Early exit from generators with label $name | ... break $name",
+	Scenarios: []Scenario{
+		{
+			Description: "break stops a comma sequence",
+			Document:    `null`,
+			Expression:  `[label $out | 1, 2, break $out, 3]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "break without outputs",
+			Document:    `null`,
+			Expression:  `[label $out | break $out]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "stop iterating once a condition is met",
+			Document:    `[1, 2, 3, 4, 5]`,
+			Expression:  `[label $out | .[] | if . > 3 then break $out else . end]`,
+			Expected:    []string{`[1, 2, 3]`},
+		},
+		{
+			Description: "first matching element",
+			Document: huml(`
+- ::
+  name: "Alice"
+  role: "user"
+- ::
+  name: "Bob"
+  role: "admin"
+- ::
+  name: "Carol"
+  role: "admin"
+`),
+			Expression: `label $found | .[] | select(.role == "admin") | .name, break $found`,
+			Expected:   []string{`"Bob"`},
+		},
+		{
+			Description: "break through foreach",
+			Document:    `[1, 2, 3, 4, 5]`,
+			Expression:  `[label $out | foreach .[] as $x (0; . + $x; if . > 5 then ., break $out else . end)]`,
+			Expected:    []string{`[1, 3, 6]`},
+		},
+		{
+			Description: "break unwinds reduce",
+			Document:    `[1, 2, 3]`,
+			Expression:  `[label $out | reduce .[] as $x (0; if $x == 2 then break $out else . + $x end)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "break in reduce source",
+			Document:    `null`,
+			Expression:  `[label $out | reduce (1, 2, break $out) as $x (0; . + $x)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "break through variable binding",
+			Document:    `[1, 2, 3]`,
+			Expression:  `[label $out | .[] as $x | if $x == 3 then break $out else $x * 10 end]`,
+			Expected:    []string{`[10, 20]`},
+		},
+		{
+			Description: "break is not caught by try",
+			Document:    `null`,
+			Expression:  `[label $out | try (1, break $out, 2) catch "caught"]`,
+			Expected:    []string{`[1]`},
+		},
+		{
+			Description: "break is not suppressed by ?",
+			Document:    `null`,
+			Expression:  `[label $out | (1, break $out, 2)?]`,
+			Expected:    []string{`[1]`},
+		},
+		{
+			Description: "label is evaluated per input",
+			Document:    `[[1, 2, 3], [5, 6, 7]]`,
+			Expression:  `[.[] | label $out | .[] | if . % 2 == 0 then break $out else . end]`,
+			Expected:    []string{`[1, 5]`},
+		},
+		{
+			Description: "nested labels break the inner label",
+			Document:    `null`,
+			Expression:  `[label $a | label $b | 1, break $b, 2], 3`,
+			Expected:    []string{`[1]`, `3`},
+		},
+		{
+			Description: "nested labels break the outer label",
+			Document:    `null`,
+			Expression:  `[label $a | (label $b | 1, break $a, 2), 3]`,
+			Expected:    []string{`[1]`},
+		},
+		{
+			Description: "break from inside a function argument",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `def upto(f): label $done | .[] | if f then ., break $done else . end; [upto(. == 2)]`,
+			Expected:    []string{`[1, 2]`},
+		},
+		{
+			Description: "label used as a field name",
+			Document:    `{"label": "prod"}`,
+			Expression:  `.label`,
+			Expected:    []string{`"prod"`},
+		},
+		{
+			Description:   "break without label",
+			Document:      `null`,
+			Expression:    `break $missing`,
+			ExpectedError: "$*label-missing is not defined",
+		},
+	},
+}
+
+func TestLabelScenarios(t *testing.T) {
+	runScenarios(t, labelScenarios)
+}
@@ -0,0 +1,219 @@
+package eval
+
+import "testing"
+
+// Math builtin tests
+// Tier 2 - Important (next 8% of use cases)
+
+var mathScenarios = ScenarioGroup{
+	Name:        "math",
+	Description: "jq math builtins on the input and with arguments",
+	Scenarios: []Scenario{
+		{
+			Description: "rounding",
+			Document:    `[-1.5, 1.5, 2.5]`,
+			Expression:  `map(floor), map(ceil), map(round), map(trunc), map(rint)`,
+			Expected:    []string{`[-2, 1, 2]`, `[-1, 2, 3]`, `[-2, 2, 3]`, `[-1, 1, 2]`, `[-2, 2, 2]`},
+		},
+		{
+			Description: "sqrt, cbrt and fabs",
+			Document:    `null`,
+			Expression:  `(16 | sqrt), (27 | cbrt), (-2.5 | fabs)`,
+			Expected:    []string{`4`, `3`, `2.5`},
+		},
+		{
+			Description: "abs",
+			Document:    `[-3, 0, 4.5]`,
+			Expression:  `map(abs)`,
+			Expected:    []string{`[3, 0, 4.5]`},
+		},
+		{
+			Description: "exponentials and logarithms",
+			Document:    `null`,
+			Expression:  `(0 | exp), (10 | exp2), (3 | exp10), (1 | log), (1024 | log2), (1000 | log10)`,
+			Expected:    []string{`1`, `1024`, `1000`, `0`, `10`, `3`},
+		},
+		{
+			Description: "trigonometry",
+			Document:    `null`,
+			Expression:  `(0 | sin), (0 | cos), (1 | atan * 4 | . * 1000 | round)`,
+			Expected:    []string{`0`, `1`, `3142`},
+		},
+		{
+			Description: "pow",
+			Document:    `{"base": 2}`,
+			Expression:  `pow(.base; 10)`,
+			Expected:    []string{`1024`},
+		},
+		{
+			Description: "pow over multiple arguments",
+			Document:    `null`,
+			Expression:  `[pow(2, 3; 1, 2)]`,
+			Expected:    []string{`[2, 4, 3, 9]`},
+		},
+		{
+			Description: "two-argument functions",
+			Document:    `null`,
+			Expression:  `atan2(0; 1), fmod(7; 3), hypot(3; 4), fmin(1; 2), fmax(1; 2), copysign(3; -1), ldexp(3; 2)`,
+			Expected:    []string{`0`, `1`, `5`, `1`, `2`, `-3`, `12`},
+		},
+		{
+			Description: "fma",
+			Document:    `null`,
+			Expression:  `fma(2; 3; 4)`,
+			Expected:    []string{`10`},
+		},
+		{
+			Description: "frexp, modf and significand",
+			Document:    `null`,
+			Expression:  `(8 | frexp), (3.5 | modf), (10 | significand), (10 | logb)`,
+			Expected:    []string{`[0.5, 4]`, `[0.5, 3]`, `1.25`, `3`},
+		},
+		{
+			Description: "gamma",
+			Document:    `5`,
+			Expression:  `tgamma, (lgamma | exp | round)`,
+			Expected:    []string{`24`, `24`},
+		},
+		{
+			Description:   "math on a non-number",
+			Document:      `"x"`,
+			Expression:    `floor`,
+			ExpectedError: `floor requires a number, got string ("x")`,
+		},
+		{
+			Description:   "math with a non-number argument",
+			Document:      `null`,
+			Expression:    `pow(2; "x")`,
+			ExpectedError: "pow requires numbers",
+		},
+	},
+}
+
+var nanScenarios = ScenarioGroup{
+	Name:        "nan and infinite",
+	Description: "nan, infinite, isnan, isinfinite and isnormal, and how they compare and print",
+	Scenarios: []Scenario{
+		{
+			Description: "isnan",
+			Document:    `null`,
+			Expression:  `(nan | isnan), (1 | isnan), ([nan] | .[0] | isnan)`,
+			Expected:    []string{`true`, `false`, `true`},
+		},
+		{
+			Description: "isinfinite",
+			Document:    `null`,
+			Expression:  `(infinite | isinfinite), (-infinite | isinfinite), (1e308 | isinfinite)`,
+			Expected:    []string{`true`, `true`, `false`},
+		},
+		{
+			Description: "isnormal",
+			Document:    `null`,
+			Expression:  `[1, 0, nan, infinite, 1e-310] | map(isnormal)`,
+			Expected:    []string{`[true, false, false, false, false]`},
+		},
+		{
+			Description: "infinite arithmetic",
+			Document:    `null`,
+			Expression:  `(infinite > 1e308), (infinite - infinite | isnan), (1 / infinite)`,
+			Expected:    []string{`true`, `true`, `0`},
+		},
+		{
+			Description: "nan is not equal to itself",
+			Document:    `null`,
+			Expression:  `nan == nan`,
+			Expected:    []string{`false`},
+		},
+		{
+			Description: "nan is less than any number",
+			Document:    `null`,
+			Expression:  `nan < -infinite, nan > 0`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "nan sorts before numbers",
+			Document:    `[3, 1]`,
+			Expression:  `. + [nan] | sort | .[0] | isnan`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "JSON prints nan as null and infinite as the largest number",
+			Document:    `null`,
+			Expression:  `[nan, infinite, -infinite] | tojson`,
+			Expected:    []string{`"[null,1.7976931348623157e+308,-1.7976931348623157e+308]"`},
+		},
+		{
+			Description: "tostring of infinite",
+			Document:    `null`,
+			Expression:  `infinite | tostring`,
+			Expected:    []string{`"1.7976931348623157e+308"`},
+		},
+		{
+			Description: "tostring of arrays and objects matches tojson",
+			Document:    `null`,
+			Expression:  `([nan, 1, 2] | tostring == tojson), ({"a": [1, 2]} | tostring)`,
+			Expected:    []string{`true`, `"{\"a\":[1,2]}"`},
+		},
+		{
+			Description: "nan in string interpolation",
+			Document:    `null`,
+			Expression:  `"value: \(nan)"`,
+			Expected:    []string{`"value: null"`},
+		},
+	},
+}
+
+var divideScenarios = ScenarioGroup{
+	Name:        "divide",
+	Description: "jq rules for / and %",
+	Scenarios: []Scenario{
+		{
+			Description: "dividing a string splits it",
+			Document:    `"a,b,c"`,
+			Expression:  `. / ","`,
+			Expected:    []string{`["a", "b", "c"]`},
+		},
+		{
+			Description: "dividing an empty string",
+			Document:    `""`,
+			Expression:  `. / ","`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "modulo truncates its operands",
+			Document:    `null`,
+			Expression:  `5.9 % 3.1, -5 % 3, 5 % -3`,
+			Expected:    []string{`2`, `-2`, `2`},
+		},
+		{
+			Description: "modulo with nan",
+			Document:    `null`,
+			Expression:  `nan % 2 | isnan`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description:   "modulo by zero",
+			Document:      `null`,
+			Expression:    `5 % 0.5`,
+			ExpectedError: "modulo by zero",
+		},
+		{
+			Description:   "dividing a string by a number",
+			Document:      `"abc"`,
+			Expression:    `. / 2`,
+			ExpectedError: "cannot divide",
+		},
+	},
+}
+
+func TestMathScenarios(t *testing.T) {
+	runScenarios(t, mathScenarios)
+}
+
+func TestNanScenarios(t *testing.T) {
+	runScenarios(t, nanScenarios)
+}
+
+func TestDivideScenarios(t *testing.T) {
+	runScenarios(t, divideScenarios)
+}
@@ -54,6 +54,108 @@ nested:
 			Expression: `[paths(type == "array")]`,
 			Expected:   []string{`[["items"], ["nested", "data"]]`},
 		},
+		{
+			Description: "path through iterator",
+			Document:    `{"a": [1, 2]}`,
+			Expression:  `[path(.a[])]`,
+			Expected:    []string{`[["a", 0], ["a", 1]]`},
+		},
+		{
+			Description: "path through select",
+			Document: huml(`
+users::
+  - ::
+    name: "Alice"
+    role: "admin"
+  - ::
+    name: "Bob"
+    role: "user"
+`),
+			Expression: `[path(.users[] | select(.role == "admin") | .name)]`,
+			Expected:   []string{`[["users", 0, "name"]]`},
+		},
+		{
+			Description: "path of recursive descent",
+			Document:    `{"a": {"b": "x"}, "c": [1, "y"]}`,
+			Expression:  `[path(.. | select(type == "string"))]`,
+			Expected:    []string{`[["a", "b"], ["c", 1]]`},
+		},
+		{
+			Description: "path of comma",
+			Document:    `{"a": 1, "b": 2}`,
+			Expression:  `[path(.a, .b)]`,
+			Expected:    []string{`[["a"], ["b"]]`},
+		},
+		{
+			Description: "path of if-then-else",
+			Document:    `{"kind": "x", "a": 1, "b": 2}`,
+			Expression:  `path(if .kind == "x" then .a else .b end)`,
+			Expected:    []string{`["a"]`},
+		},
+		{
+			Description: "path of alternative",
+			Document:    `{"b": 2}`,
+			Expression:  `path(.a // .b)`,
+			Expected:    []string{`["b"]`},
+		},
+		{
+			Description: "path of getpath",
+			Document:    `{"a": {}}`,
+			Expression:  `path(.a | getpath(["b", "c"]))`,
+			Expected:    []string{`["a", "b", "c"]`},
+		},
+		{
+			Description: "path of first",
+			Document:    `{"items": [{"ok": false}, {"ok": true}, {"ok": true}]}`,
+			Expression:  `path(first(.items[] | select(.ok)))`,
+			Expected:    []string{`["items", 1]`},
+		},
+		{
+			Description: "path of recurse",
+			Document:    `{"name": "a", "child": {"name": "b", "child": null}}`,
+			Expression:  `[path(recurse(.child; . != null) | .name)]`,
+			Expected:    []string{`[["name"], ["child", "name"]]`},
+		},
+		{
+			Description: "path through user function",
+			Document:    `{"a": [1, 2, 3]}`,
+			Expression:  `def big: .a[] | select(. > 1); [path(big)]`,
+			Expected:    []string{`[["a", 1], ["a", 2]]`},
+		},
+		{
+			Description: "path of missing field",
+			Document:    `{}`,
+			Expression:  `path(.a.b)`,
+			Expected:    []string{`["a", "b"]`},
+		},
+		{
+			Description: "path is relative to its input",
+			Document:    `{"a": {"b": 1}}`,
+			Expression:  `.a | path(.b)`,
+			Expected:    []string{`["b"]`},
+		},
+		{
+			Description: "path of empty",
+			Document:    `{"a": 1}`,
+			Expression:  `[path(empty)]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description:   "invalid path expression",
+			Document:      `{"a": 1}`,
+			Expression:    `path(.a + 1)`,
+			ExpectedError: "invalid path expression with result 2",
+		},
+		{
+			Description: "path to a slice",
+			Document:    `{"a": [1, 2, 3, 4]}`,
+			Expression:  `path(.a[1:3]), path(.a[2:]), path(.a[:1])`,
+			Expected: []string{
+				`["a", {"start": 1, "end": 3}]`,
+				`["a", {"start": 2, "end": null}]`,
+				`["a", {"start": null, "end": 1}]`,
+			},
+		},
 	},
 }
 
@@ -96,6 +198,12 @@ a: 1
 			Expression:  `getpath([])`,
 			Expected:    []string{`42`},
 		},
+		{
+			Description: "getpath with a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `getpath([{"start": 1, "end": -1}])`,
+			Expected:    []string{`[2, 3]`},
+		},
 	},
 }
 
@@ -144,6 +252,12 @@ items:
   - "c"
 `)},
 		},
+		{
+			Description: "setpath replaces a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `setpath([{"start": 0, "end": 2}]; ["a"])`,
+			Expected:    []string{`["a", 3, 4]`},
+		},
 	},
 }
 
@@ -193,6 +307,18 @@ user:
   email: "alice@example.com"
 `)},
 		},
+		{
+			Description: "delpaths array indices in any order",
+			Document:    `["a", "b", "c", "d"]`,
+			Expression:  `delpaths([[0], [2]])`,
+			Expected:    []string{`["b", "d"]`},
+		},
+		{
+			Description: "delpaths removes a slice",
+			Document:    `[1, 2, 3, 4]`,
+			Expression:  `delpaths([[{"start": 1, "end": 3}]])`,
+			Expected:    []string{`[1, 4]`},
+		},
 	},
 }
 
@@ -1,6 +1,11 @@
 package eval
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+	"github.com/rhnvrm/hq/pkg/types"
+)
 
 // Regular expression tests
 // Tier 2 - Important (next 8% of use cases)
@@ -173,6 +178,36 @@ var substituteRegexScenarios = ScenarioGroup{
 			Expression:  `gsub("\\d"; "")`,
 			Expected:    []string{`"abc"`},
 		},
+		{
+			Description: "sub with the g flag",
+			Document:    `"aaa"`,
+			Expression:  `sub("a"; "b"; "g")`,
+			Expected:    []string{`"bbb"`},
+		},
+		{
+			Description: "gsub with flags",
+			Document:    `"Cat cat"`,
+			Expression:  `gsub("cat"; "dog"; "i")`,
+			Expected:    []string{`"dog dog"`},
+		},
+		{
+			Description: "replacement refers to named captures",
+			Document:    `"2024-01-15"`,
+			Expression:  `sub("(?<y>\\d+)-(?<m>\\d+)-(?<d>\\d+)"; "\(.d)/\(.m)/\(.y)")`,
+			Expected:    []string{`"15/01/2024"`},
+		},
+		{
+			Description: "replacement with several outputs",
+			Document:    `"a-b"`,
+			Expression:  `[sub("-"; "+", "*")]`,
+			Expected:    []string{`["a+b", "a*b"]`},
+		},
+		{
+			Description: "gsub with multi-byte text",
+			Document:    `"naïve café"`,
+			Expression:  `gsub("é|ï"; "_")`,
+			Expected:    []string{`"na_ve caf_"`},
+		},
 		{
 			Description: "gsub with backreference",
 			Document:    `"hello world"`,
@@ -182,6 +217,140 @@ var substituteRegexScenarios = ScenarioGroup{
 	},
 }
 
+var regexFlagScenarios = ScenarioGroup{
+	Name:        "regex-flags",
+	Description: "jq regex flags as a second argument or in an array",
+	Scenarios: []Scenario{
+		{
+			Description: "test with the i flag",
+			Document:    `"Hello World"`,
+			Expression:  `test("hello"; "i"), test(["hello", "i"]), test("hello"; null)`,
+			Expected:    []string{`true`, `true`, `false`},
+		},
+		{
+			Description: "test with the x flag",
+			Document:    `"2024-01-15"`,
+			Expression:  `test("\\d{4} - \\d{2}  # year and month"; "x")`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "x flag keeps escaped spaces and classes",
+			Document:    `"a b"`,
+			Expression:  `test("a\\ b"; "x"), test("a[ ]b"; "x")`,
+			Expected:    []string{`true`, `true`},
+		},
+		{
+			Description: "p flag lets . match newlines",
+			Document:    `"a\nb"`,
+			Expression:  `test("a.b"), test("a.b"; "p"), test("^a.b$"; "s")`,
+			Expected:    []string{`false`, `true`, `false`},
+		},
+		{
+			Description: "l flag prefers the longest alternative",
+			Document:    `"abcd"`,
+			Expression:  `match("a|ab|abc").string, match("a|ab|abc"; "l").string`,
+			Expected:    []string{`"a"`, `"abc"`},
+		},
+		{
+			Description: "match with the g flag",
+			Document:    `"a1 b22 c333"`,
+			Expression:  `[match("\\d+"; "g") | .string]`,
+			Expected:    []string{`["1", "22", "333"]`},
+		},
+		{
+			Description: "g flag with no match produces nothing",
+			Document:    `"abc"`,
+			Expression:  `[match("\\d"; "g")]`,
+			Expected:    []string{`[]`},
+		},
+		{
+			Description: "n flag ignores empty matches",
+			Document:    `"ab"`,
+			Expression:  `([match("x*"; "g")] | length), ([match("x*"; "gn")] | length)`,
+			Expected:    []string{`3`, `0`},
+		},
+		{
+			Description: "match offsets count code points",
+			Document:    `"café crème"`,
+			Expression:  `match("crème") | [.offset, .length]`,
+			Expected:    []string{`[5, 5]`},
+		},
+		{
+			Description: "capture offsets count code points",
+			Document:    `"über 42"`,
+			Expression:  `match("(\\d+)").captures[0] | [.offset, .length, .string]`,
+			Expected:    []string{`[5, 2, "42"]`},
+		},
+		{
+			Description: "capture with the g flag",
+			Document:    `"a=1, b=2"`,
+			Expression:  `[capture("(?<k>\\w)=(?<v>\\d)"; "g")]`,
+			Expected:    []string{`[{"k": "a", "v": "1"}, {"k": "b", "v": "2"}]`},
+		},
+		{
+			Description: "capture of a group that did not take part",
+			Document:    `"a"`,
+			Expression:  `capture("(?<x>a)|(?<y>b)")`,
+			Expected:    []string{`{"x": "a", "y": null}`},
+		},
+		{
+			Description:   "invalid flag",
+			Document:      `"a"`,
+			Expression:    `test("a"; "q")`,
+			ExpectedError: `"q" is not a valid modifier string`,
+		},
+		{
+			Description:   "flags in the array and as an argument",
+			Document:      `"a"`,
+			Expression:    `test(["a", "i"]; "g")`,
+			ExpectedError: "flags cannot be given both in the array and as an argument",
+		},
+		{
+			Description:   "non-string input",
+			Document:      `1`,
+			Expression:    `test("a")`,
+			ExpectedError: "test: input must be a string, got number (1)",
+		},
+	},
+}
+
+var scanSplitScenarios = ScenarioGroup{
+	Name:        "scan-split",
+	Description: "scan, split with a regex, and splits",
+	Scenarios: []Scenario{
+		{
+			Description: "scan without groups",
+			Document:    `"port 80, port 443"`,
+			Expression:  `[scan("\\d+")]`,
+			Expected:    []string{`["80", "443"]`},
+		},
+		{
+			Description: "scan with groups",
+			Document:    `"a=1, b=2"`,
+			Expression:  `[scan("(\\w)=(\\d)")]`,
+			Expected:    []string{`[["a", "1"], ["b", "2"]]`},
+		},
+		{
+			Description: "scan with flags",
+			Document:    `"Ab aB ab"`,
+			Expression:  `[scan("ab"; "i")]`,
+			Expected:    []string{`["Ab", "aB", "ab"]`},
+		},
+		{
+			Description: "split with a regex and flags",
+			Document:    `"aXbxc"`,
+			Expression:  `split("x"; "i"), split("x"; null)`,
+			Expected:    []string{`["a", "b", "c"]`, `["aXb", "c"]`},
+		},
+		{
+			Description: "splits with flags",
+			Document:    `"one AND two and three"`,
+			Expression:  `[splits(" and "; "i")]`,
+			Expected:    []string{`["one", "two", "three"]`},
+		},
+	},
+}
+
 func TestTestRegexScenarios(t *testing.T) {
 	runScenarios(t, testRegexScenarios)
 }
@@ -197,3 +366,25 @@ func TestCaptureRegexScenarios(t *testing.T) {
 func TestSubstituteRegexScenarios(t *testing.T) {
 	runScenarios(t, substituteRegexScenarios)
 }
+
+func TestRegexFlagScenarios(t *testing.T) {
+	runScenarios(t, regexFlagScenarios)
+}
+
+func TestScanSplitScenarios(t *testing.T) {
+	runScenarios(t, scanSplitScenarios)
+}
+
+func TestRegexCache(t *testing.T) {
+	ast, err := parser.Parse(`[.[] | test("^a+$"), sub("a"; "b"; "g")]`)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	ctx := types.NewContext([]any{"aa", "ab", "ba"})
+	if _, err := evaluate(ast, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ctx.Regexps) != 2 {
+		t.Errorf("expected 2 cached regexps, got %d", len(ctx.Regexps))
+	}
+}
@@ -0,0 +1,274 @@
+package eval
+
+import "testing"
+
+// Quantifier and search tests
+// Tier 2 - Important (next 8% of use cases)
+
+var quantifierScenarios = ScenarioGroup{
+	Name:        "any and all",
+	Description: "any, any(COND), any(GEN; COND) and the same for all",
+	Scenarios: []Scenario{
+		{
+			Description: "any and all of booleans",
+			Document:    `[true, false]`,
+			Expression:  `any, all`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "any and all of an empty array",
+			Document:    `[]`,
+			Expression:  `any, all`,
+			Expected:    []string{`false`, `true`},
+		},
+		{
+			Description: "any and all of object values",
+			Document:    `{"a": true, "b": null}`,
+			Expression:  `any, all`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "any user is admin",
+			Document: huml(`
+users::
+  - ::
+    name: "alice"
+    role: "user"
+  - ::
+    name: "bob"
+    role: "admin"
+`),
+			Expression: `.users | any(.role == "admin")`,
+			Expected:   []string{`true`},
+		},
+		{
+			Description: "all ports are privileged",
+			Document:    `{"ports": [80, 443, 8080]}`,
+			Expression:  `.ports | all(. < 1024)`,
+			Expected:    []string{`false`},
+		},
+		{
+			Description: "any with a generator",
+			Document:    `{"services": [{"ports": [80]}, {"ports": [22, 8080]}]}`,
+			Expression:  `any(.services[].ports[]; . == 22)`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "all with a generator",
+			Document:    `{"services": [{"ports": [80]}, {"ports": [22, 8080]}]}`,
+			Expression:  `all(.services[].ports[]; . > 0)`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "any stops at the first match",
+			Document:    `null`,
+			Expression:  `any(1, 2, error("not reached"); . == 2)`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "all stops at the first failure",
+			Document:    `null`,
+			Expression:  `all(1, 2, error("not reached"); . < 2)`,
+			Expected:    []string{`false`},
+		},
+		{
+			Description: "any of an infinite generator",
+			Document:    `null`,
+			Expression:  `any(range(infinite); . > 100)`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "any of an empty generator",
+			Document:    `null`,
+			Expression:  `any(empty; .), all(empty; .)`,
+			Expected:    []string{`false`, `true`},
+		},
+		{
+			Description: "any per input",
+			Document:    `[[1, 2], [3]]`,
+			Expression:  `map(any(. == 3))`,
+			Expected:    []string{`[false, true]`},
+		},
+		{
+			Description:   "any of a scalar",
+			Document:      `1`,
+			Expression:    `any`,
+			ExpectedError: "any requires an array or object, got number",
+		},
+	},
+}
+
+var isvalidScenarios = ScenarioGroup{
+	Name:        "isvalid",
+	Description: "isvalid(EXPR) is true if EXPR can be evaluated on the input",
+	Scenarios: []Scenario{
+		{
+			Description: "valid and invalid paths",
+			Document:    `{"a": {"b": 1}, "c": "x"}`,
+			Expression:  `isvalid(.a.b), isvalid(.c.d), isvalid(.missing.b)`,
+			Expected:    []string{`true`, `false`, `true`},
+		},
+		{
+			Description: "isvalid of array access",
+			Document:    `{"a": [1, 2]}`,
+			Expression:  `isvalid(.a[0]), isvalid(.a.x)`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "isvalid of an error",
+			Document:    `null`,
+			Expression:  `isvalid(error("x"))`,
+			Expected:    []string{`false`},
+		},
+		{
+			Description: "isvalid only evaluates the first output",
+			Document:    `null`,
+			Expression:  `isvalid(1, error("not reached"))`,
+			Expected:    []string{`true`},
+		},
+	},
+}
+
+var indicesScenarios = ScenarioGroup{
+	Name:        "indices",
+	Description: "indices(S), index(S) and rindex(S) on strings and arrays",
+	Scenarios: []Scenario{
+		{
+			Description: "indices in a string",
+			Document:    `"a,b, cd, efg, hijk"`,
+			Expression:  `indices(", ")`,
+			Expected:    []string{`[3, 7, 12]`},
+		},
+		{
+			Description: "index and rindex in a string",
+			Document:    `"a,b, cd, efg, hijk"`,
+			Expression:  `index(", "), rindex(", ")`,
+			Expected:    []string{`3`, `12`},
+		},
+		{
+			Description: "string offsets count code points",
+			Document:    `"héllo wörld"`,
+			Expression:  `indices("l")`,
+			Expected:    []string{`[2, 3, 9]`},
+		},
+		{
+			Description: "overlapping matches",
+			Document:    `"aaa"`,
+			Expression:  `indices("aa")`,
+			Expected:    []string{`[0, 1]`},
+		},
+		{
+			Description: "indices of an element",
+			Document:    `[0, 1, 2, 1, 3, 1, 4]`,
+			Expression:  `indices(1)`,
+			Expected:    []string{`[1, 3, 5]`},
+		},
+		{
+			Description: "indices of a subarray",
+			Document:    `[0, 1, 2, 3, 1, 4, 2, 5, 1, 2, 6, 7]`,
+			Expression:  `indices([1, 2])`,
+			Expected:    []string{`[1, 8]`},
+		},
+		{
+			Description: "index and rindex in an array",
+			Document:    `["a", "b", "a"]`,
+			Expression:  `index("a"), rindex("a")`,
+			Expected:    []string{`0`, `2`},
+		},
+		{
+			Description: "no match",
+			Document:    `"abc"`,
+			Expression:  `indices("x"), index("x"), rindex("x")`,
+			Expected:    []string{`[]`, `null`, `null`},
+		},
+		{
+			Description: "indices of null",
+			Document:    `null`,
+			Expression:  `indices("x")`,
+			Expected:    []string{`null`},
+		},
+		{
+			Description:   "indices in a number",
+			Document:      `1`,
+			Expression:    `indices(1)`,
+			ExpectedError: "indices: cannot search number",
+		},
+	},
+}
+
+var sqlScenarios = ScenarioGroup{
+	Name:        "SQL-style operators",
+	Description: "IN, INDEX and JOIN",
+	Scenarios: []Scenario{
+		{
+			Description: "IN",
+			Document:    `"admin"`,
+			Expression:  `IN("admin", "root"), IN("user")`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "IN as a filter",
+			Document:    `[{"env": "prod"}, {"env": "dev"}, {"env": "stage"}]`,
+			Expression:  `map(select(.env | IN("prod", "stage")) | .env)`,
+			Expected:    []string{`["prod", "stage"]`},
+		},
+		{
+			Description: "IN with a source",
+			Document:    `{"ports": [22, 80]}`,
+			Expression:  `IN(.ports[]; 22, 23), IN(.ports[]; 443)`,
+			Expected:    []string{`true`, `false`},
+		},
+		{
+			Description: "IN stops at the first match",
+			Document:    `1`,
+			Expression:  `IN(1, error("not reached"))`,
+			Expected:    []string{`true`},
+		},
+		{
+			Description: "INDEX of the input elements",
+			Document:    `[{"id": 1, "name": "a"}, {"id": 2, "name": "b"}]`,
+			Expression:  `INDEX(.id)`,
+			Expected:    []string{`{"1": {"id": 1, "name": "a"}, "2": {"id": 2, "name": "b"}}`},
+		},
+		{
+			Description: "INDEX of a stream",
+			Document:    `{"users": [{"name": "alice", "team": "ops"}, {"name": "bob", "team": "dev"}]}`,
+			Expression:  `INDEX(.users[]; .name) | map_values(.team)`,
+			Expected:    []string{`{"alice": "ops", "bob": "dev"}`},
+		},
+		{
+			Description: "JOIN",
+			Document:    `{"orders": [{"user": "1", "item": "x"}], "users": [{"id": "1", "name": "alice"}]}`,
+			Expression:  `INDEX(.users[]; .id) as $users | .orders | JOIN($users; .user)`,
+			Expected:    []string{`[[{"user": "1", "item": "x"}, {"id": "1", "name": "alice"}]]`},
+		},
+		{
+			Description: "JOIN of a stream",
+			Document:    `{"orders": [{"user": "1"}, {"user": "2"}], "users": [{"id": "1", "name": "alice"}]}`,
+			Expression:  `[JOIN(INDEX(.users[]; .id); .orders[]; .user) | .[1].name]`,
+			Expected:    []string{`["alice", null]`},
+		},
+		{
+			Description: "JOIN with a join expression",
+			Document:    `{"orders": [{"user": "1", "item": "x"}], "users": [{"id": "1", "name": "alice"}]}`,
+			Expression:  `[JOIN(INDEX(.users[]; .id); .orders[]; .user; add)]`,
+			Expected:    []string{`[{"user": "1", "item": "x", "id": "1", "name": "alice"}]`},
+		},
+	},
+}
+
+func TestQuantifierScenarios(t *testing.T) {
+	runScenarios(t, quantifierScenarios)
+}
+
+func TestIsvalidScenarios(t *testing.T) {
+	runScenarios(t, isvalidScenarios)
+}
+
+func TestIndicesScenarios(t *testing.T) {
+	runScenarios(t, indicesScenarios)
+}
+
+func TestSQLScenarios(t *testing.T) {
+	runScenarios(t, sqlScenarios)
+}
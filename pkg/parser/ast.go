@@ -147,7 +147,7 @@ func (TryCatchNode) expressionNode() {}
 // AssignNode represents assignment (.foo = value)
 type AssignNode struct {
 	Path  ExpressionNode
-	Op    string // "=", "|=", "+=", "-="
+	Op    string // "=", "|=", "+=", "-=", "*=", "/=", "%=", "//="
 	Value ExpressionNode
 }
 
@@ -178,11 +178,19 @@ func (RecursiveDescentNode) expressionNode() {}
 // StringInterpolationNode represents a string with embedded expressions
 // e.g., "Hello, \(.name)!" has parts: ["Hello, ", expr(.name), "!"]
 type StringInterpolationNode struct {
-	Parts []StringPart
+	Parts  []StringPart
+	Format string // Format applied to interpolated values, e.g. "base64" for @base64 "..."
 }
 
 func (StringInterpolationNode) expressionNode() {}
 
+// FormatNode represents a format such as @base64 applied to the input
+type FormatNode struct {
+	Name string // Format name without the @
+}
+
+func (FormatNode) expressionNode() {}
+
 // StringPart is either a literal string or an expression to interpolate
 type StringPart struct {
 	Literal string         // Non-empty if this is a literal part
@@ -191,14 +199,42 @@ type StringPart struct {
 
 // ReduceNode represents reduce expression: reduce EXPR as $VAR (INIT; UPDATE)
 type ReduceNode struct {
-	Expr    ExpressionNode // The iterator expression (e.g., .[])
-	VarName string         // Variable name (without $)
-	Init    ExpressionNode // Initial accumulator value
-	Update  ExpressionNode // Update expression
+	Expr     ExpressionNode // The iterator expression (e.g., .[])
+	Patterns []*Pattern     // Binding for each value ($x or a destructuring pattern)
+	Init     ExpressionNode // Initial accumulator value
+	Update   ExpressionNode // Update expression
 }
 
 func (ReduceNode) expressionNode() {}
 
+// ForeachNode represents foreach expression: foreach EXPR as $VAR (INIT; UPDATE; EXTRACT)
+// Unlike reduce, it emits every intermediate state (passed through EXTRACT if present).
+type ForeachNode struct {
+	Expr     ExpressionNode // The iterator expression (e.g., .[])
+	Patterns []*Pattern     // Binding for each value ($x or a destructuring pattern)
+	Init     ExpressionNode // Initial state
+	Update   ExpressionNode // Update expression
+	Extract  ExpressionNode // Extract expression (nil means emit the state itself)
+}
+
+func (ForeachNode) expressionNode() {}
+
+// LabelNode represents label $NAME | BODY, which marks a point that
+// break $NAME can jump back to, ending BODY early.
+type LabelNode struct {
+	Name string         // Label name (without $)
+	Body ExpressionNode // The expression the label scopes over
+}
+
+func (LabelNode) expressionNode() {}
+
+// BreakNode represents break $NAME, which stops the enclosing label $NAME.
+type BreakNode struct {
+	Name string // Label name (without $)
+}
+
+func (BreakNode) expressionNode() {}
+
 // DynamicIndexNode represents dynamic index/key access .[$expr]
 // The index expression is evaluated at runtime to get the key/index
 type DynamicIndexNode struct {
@@ -210,10 +246,38 @@ func (DynamicIndexNode) expressionNode() {}
 
 // DestructureBindNode represents destructuring variable binding
 // e.g., .point as {x: $x, y: $y} | $x + $y
+// or, with alternatives, . as [$a] ?// {a: $a} | $a
 type DestructureBindNode struct {
-	Expr     ExpressionNode    // The expression to destructure
-	Bindings map[string]string // Maps field name to variable name (without $)
-	Body     ExpressionNode    // The body to evaluate with bindings
+	Expr     ExpressionNode // The expression to destructure
+	Patterns []*Pattern     // Alternatives separated by ?//, tried in order
+	Body     ExpressionNode // The body to evaluate with bindings
 }
 
 func (DestructureBindNode) expressionNode() {}
+
+// Pattern is a binding target in `as`, reduce and foreach: a variable ($x),
+// an array pattern ([$a, $b]) or an object pattern ({name: $n, $id}).
+// Exactly one of Var, Elements and Fields is set.
+type Pattern struct {
+	Var      string         // Variable name (without $)
+	Elements []*Pattern     // Patterns for .[0], .[1], ...
+	Fields   []PatternField // Patterns for object fields
+}
+
+// PatternField is one entry of an object pattern.
+type PatternField struct {
+	Key    ExpressionNode // Field name expression; nil for {$name}
+	KeyVar string         // For {$name} and {$name: pattern}: binds $name to .name
+	Value  *Pattern       // Pattern for the field value; nil for {$name}
+}
+
+// FunctionDefNode represents a user-defined function: def NAME(PARAMS): BODY; REST
+// The function is visible in its own body (for recursion) and in Rest.
+type FunctionDefNode struct {
+	Name   string
+	Params []string       // Parameter names; "$x" for value params, "f" for filter params
+	Body   ExpressionNode // The function body
+	Rest   ExpressionNode // The expression in which the function is in scope
+}
+
+func (FunctionDefNode) expressionNode() {}
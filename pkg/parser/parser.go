@@ -53,11 +53,34 @@ func (p *Parser) Parse(expr string) (ExpressionNode, error) {
 	if len(tokens) == 0 {
 		return nil, fmt.Errorf("empty expression after tokenization")
 	}
+	p.quoteKeywordNames(tokens)
 
 	// Parse tokens into AST
 	return p.parseExpression(tokens, 0)
 }
 
+// quoteKeywordNames turns keywords used as names into string tokens, so
+// .end reads as ."end" and {if: 1} as {"if": 1}, and the keyword scanning
+// for if/then/else/end does not trip over them. A keyword is a field name
+// when it touches the dot before it, and an object key when it is followed
+// by a colon.
+func (p *Parser) quoteKeywordNames(tokens []lexer.Token) {
+	stringType := p.lexer.Symbols()["String"]
+	for i := 1; i < len(tokens); i++ {
+		tok := tokens[i]
+		if !p.isTokenType(tok, "Keyword") {
+			continue
+		}
+		prev := tokens[i-1]
+		isField := prev.Value == "." && tok.Pos.Offset == prev.Pos.Offset+1
+		isKey := (prev.Value == "{" || prev.Value == ",") && i+1 < len(tokens) && tokens[i+1].Value == ":"
+		if isField || isKey {
+			tokens[i].Type = stringType
+			tokens[i].Value = `"` + tok.Value + `"`
+		}
+	}
+}
+
 // parseExpression is the main parsing entry point.
 // It handles pipe operator (lowest precedence) and dispatches to sub-parsers.
 func (p *Parser) parseExpression(tokens []lexer.Token, minPrec int) (ExpressionNode, error) {
@@ -80,6 +103,10 @@ func (p *Parser) parseExpressionTokens(tokens []lexer.Token, minPrec int) (Expre
 	if err != nil {
 		return nil, nil, err
 	}
+	left, rest, err = p.parsePostfix(left, rest)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	for len(rest) > 0 {
 		tok := rest[0]
@@ -99,57 +126,42 @@ func (p *Parser) parseExpressionTokens(tokens []lexer.Token, minPrec int) (Expre
 				return nil, nil, fmt.Errorf("expected variable after 'as'")
 			}
 
-			// Check for variable or destructuring pattern
-			if p.isTokenType(rest[0], "Variable") {
-				varName := rest[0].Value[1:] // Remove $
-				rest = rest[1:]
+			// Parse the variable or destructuring pattern(s)
+			patterns, newRest, err := p.parsePatterns(rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			rest = newRest
+			single := len(patterns) == 1 && patterns[0].Var != ""
 
-				// Expect | after variable
-				if len(rest) == 0 || rest[0].Value != "|" {
+			// Expect | after the binding
+			if len(rest) == 0 || rest[0].Value != "|" {
+				if single {
 					return nil, nil, fmt.Errorf("expected '|' after variable binding")
 				}
-				rest = rest[1:] // consume '|'
+				return nil, nil, fmt.Errorf("expected '|' after destructure pattern")
+			}
+			rest = rest[1:] // consume '|'
 
-				// Parse body (rest of expression)
-				var body ExpressionNode
-				body, rest, err = p.parseExpressionTokens(rest, 0)
-				if err != nil {
-					return nil, nil, err
-				}
+			// Parse body (rest of expression)
+			var body ExpressionNode
+			body, rest, err = p.parseExpressionTokens(rest, 0)
+			if err != nil {
+				return nil, nil, err
+			}
 
+			if single {
 				left = &VariableBindNode{
 					Expr:    left,
-					VarName: varName,
+					VarName: patterns[0].Var,
 					Body:    body,
 				}
-			} else if rest[0].Value == "{" {
-				// Parse destructuring pattern {key: $var, ...}
-				bindings, newRest, err := p.parseDestructurePattern(rest)
-				if err != nil {
-					return nil, nil, fmt.Errorf("parsing destructure pattern: %w", err)
-				}
-				rest = newRest
-
-				// Expect | after pattern
-				if len(rest) == 0 || rest[0].Value != "|" {
-					return nil, nil, fmt.Errorf("expected '|' after destructure pattern")
-				}
-				rest = rest[1:] // consume '|'
-
-				// Parse body (rest of expression)
-				var body ExpressionNode
-				body, rest, err = p.parseExpressionTokens(rest, 0)
-				if err != nil {
-					return nil, nil, err
-				}
-
+			} else {
 				left = &DestructureBindNode{
 					Expr:     left,
-					Bindings: bindings,
+					Patterns: patterns,
 					Body:     body,
 				}
-			} else {
-				return nil, nil, fmt.Errorf("expected variable after 'as', got %s", rest[0].Value)
 			}
 			continue
 		}
@@ -230,15 +242,15 @@ func (p *Parser) parsePrimary(tokens []lexer.Token) (ExpressionNode, []lexer.Tok
 
 	// String literal (may contain interpolation)
 	case p.isTokenType(tok, "String"):
-		// Remove quotes
-		s := tok.Value[1 : len(tok.Value)-1]
-		// Check for interpolation \(...)
-		if strings.Contains(s, `\(`) {
-			return p.parseStringInterpolation(s, tokens[1:])
+		node, err := p.parseStringLiteral(tok)
+		if err != nil {
+			return nil, nil, err
 		}
-		// Plain string - unescape
-		s = unescapeString(s)
-		return &LiteralNode{Value: s}, tokens[1:], nil
+		return node, tokens[1:], nil
+
+	// Format: @base64 on its own, or as a prefix of a string
+	case p.isTokenType(tok, "Format"):
+		return p.parseFormat(tokens)
 
 	// Boolean/null keywords
 	case tok.Value == "true":
@@ -250,25 +262,14 @@ func (p *Parser) parsePrimary(tokens []lexer.Token) (ExpressionNode, []lexer.Tok
 
 	// Variable (may be followed by field access like $u.name)
 	case p.isTokenType(tok, "Variable"):
-		var node ExpressionNode = &VariableNode{Name: tok.Value[1:]}
+		node := variableReference(tok)
 		rest := tokens[1:]
 		// Check for chained field access
 		for len(rest) > 0 && rest[0].Value == "." {
-			rest = rest[1:] // consume .
-			if len(rest) == 0 {
-				return nil, nil, fmt.Errorf("unexpected end of expression after dot")
-			}
-			if p.isTokenType(rest[0], "Ident") {
-				node = &FieldAccessNode{Field: rest[0].Value, From: node}
-				rest = rest[1:]
-			} else if rest[0].Value == "[" {
-				var err error
-				node, rest, err = p.parseBracketAccess(node, rest)
-				if err != nil {
-					return nil, nil, err
-				}
-			} else {
-				return nil, nil, fmt.Errorf("expected identifier after ., got %s", rest[0].Value)
+			var err error
+			node, rest, err = p.parseChainedAccess(node, rest)
+			if err != nil {
+				return nil, nil, err
 			}
 		}
 		return node, rest, nil
@@ -282,12 +283,30 @@ func (p *Parser) parsePrimary(tokens []lexer.Token) (ExpressionNode, []lexer.Tok
 	}
 }
 
+// variableReference builds the node for a $name token. $__loc__ is replaced
+// by its own location, as in jq.
+func variableReference(tok lexer.Token) ExpressionNode {
+	if tok.Value == "$__loc__" {
+		return &LiteralNode{Value: map[string]any{"file": "<stdin>", "line": float64(tok.Pos.Line)}}
+	}
+	return &VariableNode{Name: tok.Value[1:]}
+}
+
 // parseDotExpression handles expressions starting with .
 func (p *Parser) parseDotExpression(tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
 	// Consume the .
 	rest := tokens[1:]
 	var node ExpressionNode = &IdentityNode{}
 
+	// A name directly after the dot: .foo, .end, ."pool-size"
+	field, after, ok, err := p.parseDotField(node, rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		node, rest = field, after
+	}
+
 	// Check what follows the .
 	for len(rest) > 0 {
 		tok := rest[0]
@@ -308,24 +327,10 @@ func (p *Parser) parseDotExpression(tokens []lexer.Token) (ExpressionNode, []lex
 
 		// Chained dot access: .user.name (the second . starts another field)
 		case tok.Value == ".":
-			// Consume the .
-			rest = rest[1:]
-			if len(rest) == 0 {
-				return nil, nil, fmt.Errorf("unexpected end of expression after dot")
-			}
-			// Next token should be an identifier or [
-			nextTok := rest[0]
-			if p.isTokenType(nextTok, "Ident") {
-				node = &FieldAccessNode{Field: nextTok.Value, From: node}
-				rest = rest[1:]
-			} else if nextTok.Value == "[" {
-				var err error
-				node, rest, err = p.parseBracketAccess(node, rest)
-				if err != nil {
-					return nil, nil, err
-				}
-			} else {
-				return nil, nil, fmt.Errorf("expected identifier or [ after ., got %s", nextTok.Value)
+			var err error
+			node, rest, err = p.parseChainedAccess(node, rest)
+			if err != nil {
+				return nil, nil, err
 			}
 
 		// Optional operator: expr?
@@ -342,6 +347,85 @@ func (p *Parser) parseDotExpression(tokens []lexer.Token) (ExpressionNode, []lex
 	return node, rest, nil
 }
 
+// parsePostfix applies .name, ."key", [...] and ? suffixes to a primary
+// expression, as in env.HOME, keys[0] or (.a // .b).c
+func (p *Parser) parsePostfix(node ExpressionNode, tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	rest := tokens
+	for len(rest) > 0 {
+		var err error
+		switch rest[0].Value {
+		case ".":
+			node, rest, err = p.parseChainedAccess(node, rest)
+		case "[":
+			node, rest, err = p.parseBracketAccess(node, rest)
+		case "?":
+			node = &OptionalNode{Expr: node}
+			rest = rest[1:]
+		default:
+			return node, rest, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return node, rest, nil
+}
+
+// parseChainedAccess handles the .name, ."key" or .[...] that follows an
+// expression, as in .user.name or $u."display-name".
+func (p *Parser) parseChainedAccess(from ExpressionNode, tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	dot := tokens[0]
+	rest := tokens[1:]
+	if len(rest) == 0 {
+		return nil, nil, errorAt(dot, "expected field name after .")
+	}
+
+	if rest[0].Value == "[" {
+		return p.parseBracketAccess(from, rest)
+	}
+
+	node, rest, ok, err := p.parseDotField(from, rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errorAt(rest[0], "expected field name after ., got %s", rest[0].Value)
+	}
+	return node, rest, nil
+}
+
+// parseDotField parses the field name following a dot, if there is one.
+// Keywords such as .end arrive here as strings (see quoteKeywordNames).
+func (p *Parser) parseDotField(from ExpressionNode, tokens []lexer.Token) (ExpressionNode, []lexer.Token, bool, error) {
+	if len(tokens) == 0 {
+		return nil, tokens, false, nil
+	}
+
+	tok := tokens[0]
+	switch {
+	case p.isTokenType(tok, "Ident"):
+		return &FieldAccessNode{Field: tok.Value, From: from}, tokens[1:], true, nil
+
+	case p.isTokenType(tok, "String"):
+		// ."key" or ."\(.prefix)-key"
+		key, err := p.parseStringLiteral(tok)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if lit, ok := key.(*LiteralNode); ok {
+			return &FieldAccessNode{Field: lit.Value.(string), From: from}, tokens[1:], true, nil
+		}
+		return &DynamicIndexNode{Index: key, From: from}, tokens[1:], true, nil
+	}
+
+	return nil, tokens, false, nil
+}
+
+// errorAt returns a parse error pointing at the position of tok.
+func errorAt(tok lexer.Token, format string, args ...any) error {
+	return fmt.Errorf("%s at line %d, column %d", fmt.Sprintf(format, args...), tok.Pos.Line, tok.Pos.Column)
+}
+
 // parseBracketAccess handles .[n], .["key"], .[start:end], .[]
 func (p *Parser) parseBracketAccess(from ExpressionNode, tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
 	// Consume [
@@ -356,15 +440,16 @@ func (p *Parser) parseBracketAccess(from ExpressionNode, tokens []lexer.Token) (
 		return &IteratorNode{From: from}, rest[1:], nil
 	}
 
-	// Check for string key
-	if p.isTokenType(rest[0], "String") {
-		key := rest[0].Value[1 : len(rest[0].Value)-1]
-		key = unescapeString(key)
-		rest = rest[1:]
-		if len(rest) == 0 || rest[0].Value != "]" {
-			return nil, nil, fmt.Errorf("expected ] after bracket key")
+	// Check for string key; interpolated strings and longer expressions
+	// are handled as dynamic indexes below
+	if p.isTokenType(rest[0], "String") && len(rest) > 1 && rest[1].Value == "]" {
+		key, err := p.parseStringLiteral(rest[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if lit, ok := key.(*LiteralNode); ok {
+			return &FieldAccessNode{Field: lit.Value.(string), From: from}, rest[2:], nil
 		}
-		return &FieldAccessNode{Field: key, From: from}, rest[1:], nil
 	}
 
 	// Helper to parse a possibly-negative number
@@ -544,8 +629,6 @@ func (p *Parser) parseObjectConstruct(tokens []lexer.Token) (ExpressionNode, []l
 		return nil, nil, fmt.Errorf("unmatched brace")
 	}
 
-	// For now, parse as simple key: value pairs
-	// TODO: Full implementation with shorthand, computed keys, etc.
 	inner := rest[:end]
 	fields, err := p.parseObjectFields(inner)
 	if err != nil {
@@ -560,13 +643,15 @@ func (p *Parser) parseObjectFields(tokens []lexer.Token) ([]ObjectFieldNode, err
 	var fields []ObjectFieldNode
 
 	for len(tokens) > 0 {
-		// Parse key
-		var key ExpressionNode
+		// Parse key; shorthand forms also set the value
+		var key, value ExpressionNode
 		var shorthand bool
 
 		tok := tokens[0]
-		if p.isTokenType(tok, "Ident") {
-			// Could be shorthand {foo} or key {foo: ...}
+		switch {
+		case p.isTokenType(tok, "Ident") || p.isTokenType(tok, "Keyword"):
+			// Could be shorthand {foo} or key {foo: ...}; {if} is a keyword
+			// shorthand, while {if: 1} arrives as a string key
 			if len(tokens) > 1 && tokens[1].Value == ":" {
 				// Full form: foo: expr
 				key = &LiteralNode{Value: tok.Value}
@@ -579,16 +664,47 @@ func (p *Parser) parseObjectFields(tokens []lexer.Token) ([]ObjectFieldNode, err
 			} else {
 				return nil, fmt.Errorf("unexpected token after identifier in object: %s", tokens[1].Value)
 			}
-		} else if p.isTokenType(tok, "String") {
-			// String key
-			keyStr := tok.Value[1 : len(tok.Value)-1]
-			key = &LiteralNode{Value: unescapeString(keyStr)}
+		case p.isTokenType(tok, "Variable"):
+			if len(tokens) > 1 && tokens[1].Value == ":" {
+				// {$k: expr} uses the value of $k as the key
+				key = &VariableNode{Name: tok.Value[1:]}
+				tokens = tokens[2:]
+			} else if len(tokens) == 1 || tokens[1].Value == "," {
+				// Shorthand: {$x} means {x: $x}
+				key = &LiteralNode{Value: tok.Value[1:]}
+				value = variableReference(tok)
+				tokens = tokens[1:]
+			} else {
+				return nil, fmt.Errorf("unexpected token after variable in object: %s", tokens[1].Value)
+			}
+		case p.isTokenType(tok, "String"):
+			// String key, possibly interpolated: {"\(.k)": v}
+			var err error
+			key, err = p.parseStringLiteral(tok)
+			if err != nil {
+				return nil, err
+			}
 			tokens = tokens[1:]
-			if len(tokens) == 0 || tokens[0].Value != ":" {
+			if len(tokens) == 0 || tokens[0].Value == "," {
+				// Shorthand: {"a b"} means {"a b": .["a b"]}
+				value = &DynamicIndexNode{Index: key}
+			} else if tokens[0].Value != ":" {
 				return nil, fmt.Errorf("expected : after string key")
+			} else {
+				tokens = tokens[1:]
+			}
+		case p.isTokenType(tok, "Format"):
+			// Format key: {@base64 "\(.k)": v} or {@base64: v}
+			var err error
+			key, tokens, err = p.parseFormat(tokens)
+			if err != nil {
+				return nil, err
+			}
+			if len(tokens) == 0 || tokens[0].Value != ":" {
+				return nil, fmt.Errorf("expected : after format key")
 			}
 			tokens = tokens[1:]
-		} else if tok.Value == "(" {
+		case tok.Value == "(":
 			// Computed key: {(.expr): value}
 			tokens = tokens[1:] // consume (
 
@@ -623,16 +739,15 @@ func (p *Parser) parseObjectFields(tokens []lexer.Token) ([]ObjectFieldNode, err
 				return nil, fmt.Errorf("expected : after computed key")
 			}
 			tokens = tokens[1:]
-		} else {
+		default:
 			return nil, fmt.Errorf("unexpected token in object key: %s", tok.Value)
 		}
 
 		// Parse value (or use shorthand)
-		var value ExpressionNode
 		if shorthand {
 			keyStr := key.(*LiteralNode).Value.(string)
 			value = &FieldAccessNode{Field: keyStr, From: &IdentityNode{}}
-		} else {
+		} else if value == nil {
 			// Find the extent of the value (until , or end)
 			end := 0
 			depth := 0
@@ -683,6 +798,20 @@ func (p *Parser) parseFunctionOrKeyword(tokens []lexer.Token) (ExpressionNode, [
 		return p.parseTryCatch(rest)
 	case "reduce":
 		return p.parseReduce(rest)
+	case "foreach":
+		return p.parseForeach(rest)
+	case "def":
+		return p.parseFunctionDef(rest)
+	case "label":
+		// label $name | body (a bare "label" is an ordinary function call)
+		if len(rest) > 0 && p.isTokenType(rest[0], "Variable") {
+			return p.parseLabel(rest)
+		}
+	case "break":
+		if len(rest) > 0 && p.isTokenType(rest[0], "Variable") {
+			return &BreakNode{Name: rest[0].Value[1:]}, rest[1:], nil
+		}
+		return nil, nil, fmt.Errorf("expected label variable after 'break'")
 	case "empty":
 		return &FunctionCallNode{Name: "empty", Args: nil}, rest, nil
 	case "not":
@@ -739,14 +868,21 @@ func (p *Parser) parseFunctionCall(name string, tokens []lexer.Token) (Expressio
 	var args []ExpressionNode
 
 	if len(argTokens) > 0 {
-		// Split by ; at depth 0
+		// Split by ; at depth 0 (a nested def consumes its own ;)
 		var current []lexer.Token
 		argDepth := 0
+		pendingDefs := 0
 		for _, tok := range argTokens {
 			if tok.Value == "(" || tok.Value == "[" || tok.Value == "{" {
 				argDepth++
 			} else if tok.Value == ")" || tok.Value == "]" || tok.Value == "}" {
 				argDepth--
+			} else if argDepth == 0 && tok.Value == "def" {
+				pendingDefs++
+			} else if argDepth == 0 && tok.Value == ";" && pendingDefs > 0 {
+				pendingDefs--
+				current = append(current, tok)
+				continue
 			}
 			if argDepth == 0 && tok.Value == ";" {
 				if len(current) > 0 {
@@ -893,64 +1029,151 @@ func (p *Parser) extractUntilKeywords(tokens []lexer.Token, keywords []string) (
 	return nil, nil, ""
 }
 
-// parseDestructurePattern parses a destructuring pattern like {x: $x, y: $y}
-// Returns a map from field name to variable name (without $)
-func (p *Parser) parseDestructurePattern(tokens []lexer.Token) (map[string]string, []lexer.Token, error) {
-	if len(tokens) == 0 || tokens[0].Value != "{" {
-		return nil, nil, fmt.Errorf("expected '{' at start of destructure pattern")
+// parsePatterns parses the binding after 'as': a single pattern, or
+// alternatives separated by ?// as in . as [$a] ?// $a | ...
+func (p *Parser) parsePatterns(tokens []lexer.Token) ([]*Pattern, []lexer.Token, error) {
+	var patterns []*Pattern
+	for {
+		pattern, rest, err := p.parsePattern(tokens)
+		if err != nil {
+			return nil, nil, err
+		}
+		patterns = append(patterns, pattern)
+
+		if len(rest) < 2 || rest[0].Value != "?" || rest[1].Value != "//" {
+			return patterns, rest, nil
+		}
+		tokens = rest[2:] // consume ?//
 	}
-	rest := tokens[1:] // consume '{'
+}
 
-	bindings := make(map[string]string)
+// parsePattern parses $name, an array pattern [p, ...] or an object
+// pattern {key: p, $name, "str": p, (expr): p}
+func (p *Parser) parsePattern(tokens []lexer.Token) (*Pattern, []lexer.Token, error) {
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("expected variable or pattern after 'as'")
+	}
+
+	tok := tokens[0]
+	switch {
+	case p.isTokenType(tok, "Variable"):
+		return &Pattern{Var: tok.Value[1:]}, tokens[1:], nil
+	case tok.Value == "[":
+		return p.parseArrayPattern(tokens)
+	case tok.Value == "{":
+		return p.parseObjectPattern(tokens)
+	}
+	return nil, nil, fmt.Errorf("expected variable after 'as', got %s", tok.Value)
+}
+
+// parseArrayPattern parses [p0, p1, ...], which binds p0 to .[0] and so on
+func (p *Parser) parseArrayPattern(tokens []lexer.Token) (*Pattern, []lexer.Token, error) {
+	rest := tokens[1:] // consume '['
+	pattern := &Pattern{}
 
 	for {
-		if len(rest) == 0 {
-			return nil, nil, fmt.Errorf("unexpected end of destructure pattern")
+		elem, next, err := p.parsePattern(rest)
+		if err != nil {
+			return nil, nil, err
 		}
+		pattern.Elements = append(pattern.Elements, elem)
+		rest = next
 
-		// Check for closing brace
-		if rest[0].Value == "}" {
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("unexpected end of array pattern")
+		}
+		switch rest[0].Value {
+		case ",":
 			rest = rest[1:]
-			break
+		case "]":
+			return pattern, rest[1:], nil
+		default:
+			return nil, nil, fmt.Errorf("expected ',' or ']' in array pattern, got %s", rest[0].Value)
+		}
+	}
+}
+
+// parseObjectPattern parses {key: p, $name, $name: p, "str": p, (expr): p}
+func (p *Parser) parseObjectPattern(tokens []lexer.Token) (*Pattern, []lexer.Token, error) {
+	rest := tokens[1:] // consume '{'
+	pattern := &Pattern{}
+
+	for {
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("unexpected end of destructure pattern")
 		}
 
-		// Parse field name
-		var fieldName string
-		if p.isTokenType(rest[0], "Ident") {
-			fieldName = rest[0].Value
+		// Parse the key
+		var field PatternField
+		tok := rest[0]
+		switch {
+		case p.isTokenType(tok, "Variable"):
+			// {$name} binds .name to $name; {$name: p} also destructures it
+			field.KeyVar = tok.Value[1:]
+			rest = rest[1:]
+		case p.isTokenType(tok, "Ident") || p.isTokenType(tok, "Keyword"):
+			field.Key = &LiteralNode{Value: tok.Value}
 			rest = rest[1:]
-		} else if p.isTokenType(rest[0], "String") {
-			if len(rest[0].Value) < 2 {
-				return nil, nil, fmt.Errorf("invalid string in destructure pattern")
+		case p.isTokenType(tok, "String"):
+			key, err := p.parseStringLiteral(tok)
+			if err != nil {
+				return nil, nil, err
 			}
-			fieldName = rest[0].Value[1 : len(rest[0].Value)-1]
+			field.Key = key
 			rest = rest[1:]
-		} else {
-			return nil, nil, fmt.Errorf("expected field name in destructure pattern, got %s", rest[0].Value)
+		case tok.Value == "(":
+			// Computed key: {(.expr): $v}
+			depth := 0
+			end := -1
+			for i, t := range rest {
+				if t.Value == "(" {
+					depth++
+				} else if t.Value == ")" {
+					depth--
+					if depth == 0 {
+						end = i
+						break
+					}
+				}
+			}
+			if end == -1 {
+				return nil, nil, fmt.Errorf("unmatched parenthesis in destructure pattern")
+			}
+			key, _, err := p.parseExpressionTokens(rest[1:end], 0)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing computed key: %w", err)
+			}
+			field.Key = key
+			rest = rest[end+1:]
+		default:
+			return nil, nil, fmt.Errorf("expected field name in destructure pattern, got %s", tok.Value)
 		}
 
-		// Expect colon
-		if len(rest) == 0 || rest[0].Value != ":" {
+		// Parse the value pattern; only {$name} may leave it out
+		if len(rest) > 0 && rest[0].Value == ":" {
+			value, next, err := p.parsePattern(rest[1:])
+			if err != nil {
+				return nil, nil, err
+			}
+			field.Value = value
+			rest = next
+		} else if field.KeyVar == "" {
 			return nil, nil, fmt.Errorf("expected ':' after field name in destructure pattern")
 		}
-		rest = rest[1:] // consume ':'
+		pattern.Fields = append(pattern.Fields, field)
 
-		// Expect variable
-		if len(rest) == 0 || !p.isTokenType(rest[0], "Variable") {
-			return nil, nil, fmt.Errorf("expected variable after ':' in destructure pattern")
+		if len(rest) == 0 {
+			return nil, nil, fmt.Errorf("unexpected end of destructure pattern")
 		}
-		varName := rest[0].Value[1:] // Remove $
-		rest = rest[1:]
-
-		bindings[fieldName] = varName
-
-		// Check for comma or closing brace
-		if len(rest) > 0 && rest[0].Value == "," {
-			rest = rest[1:] // consume ','
+		switch rest[0].Value {
+		case ",":
+			rest = rest[1:]
+		case "}":
+			return pattern, rest[1:], nil
+		default:
+			return nil, nil, fmt.Errorf("expected ',' or '}' in destructure pattern, got %s", rest[0].Value)
 		}
 	}
-
-	return bindings, rest, nil
 }
 
 // parseReduce parses reduce expression
@@ -971,12 +1194,11 @@ func (p *Parser) parseReduce(tokens []lexer.Token) (ExpressionNode, []lexer.Toke
 	// Skip 'as'
 	rest = rest[1:]
 
-	// Expect variable
-	if len(rest) == 0 || !p.isTokenType(rest[0], "Variable") {
-		return nil, nil, fmt.Errorf("expected variable after 'as' in reduce")
+	// Parse the variable or destructuring pattern(s)
+	patterns, rest, err := p.parsePatterns(rest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing reduce pattern: %w", err)
 	}
-	varName := rest[0].Value[1:] // Remove $
-	rest = rest[1:]
 
 	// Expect (
 	if len(rest) == 0 || rest[0].Value != "(" {
@@ -1039,10 +1261,213 @@ func (p *Parser) parseReduce(tokens []lexer.Token) (ExpressionNode, []lexer.Toke
 	}
 
 	return &ReduceNode{
-		Expr:    expr,
-		VarName: varName,
-		Init:    initExpr,
-		Update:  updateExpr,
+		Expr:     expr,
+		Patterns: patterns,
+		Init:     initExpr,
+		Update:   updateExpr,
+	}, rest[end+1:], nil
+}
+
+// parseLabel parses a label expression
+// Format: label $NAME | BODY
+func (p *Parser) parseLabel(tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	name := tokens[0].Value[1:] // Remove $
+	rest := tokens[1:]
+
+	// Expect | after label name
+	if len(rest) == 0 || rest[0].Value != "|" {
+		return nil, nil, fmt.Errorf("expected '|' after label $%s", name)
+	}
+	rest = rest[1:]
+
+	// The label scopes over the rest of the pipeline
+	body, rest, err := p.parseExpressionTokens(rest, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &LabelNode{Name: name, Body: body}, rest, nil
+}
+
+// parseFunctionDef parses a function definition
+// Format: def NAME: BODY; REST  or  def NAME(PARAM; ...): BODY; REST
+// Parameters are either filter names (f) or value parameters ($x).
+func (p *Parser) parseFunctionDef(tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	if len(tokens) == 0 || !p.isTokenType(tokens[0], "Ident") {
+		return nil, nil, fmt.Errorf("expected function name after 'def'")
+	}
+	name := tokens[0].Value
+	rest := tokens[1:]
+
+	// Parse optional parameter list
+	var params []string
+	if len(rest) > 0 && rest[0].Value == "(" {
+		rest = rest[1:] // consume (
+		for {
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("unexpected end of parameter list in def %s", name)
+			}
+			switch {
+			case p.isTokenType(rest[0], "Ident"):
+				params = append(params, rest[0].Value)
+			case p.isTokenType(rest[0], "Variable"):
+				params = append(params, rest[0].Value)
+			default:
+				return nil, nil, fmt.Errorf("expected parameter name in def %s, got %s", name, rest[0].Value)
+			}
+			rest = rest[1:]
+
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("unexpected end of parameter list in def %s", name)
+			}
+			if rest[0].Value == ";" {
+				rest = rest[1:]
+				continue
+			}
+			if rest[0].Value == ")" {
+				rest = rest[1:]
+				break
+			}
+			return nil, nil, fmt.Errorf("expected ';' or ')' in parameter list of def %s, got %s", name, rest[0].Value)
+		}
+	}
+
+	// Expect :
+	if len(rest) == 0 || rest[0].Value != ":" {
+		return nil, nil, fmt.Errorf("expected ':' after def %s", name)
+	}
+	rest = rest[1:]
+
+	// Find the ; that ends the body (nested defs consume their own ;)
+	depth := 0
+	pendingDefs := 0
+	end := -1
+	for i, tok := range rest {
+		if tok.Value == "(" || tok.Value == "[" || tok.Value == "{" {
+			depth++
+		} else if tok.Value == ")" || tok.Value == "]" || tok.Value == "}" {
+			depth--
+		} else if depth == 0 && tok.Value == "def" {
+			pendingDefs++
+		} else if depth == 0 && tok.Value == ";" {
+			if pendingDefs == 0 {
+				end = i
+				break
+			}
+			pendingDefs--
+		}
+	}
+	if end == -1 {
+		return nil, nil, fmt.Errorf("expected ';' after body of def %s", name)
+	}
+
+	body, _, err := p.parseExpressionTokens(rest[:end], 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing body of def %s: %w", name, err)
+	}
+	rest = rest[end+1:]
+
+	// A definition with nothing after it behaves like identity
+	var scopeExpr ExpressionNode = &IdentityNode{}
+	if len(rest) > 0 {
+		scopeExpr, rest, err = p.parseExpressionTokens(rest, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &FunctionDefNode{
+		Name:   name,
+		Params: params,
+		Body:   body,
+		Rest:   scopeExpr,
+	}, rest, nil
+}
+
+// parseForeach parses foreach expression
+// Format: foreach EXPR as $VAR (INIT; UPDATE) or foreach EXPR as $VAR (INIT; UPDATE; EXTRACT)
+func (p *Parser) parseForeach(tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	// Parse iterator expression until 'as'
+	exprTokens, rest := p.extractUntilKeyword(tokens, "as")
+	if rest == nil {
+		return nil, nil, fmt.Errorf("expected 'as' in foreach expression")
+	}
+
+	expr, _, err := p.parseExpressionTokens(exprTokens, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing foreach iterator: %w", err)
+	}
+
+	// Skip 'as'
+	rest = rest[1:]
+
+	// Parse the variable or destructuring pattern(s)
+	patterns, rest, err := p.parsePatterns(rest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing foreach pattern: %w", err)
+	}
+
+	// Expect (
+	if len(rest) == 0 || rest[0].Value != "(" {
+		return nil, nil, fmt.Errorf("expected '(' after variable in foreach")
+	}
+	rest = rest[1:]
+
+	// Find matching ) and split the clauses by ; at depth 0
+	var clauses [][]lexer.Token
+	depth := 1
+	end := -1
+	start := 0
+	for i, tok := range rest {
+		if tok.Value == "(" || tok.Value == "[" || tok.Value == "{" {
+			depth++
+		} else if tok.Value == ")" || tok.Value == "]" || tok.Value == "}" {
+			depth--
+			if depth == 0 {
+				end = i
+				break
+			}
+		} else if depth == 1 && tok.Value == ";" {
+			clauses = append(clauses, rest[start:i])
+			start = i + 1
+		}
+	}
+	if end == -1 {
+		return nil, nil, fmt.Errorf("unmatched parenthesis in foreach")
+	}
+	clauses = append(clauses, rest[start:end])
+
+	if len(clauses) != 2 && len(clauses) != 3 {
+		return nil, nil, fmt.Errorf("expected (init; update) or (init; update; extract) in foreach")
+	}
+
+	// Parse init
+	initExpr, _, err := p.parseExpressionTokens(clauses[0], 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing foreach init: %w", err)
+	}
+
+	// Parse update
+	updateExpr, _, err := p.parseExpressionTokens(clauses[1], 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing foreach update: %w", err)
+	}
+
+	// Parse optional extract
+	var extractExpr ExpressionNode
+	if len(clauses) == 3 {
+		extractExpr, _, err = p.parseExpressionTokens(clauses[2], 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing foreach extract: %w", err)
+		}
+	}
+
+	return &ForeachNode{
+		Expr:     expr,
+		Patterns: patterns,
+		Init:     initExpr,
+		Update:   updateExpr,
+		Extract:  extractExpr,
 	}, rest[end+1:], nil
 }
 
@@ -1099,16 +1524,16 @@ func (p *Parser) parseTryCatch(tokens []lexer.Token) (ExpressionNode, []lexer.To
 // getOperatorPrecedence returns the precedence and right-associativity of an operator
 func (p *Parser) getOperatorPrecedence(op string) (int, bool) {
 	switch op {
-	case "=", "|=", "+=", "-=", "*=", "//=":
-		return 0, true // Assignment has lowest precedence, right-associative
 	case "|":
-		return 1, false
+		return 0, false // Pipe has lowest precedence, so .a | .b = 1 updates .a
 	case ",":
-		return 2, false
+		return 1, false
 	case "as":
-		return 3, true // 'as' binds tighter than comma, looser than pipe
+		return 2, true // 'as' binds tighter than comma, looser than pipe
 	case "//":
-		return 4, true
+		return 3, true
+	case "=", "|=", "+=", "-=", "*=", "/=", "%=", "//=":
+		return 4, true // Assignment binds tighter than // and , but looser than or
 	case "or":
 		return 5, false
 	case "and":
@@ -1139,7 +1564,7 @@ func (p *Parser) buildBinaryNode(op string, left, right ExpressionNode) Expressi
 		return &CommaNode{Expressions: []ExpressionNode{left, right}}
 	case "//":
 		return &AlternativeNode{Left: left, Right: right}
-	case "=", "|=", "+=", "-=", "*=", "//=":
+	case "=", "|=", "+=", "-=", "*=", "/=", "%=", "//=":
 		return &AssignNode{Path: left, Op: op, Value: right}
 	case "as":
 		// For "expr as $var | body", right should be parsed as "var | body"
@@ -1167,6 +1592,38 @@ func unescapeString(s string) string {
 	return s
 }
 
+// parseStringLiteral parses a String token into a literal, or into a
+// StringInterpolationNode if it contains \(...).
+func (p *Parser) parseStringLiteral(tok lexer.Token) (ExpressionNode, error) {
+	// Remove quotes
+	s := tok.Value[1 : len(tok.Value)-1]
+	if strings.Contains(s, `\(`) {
+		node, _, err := p.parseStringInterpolation(s, nil)
+		return node, err
+	}
+	return &LiteralNode{Value: unescapeString(s)}, nil
+}
+
+// parseFormat handles @name, which formats its input as a string, and
+// @name "...\(expr)...", which formats each interpolated value.
+func (p *Parser) parseFormat(tokens []lexer.Token) (ExpressionNode, []lexer.Token, error) {
+	name := tokens[0].Value[1:]
+	rest := tokens[1:]
+	if len(rest) == 0 || !p.isTokenType(rest[0], "String") {
+		return &FormatNode{Name: name}, rest, nil
+	}
+
+	node, err := p.parseStringLiteral(rest[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	// Literal text is never formatted, only interpolated values
+	if interp, ok := node.(*StringInterpolationNode); ok {
+		interp.Format = name
+	}
+	return node, rest[1:], nil
+}
+
 // parseStringInterpolation parses a string containing \(...) interpolations
 func (p *Parser) parseStringInterpolation(s string, rest []lexer.Token) (ExpressionNode, []lexer.Token, error) {
 	var parts []StringPart
@@ -15,7 +15,7 @@ var hqLexer = lexer.MustSimple([]lexer.SimpleRule{
 	{Name: "Keyword", Pattern: `\b(if|then|elif|else|end|as|and|or|not|true|false|null|try|catch|reduce|foreach|def|empty)\b`},
 
 	// Operators (multi-char first)
-	{Name: "Operator", Pattern: `==|!=|<=|>=|\|=|\+=|-=|\*=|//=|//|\.\.|<|>|\||\+|-|\*|/|%|=`},
+	{Name: "Operator", Pattern: `==|!=|<=|>=|\|=|\+=|-=|\*=|//=|//|/=|%=|\.\.|<|>|\||\+|-|\*|/|%|=`},
 
 	// Punctuation
 	{Name: "Punct", Pattern: `[.,;:?\[\]{}()]`},
@@ -29,6 +29,9 @@ var hqLexer = lexer.MustSimple([]lexer.SimpleRule{
 	// Variable ($name)
 	{Name: "Variable", Pattern: `\$[a-zA-Z_][a-zA-Z0-9_]*`},
 
+	// Format (@base64, @csv, ...)
+	{Name: "Format", Pattern: `@[a-zA-Z0-9_]+`},
+
 	// Identifier (field names, function names)
 	{Name: "Ident", Pattern: `[a-zA-Z_][a-zA-Z0-9_]*`},
 })
@@ -1,5 +1,13 @@
 package types
 
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rhnvrm/hq/pkg/parser"
+)
+
 // Context holds evaluation state during expression evaluation.
 type Context struct {
 	// MatchingNodes are the current nodes being processed.
@@ -11,6 +19,34 @@ type Context struct {
 
 	// ReadOnlyVariables are variables that cannot be reassigned.
 	ReadOnlyVariables map[string]any
+
+	// Functions holds user-defined functions in scope, keyed by name/arity (e.g. "f/1").
+	Functions map[string]*FunctionDef
+
+	// Inputs is the document stream read by input and inputs (nil if there is none).
+	// It is shared by all clones of a context.
+	Inputs *Inputs
+
+	// Now is the time reported by now. The zero value means the clock is read.
+	Now time.Time
+
+	// Regexps caches compiled regular expressions by flags and pattern.
+	// It is shared by all clones of a context.
+	Regexps map[string]*regexp.Regexp
+}
+
+// FunctionDef is a user-defined function (or filter argument) together with
+// the scope it was defined in, so its body sees the variables and functions
+// that were visible at the definition site.
+type FunctionDef struct {
+	// Params are the parameter names; "$x" for value params, "f" for filter params.
+	Params []string
+
+	// Body is the function body.
+	Body parser.ExpressionNode
+
+	// Scope is the context the function closes over.
+	Scope *Context
 }
 
 // NewContext creates a new evaluation context from input data.
@@ -19,11 +55,13 @@ func NewContext(input any) *Context {
 		MatchingNodes:     []*CandidateNode{NewCandidateNode(input)},
 		Variables:         make(map[string]any),
 		ReadOnlyVariables: make(map[string]any),
+		Functions:         make(map[string]*FunctionDef),
+		Regexps:           make(map[string]*regexp.Regexp),
 	}
 }
 
-// Clone creates a copy of the context with new MatchingNodes slice and Variables map.
-// New variables map inherits existing values but can be modified independently.
+// Clone creates a copy of the context with new MatchingNodes slice, Variables and Functions maps.
+// New maps inherit existing values but can be modified independently.
 func (c *Context) Clone() *Context {
 	nodes := make([]*CandidateNode, len(c.MatchingNodes))
 	copy(nodes, c.MatchingNodes)
@@ -34,10 +72,20 @@ func (c *Context) Clone() *Context {
 		vars[k] = v
 	}
 
+	// Copy function scope
+	funcs := make(map[string]*FunctionDef, len(c.Functions))
+	for k, v := range c.Functions {
+		funcs[k] = v
+	}
+
 	return &Context{
 		MatchingNodes:     nodes,
 		Variables:         vars,
 		ReadOnlyVariables: c.ReadOnlyVariables,
+		Functions:         funcs,
+		Inputs:            c.Inputs,
+		Now:               c.Now,
+		Regexps:           c.Regexps,
 	}
 }
 
@@ -59,3 +107,14 @@ func (c *Context) GetVariable(name string) (any, bool) {
 	v, ok := c.Variables[name]
 	return v, ok
 }
+
+// GetFunction returns the user-defined function with the given name and arity.
+func (c *Context) GetFunction(name string, arity int) (*FunctionDef, bool) {
+	fn, ok := c.Functions[FunctionKey(name, arity)]
+	return fn, ok
+}
+
+// FunctionKey returns the scope key for a function with the given name and arity.
+func FunctionKey(name string, arity int) string {
+	return name + "/" + strconv.Itoa(arity)
+}
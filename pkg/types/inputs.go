@@ -0,0 +1,32 @@
+package types
+
+// Inputs is a stream of input documents. Documents are read on demand, so a
+// program that never calls input or inputs does not read ahead.
+type Inputs struct {
+	next  func() (any, bool, error)
+	count int
+	done  bool
+}
+
+// NewInputs creates a stream that reads documents from next, which returns
+// ok=false once there are no more documents.
+func NewInputs(next func() (any, bool, error)) *Inputs {
+	return &Inputs{next: next}
+}
+
+// Next returns the next document, tagged with its index in the stream,
+// or ok=false at the end of the stream.
+func (in *Inputs) Next() (*CandidateNode, bool, error) {
+	if in.done {
+		return nil, false, nil
+	}
+	value, ok, err := in.next()
+	if err != nil || !ok {
+		in.done = true
+		return nil, false, err
+	}
+	node := NewCandidateNode(value)
+	node.Document = in.count
+	in.count++
+	return node, true, nil
+}